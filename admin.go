@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ===== Admin Endpoints =====
+
+// Register the admin endpoints under /admin/
+func (s *Server) registerAdminRoutes(mux *http.ServeMux) {
+	mux.Handle("/admin/reset", s.requireAdmin(http.HandlerFunc(s.handleReset)))
+	mux.Handle("/admin/snapshots", s.requireAdmin(http.HandlerFunc(s.handleSnapshots)))
+	mux.Handle("/admin/snapshots/", s.requireAdmin(http.HandlerFunc(s.handleSnapshots)))
+	mux.Handle("/admin/audit", s.requireAdmin(http.HandlerFunc(s.handleAudit)))
+	mux.Handle("/admin/pool", s.requireAdmin(http.HandlerFunc(s.handlePool)))
+	mux.Handle("/admin/steampipe", s.requireAdmin(http.HandlerFunc(s.handleSteampipe)))
+}
+
+// Require the admin token as a bearer token or X-Admin-Token header. Without a configured
+// token, only clients on this machine are let in; behind a trusted proxy that is the
+// client the proxy forwarded for, not the proxy itself.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger(r.Context()).Debug("Admin", "method", r.Method, "path", r.URL.Path)
+
+		if s.adminToken == "" {
+			if ip := net.ParseIP(clientIP(r)); ip == nil || !ip.IsLoopback() {
+				logger(r.Context()).Info("refused admin request from a remote client", "path", r.URL.Path)
+				sendErrorResponse(w, "Admin endpoints only accept local requests unless --admin-token is set", http.StatusForbidden)
+				return
+			}
+		} else if !s.hasAdminToken(r) {
+			sendErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Whether a request carries the admin token; always false when none is configured
+func (s *Server) hasAdminToken(r *http.Request) bool {
+	if s.adminToken == "" {
+		return false
+	}
+	token := r.Header.Get("X-Admin-Token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
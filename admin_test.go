@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	proxies, err := parseTrustedProxies("127.0.0.1,::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string // Configured admin token
+		remoteAddr string
+		headers    map[string]string
+		want       int
+	}{
+		{"no token, local client", "", "127.0.0.1:5000", nil, http.StatusNoContent},
+		{"no token, local IPv6 client", "", "[::1]:5000", nil, http.StatusNoContent},
+		{"no token, remote client", "", "192.0.2.1:5000", nil, http.StatusForbidden},
+		{"no token, remote client behind local proxy", "", "127.0.0.1:5000",
+			map[string]string{"X-Forwarded-For": "192.0.2.1"}, http.StatusForbidden},
+		{"no token, remote client claiming to be local", "", "192.0.2.1:5000",
+			map[string]string{"X-Forwarded-For": "127.0.0.1"}, http.StatusForbidden},
+		{"token, remote client with bearer token", "secret", "192.0.2.1:5000",
+			map[string]string{"Authorization": "Bearer secret"}, http.StatusNoContent},
+		{"token, remote client with header", "secret", "192.0.2.1:5000",
+			map[string]string{"X-Admin-Token": "secret"}, http.StatusNoContent},
+		{"token, wrong token", "secret", "192.0.2.1:5000",
+			map[string]string{"X-Admin-Token": "guess"}, http.StatusUnauthorized},
+		{"token, local client without it", "secret", "127.0.0.1:5000", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{adminToken: tt.token, trustedProxies: proxies}
+			r := httptest.NewRequest("GET", "/admin/pool", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			s.logMiddleware(s.requireAdmin(ok)).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
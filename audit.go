@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== Audit Trail =====
+
+// Table in the main database that records every data-modifying statement
+const auditTable = "audit_log"
+
+// Fixed-width UTC timestamps, so they sort and compare as text in SQLite
+const auditTimeFormat = "2006-01-02T15:04:05.000000Z"
+
+type AuditConfig struct {
+	Identity string `json:"identity,omitempty"` // "basic" (default), "apiKey" or "header:<Name>"
+}
+
+// Valid identity sources
+func validateAudit(config AuditConfig) error {
+	if config.Identity != "" && config.Identity != "basic" && config.Identity != "apiKey" &&
+		!(strings.HasPrefix(config.Identity, "header:") && len(config.Identity) > len("header:")) {
+		return fmt.Errorf("unknown audit identity %q (use basic, apiKey or header:<Name>)", config.Identity)
+	}
+	return nil
+}
+
+// Who made a request, as far as the server can tell: the Basic auth user name, a
+// fingerprint of the API key, or a header set by an authenticating proxy. The server
+// checks no passwords itself, so it only believes a user name or header that came
+// through a trusted proxy, which authenticated the client. Other Basic auth user names
+// are recorded as "unverified:<name>", and other identity headers are ignored.
+func (c AuditConfig) identity(r *http.Request, proxied bool) string {
+	switch {
+	case c.Identity == "apiKey":
+		if key := r.Header.Get("X-API-Key"); key != "" {
+			return "apiKey:" + apiKeyFingerprint(key)
+		}
+	case strings.HasPrefix(c.Identity, "header:"):
+		if proxied {
+			return r.Header.Get(strings.TrimPrefix(c.Identity, "header:"))
+		}
+	default:
+		if user, _, ok := r.BasicAuth(); ok && user != "" {
+			if !proxied {
+				return "unverified:" + user
+			}
+			return user
+		}
+	}
+	return ""
+}
+
+// Turn on the audit trail and create its table
+func (s *Server) setupAudit(config AuditConfig) error {
+	if err := validateAudit(config); err != nil {
+		return err
+	}
+	if err := s.createAuditTable(); err != nil {
+		return err
+	}
+	s.audit = &config
+	return nil
+}
+
+func (s *Server) createAuditTable() error {
+	id := "INTEGER PRIMARY KEY AUTOINCREMENT"
+	timeType := "TEXT"
+	if s.dbType == "postgres" {
+		id, timeType = "BIGSERIAL PRIMARY KEY", "TIMESTAMPTZ"
+	}
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS ` + auditTable + ` (
+		id            ` + id + `,
+		time          ` + timeType + ` NOT NULL,
+		identity      TEXT,
+		client_ip     TEXT,
+		request_id    TEXT,
+		endpoint      TEXT,
+		sql           TEXT NOT NULL,
+		params        TEXT,
+		rows_affected INTEGER
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", auditTable, err)
+	}
+	return nil
+}
+
+// The value to store for a time in the audit table
+func (s *Server) auditTime(t time.Time) interface{} {
+	if s.dbType == "postgres" {
+		return t
+	}
+	return t.UTC().Format(auditTimeFormat)
+}
+
+// Run a statement, and when it modifies data with auditing on, record it in the same transaction.
+// run executes the statement against the database or transaction it is given and reports the rows affected.
+func (s *Server) audited(ctx context.Context, sqlQuery string, params []interface{}, run func(q sqlQuerier) (int64, error)) error {
+	if s.audit == nil || !modifiesData(sqlQuery, s.dbType) {
+		_, err := run(s.db)
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rowsAffected, err := run(tx)
+	if err != nil {
+		return err
+	}
+
+	var identity, clientIP, requestID, endpoint string
+	if info := requestInfoFrom(ctx); info != nil {
+		identity, clientIP, requestID, endpoint = info.identity, info.clientIP, info.id, info.template
+	}
+	paramsJSON, err := json.Marshal(auditParams(params))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (time, identity, client_ip, request_id, endpoint, sql, params, rows_affected) VALUES (%s)`,
+		auditTable, s.bindVars(8)),
+		s.auditTime(time.Now()), nullString(identity), nullString(clientIP), nullString(requestID),
+		nullString(endpoint), sqlQuery, string(paramsJSON), rowsAffected)
+	if err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Placeholders for n params, e.g. "?, ?, ?" or "$1, $2, $3"
+func (s *Server) bindVars(n int) string {
+	vars := make([]string, n)
+	for i := range vars {
+		vars[i] = s.bindVar(i + 1)
+	}
+	return strings.Join(vars, ", ")
+}
+
+// Bound params as they are recorded: an object when they are named, otherwise an array.
+// Uploaded files are replaced by their size.
+func auditParams(params []interface{}) interface{} {
+	value := func(param interface{}) interface{} {
+		if data, ok := param.([]byte); ok {
+			return fmt.Sprintf("<%d bytes>", len(data))
+		}
+		return param
+	}
+	named := make(map[string]interface{})
+	recorded := make([]interface{}, len(params))
+	for i, param := range params {
+		if arg, ok := param.(sql.NamedArg); ok {
+			named[arg.Name] = value(arg.Value)
+		} else {
+			recorded[i] = value(param)
+		}
+	}
+	if len(named) > 0 && len(named) == len(params) {
+		return named
+	}
+	return recorded
+}
+
+// Run fn, which replaces the whole SQLite database, without losing the audit trail
+func (s *Server) keepingAuditLog(fn func() error) error {
+	if s.audit == nil || s.dbType != "sqlite" {
+		return fn()
+	}
+
+	columns := "id, time, identity, client_ip, request_id, endpoint, sql, params, rows_affected"
+	rows, err := s.db.Query("SELECT " + columns + " FROM " + auditTable)
+	if err != nil {
+		return err
+	}
+	var saved [][]interface{}
+	for rows.Next() {
+		values := make([]interface{}, 9)
+		ptrs := make([]interface{}, len(values))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			rows.Close()
+			return err
+		}
+		saved = append(saved, values)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	// The restored copy may predate the audit table, or hold an older trail
+	if err := s.createAuditTable(); err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM " + auditTable); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare("INSERT INTO " + auditTable + " (" + columns + ") VALUES (" + s.bindVars(9) + ")")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, values := range saved {
+		if _, err := stmt.Exec(values...); err != nil {
+			return err
+		}
+	}
+	log.Printf("Kept %d audit record(s)", len(saved))
+	return tx.Commit()
+}
+
+// GET /admin/audit?identity=&endpoint=&since=&until=&limit=&offset=
+// lists audit records, newest first
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendErrorResponse(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.audit == nil {
+		sendErrorResponse(w, "Auditing is not enabled", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	var conditions []string
+	var params []interface{}
+	for _, name := range []string{"identity", "endpoint", "request_id"} {
+		if value := query.Get(name); value != "" {
+			params = append(params, value)
+			conditions = append(conditions, name+" = ?")
+		}
+	}
+	for name, op := range map[string]string{"since": ">=", "until": "<"} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				sendErrorResponse(w, fmt.Sprintf("Invalid %s: use an RFC 3339 time", name), http.StatusBadRequest)
+				return
+			}
+			params = append(params, s.auditTime(t))
+			conditions = append(conditions, "time "+op+" ?")
+		}
+	}
+	limit, err := parseCount(query.Get("limit"), 100)
+	if err != nil || limit > 1000 {
+		sendErrorResponse(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	offset, err := parseCount(query.Get("offset"), 0)
+	if err != nil {
+		sendErrorResponse(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	sqlQuery := `SELECT id, time, identity, client_ip AS "clientIp", request_id AS "requestId", endpoint, sql, params,
+		rows_affected AS "rowsAffected" FROM ` + auditTable
+	if len(conditions) > 0 {
+		sqlQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	sqlQuery += " ORDER BY id DESC LIMIT " + strconv.Itoa(limit) + " OFFSET " + strconv.Itoa(offset)
+
+	records, err := s.executeQuery(r.Context(), sqlQuery, params)
+	if err != nil {
+		sendErrorResponse(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if records == nil {
+		records = []map[string]interface{}{}
+	}
+	for _, record := range records {
+		if params, ok := record["params"].(string); ok {
+			record["params"] = json.RawMessage(params)
+		}
+	}
+	s.sendJSONResponse(w, records, http.StatusOK)
+}
+
+// What runQuery and executeStatement need from a database or a transaction
+type sqlQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func newAuditedServer(t *testing.T) *Server {
+	t.Helper()
+	s := newTestServer(t, `CREATE TABLE clients (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO clients (name) VALUES ('a'), ('b'), ('c')`)
+	if err := s.setupAudit(AuditConfig{}); err != nil {
+		t.Fatalf("setupAudit: %v", err)
+	}
+	return s
+}
+
+func TestAuditQueryWrites(t *testing.T) {
+	s := newAuditedServer(t)
+	query := http.HandlerFunc(s.handleQuery)
+
+	w := serveTest(s, query, "POST", "/query", `{"sql": "DELETE FROM clients WHERE id = ?", "params": [1]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("DELETE: status %d: %s", w.Code, w.Body)
+	}
+	if n := queryInt(t, s, `SELECT count(*) FROM audit_log WHERE sql = 'DELETE FROM clients WHERE id = ?' AND endpoint = '/query' AND rows_affected = 1`); n != 1 {
+		t.Errorf("audit rows for the DELETE = %d, want 1", n)
+	}
+}
+
+func TestAuditRejectsMultipleStatements(t *testing.T) {
+	s := newAuditedServer(t)
+	w := serveTest(s, http.HandlerFunc(s.handleQuery), "POST", "/query", `{"sql": "SELECT 1; DELETE FROM clients"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if n := queryInt(t, s, "SELECT count(*) FROM clients"); n != 3 {
+		t.Errorf("clients left = %d, want 3", n)
+	}
+}
+
+func TestAuditProtectsItsTable(t *testing.T) {
+	s := newAuditedServer(t)
+	query := http.HandlerFunc(s.handleQuery)
+	serveTest(s, query, "POST", "/query", `{"sql": "UPDATE clients SET name = 'x'"}`)
+
+	for _, sql := range []string{
+		"DELETE FROM audit_log",
+		`DELETE FROM \"audit_log\"`,
+		"DROP TABLE main.audit_log",
+		"UPDATE audit_log SET identity = 'someone'",
+		"CREATE TRIGGER wipe AFTER INSERT ON clients BEGIN DELETE FROM audit_log; END",
+	} {
+		w := serveTest(s, query, "POST", "/query", `{"sql": "`+sql+`"}`)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want %d", sql, w.Code, http.StatusForbidden)
+		}
+	}
+	if n := queryInt(t, s, "SELECT count(*) FROM audit_log"); n != 1 {
+		t.Errorf("audit rows = %d, want 1", n)
+	}
+
+	// Reading it is fine
+	w := serveTest(s, query, "POST", "/query", `{"sql": "SELECT count(*) AS n FROM audit_log"}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("SELECT: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestAuditEveryStatement(t *testing.T) {
+	// Endpoint SQL isn't limited to one statement; a write after a SELECT is still recorded
+	s := newAuditedServer(t)
+	if _, err := s.runQuery(context.Background(), "SELECT 1; DELETE FROM clients WHERE id = 2", nil, s.types, 0); err != nil {
+		t.Fatalf("runQuery: %v", err)
+	}
+	if n := queryInt(t, s, "SELECT count(*) FROM clients WHERE id = 2"); n != 0 {
+		t.Fatalf("client 2 wasn't deleted")
+	}
+	if n := queryInt(t, s, `SELECT count(*) FROM audit_log WHERE sql = 'SELECT 1; DELETE FROM clients WHERE id = 2'`); n != 1 {
+		t.Errorf("audit rows = %d, want 1", n)
+	}
+}
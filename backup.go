@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ===== SQLite Backup API =====
+
+// Run fn with the raw go-sqlite3 connection behind a database handle
+func withSQLiteConn(db *sql.DB, fn func(*sqlite3.SQLiteConn) error) error {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("not a SQLite connection: %T", driverConn)
+		}
+		return fn(sqliteConn)
+	})
+}
+
+// Copy the main database of src over the main database of dest with the online backup API.
+// All pages are copied in a single step, so readers of dest see either the old or the new contents.
+func copySQLiteDatabase(dest *sql.DB, src *sql.DB) error {
+	return withSQLiteConn(dest, func(destConn *sqlite3.SQLiteConn) error {
+		return withSQLiteConn(src, func(srcConn *sqlite3.SQLiteConn) error {
+			backup, err := destConn.Backup("main", srcConn, "main")
+			if err != nil {
+				return fmt.Errorf("failed to start backup: %w", err)
+			}
+			defer backup.Close()
+
+			// Step returns false without an error while the source is busy or locked
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				done, err := backup.Step(-1)
+				if err != nil {
+					return fmt.Errorf("backup failed: %w", err)
+				}
+				if done {
+					return backup.Finish()
+				}
+				if time.Now().After(deadline) {
+					return fmt.Errorf("backup timed out waiting for a lock")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	})
+}
+
+// Open a private in-memory SQLite database to hold a copy of the main database
+func openMemoryDatabase() (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// Every connection to ":memory:" is a separate database, so keep exactly one alive
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	return db, nil
+}
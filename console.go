@@ -0,0 +1,154 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ===== Admin Console =====
+
+// Console pages and scripts, served under --console-path
+//
+//go:embed console
+var consoleFiles embed.FS
+
+// Number of recent requests kept in memory for the console
+const recentRequestCount = 200
+
+// The last completed requests, newest overwriting oldest
+type recentRequests struct {
+	mu      sync.Mutex
+	entries []requestLogEntry
+	next    int
+	full    bool
+}
+
+func newRecentRequests(size int) *recentRequests {
+	return &recentRequests{entries: make([]requestLogEntry, size)}
+}
+
+func (r *recentRequests) add(entry requestLogEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// The requests kept, newest first
+func (r *recentRequests) list() []requestLogEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := r.next
+	if r.full {
+		count = len(r.entries)
+	}
+	list := make([]requestLogEntry, 0, count)
+	for i := 1; i <= count; i++ {
+		list = append(list, r.entries[(r.next-i+len(r.entries))%len(r.entries)])
+	}
+	return list
+}
+
+// Serve the console under a path, e.g. /console/
+func (s *Server) registerConsole(mux *http.ServeMux, consolePath string) error {
+	consolePath = "/" + strings.Trim(consolePath, "/") + "/"
+	files, err := fs.Sub(consoleFiles, "console")
+	if err != nil {
+		return err
+	}
+	s.consolePath = consolePath
+	mux.Handle(consolePath, http.StripPrefix(consolePath, http.FileServer(http.FS(files))))
+	mux.Handle("/admin/requests", s.requireAdmin(http.HandlerFunc(s.handleRecentRequests)))
+	mux.Handle("/admin/endpoints", s.requireAdmin(http.HandlerFunc(s.handleEndpoints)))
+	return nil
+}
+
+// Requests the console makes for itself, which are left out of the recent requests
+func (s *Server) isConsoleRequest(requestPath string) bool {
+	return s.consolePath != "" && (strings.HasPrefix(requestPath, s.consolePath) || strings.HasPrefix(requestPath, "/admin/requests"))
+}
+
+// GET /admin/requests?errors=true lists recent requests (or only the failed ones), newest first
+func (s *Server) handleRecentRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendErrorResponse(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	errorsOnly := r.URL.Query().Get("errors") == "true"
+	entries := []requestLogEntry{}
+	for _, entry := range s.recent.list() {
+		if !errorsOnly || entry.Status >= 400 {
+			entries = append(entries, entry)
+		}
+	}
+	s.sendJSONResponse(w, entries, http.StatusOK)
+}
+
+// An API description method, as the console lists it
+type EndpointSummary struct {
+	Path        string   `json:"path"` // Full path, including the base path
+	Method      string   `json:"method"`
+	Description string   `json:"description,omitempty"`
+	PathParams  []string `json:"pathParams"`
+	Params      []string `json:"params"` // Declared params that aren't path params
+	SQL         string   `json:"sql"`
+	Exec        bool     `json:"exec"`
+	Result      string   `json:"result,omitempty"`
+	Format      string   `json:"format,omitempty"`
+}
+
+// GET /admin/endpoints lists the API description's methods with their params
+func (s *Server) handleEndpoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendErrorResponse(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	summaries := []EndpointSummary{}
+	if s.apiDesc == nil {
+		s.sendJSONResponse(w, summaries, http.StatusOK)
+		return
+	}
+
+	basePath := strings.TrimSuffix(s.apiDesc.BasePath, "/")
+	for _, endpoint := range s.apiDesc.Endpoints {
+		methods := make([]string, 0, len(endpoint.Methods))
+		for method := range endpoint.Methods {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		pathParams := endpointPathParams(endpoint.Path)
+		for _, method := range methods {
+			def := endpoint.Methods[method]
+			sqlQuery, err := s.methodSQL(def)
+			if err != nil {
+				sqlQuery = ""
+			}
+			summary := EndpointSummary{
+				Path:        basePath + endpoint.Path,
+				Method:      method,
+				Description: def.Description,
+				PathParams:  append([]string{}, pathParams...),
+				Params:      []string{},
+				SQL:         sqlQuery,
+				Exec:        sqlQuery != "" && def.isExec(sqlQuery, s.dbType),
+				Result:      def.Result,
+				Format:      def.Format,
+			}
+			for _, param := range def.Params {
+				if !containsString(pathParams, param) {
+					summary.Params = append(summary.Params, param)
+				}
+			}
+			summaries = append(summaries, summary)
+		}
+	}
+	s.sendJSONResponse(w, summaries, http.StatusOK)
+}
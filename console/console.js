@@ -0,0 +1,307 @@
+// Admin console for xmlui-test-server: schema browser, SQL editor, endpoint tester and recent requests.
+// Everything goes through the server's own endpoints: /schema, /query and /admin/*.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+// Create an element; children may be strings, elements, or null (skipped)
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [name, value] of Object.entries(attrs || {})) {
+    if (name.startsWith("on")) node.addEventListener(name.slice(2), value);
+    else if (value !== undefined && value !== null && value !== false) node.setAttribute(name, value);
+  }
+  for (const child of children.flat()) {
+    if (child !== null && child !== undefined) node.append(child instanceof Node ? child : String(child));
+  }
+  return node;
+}
+
+// ===== Requests to the server =====
+
+const tokenInput = $("token");
+tokenInput.value = localStorage.getItem("adminToken") || "";
+tokenInput.addEventListener("change", () => {
+  localStorage.setItem("adminToken", tokenInput.value);
+  loadCurrentView();
+});
+
+// Fetch from the server, sending the admin token to /admin/ endpoints
+async function request(path, options = {}) {
+  const headers = new Headers(options.headers || {});
+  if (path.startsWith("/admin/") && tokenInput.value) headers.set("X-Admin-Token", tokenInput.value);
+  const started = performance.now();
+  const response = await fetch(path, { ...options, headers });
+  const text = await response.text();
+  let body = text;
+  try { body = text ? JSON.parse(text) : null; } catch { /* not JSON */ }
+  return { response, body, text, ms: Math.round(performance.now() - started) };
+}
+
+async function getJSON(path) {
+  const { response, text, body } = await request(path);
+  if (response.status === 401) throw new Error("Unauthorized: enter the admin token");
+  if (!response.ok) throw new Error(text.trim() || response.statusText);
+  return body;
+}
+
+// ===== Result grids =====
+
+function formatCell(value) {
+  if (value === null || value === undefined) return el("td", { class: "null" }, "null");
+  const text = typeof value === "object" ? JSON.stringify(value) : String(value);
+  return el("td", { title: text.length > 60 ? text : null }, text);
+}
+
+// Render rows as a table; columns are [{name, type}] and rows are arrays in column order
+function grid(columns, rows, rowClass) {
+  return el("table", {},
+    el("thead", {}, el("tr", {}, columns.map((c) => el("th", {}, c.name, c.type ? el("small", {}, " ", c.type.toLowerCase()) : null)))),
+    el("tbody", {}, rows.map((row, i) => el("tr", { class: rowClass ? rowClass(i) : null }, row.map(formatCell)))));
+}
+
+// Render any JSON response: arrays of objects as a grid, anything else as JSON
+function renderJSON(value) {
+  if (Array.isArray(value) && value.length > 0 && value.every((r) => r && typeof r === "object" && !Array.isArray(r))) {
+    const names = [...new Set(value.flatMap((r) => Object.keys(r)))];
+    return grid(names.map((name) => ({ name })), value.map((r) => names.map((n) => r[n])));
+  }
+  return el("pre", {}, typeof value === "string" ? value : JSON.stringify(value, null, 2));
+}
+
+function download(filename, type, content) {
+  const link = el("a", { href: URL.createObjectURL(new Blob([content], { type })), download: filename });
+  link.click();
+  URL.revokeObjectURL(link.href);
+}
+
+function csvField(value) {
+  if (value === null || value === undefined) return "";
+  const text = typeof value === "object" ? JSON.stringify(value) : String(value);
+  return /[",\n\r]/.test(text) ? `"${text.replace(/"/g, '""')}"` : text;
+}
+
+// ===== Views =====
+
+const views = {};
+let currentView = "schema";
+
+function showView(name) {
+  currentView = name;
+  document.querySelectorAll("nav button").forEach((b) => b.classList.toggle("active", b.dataset.view === name));
+  document.querySelectorAll(".view").forEach((v) => v.classList.toggle("active", v.id === name));
+  location.hash = name;
+  loadCurrentView();
+}
+
+function loadCurrentView() {
+  views[currentView].load();
+}
+
+document.querySelectorAll("nav button").forEach((b) => b.addEventListener("click", () => showView(b.dataset.view)));
+
+// ----- Schema browser -----
+
+views.schema = {
+  loaded: false,
+  async load() {
+    if (this.loaded) return;
+    const list = $("schema-list");
+    try {
+      const schema = await getJSON("/schema");
+      list.replaceChildren(
+        el("h2", {}, `Tables (${schema.tables.length})`), schema.tables.map((t) => this.link(t)),
+        el("h2", {}, `Views (${schema.views.length})`), schema.views.map((t) => this.link(t)));
+      this.loaded = true;
+    } catch (err) {
+      list.replaceChildren(el("p", { class: "error" }, err.message));
+    }
+  },
+  link(table) {
+    const link = el("a", { onclick: () => {
+      $("schema-list").querySelectorAll("a").forEach((a) => a.classList.remove("active"));
+      link.classList.add("active");
+      this.show(table);
+    } }, table.name);
+    return link;
+  },
+  show(table) {
+    const name = table.schema ? `${table.schema}.${table.name}` : table.name;
+    const text = (value) => (value === null || value === undefined ? "" : value);
+    $("schema-detail").replaceChildren(
+      el("h2", {}, name, " ", el("small", { class: "muted" }, table.type, table.module ? ` (${table.module})` : "")),
+      el("button", { onclick: () => {
+        $("sql-text").value = `SELECT * FROM ${quoteIdent(table.name)} LIMIT 100`;
+        showView("sql");
+        views.sql.run();
+      } }, "Query"),
+      el("h3", {}, "Columns"),
+      grid([{ name: "name" }, { name: "type" }, { name: "not null" }, { name: "default" }, { name: "key" }],
+        table.columns.map((c) => [c.name, c.type, c.notNull ? "yes" : "", text(c.default), c.primaryKey ? "PK" : ""])),
+      table.foreignKeys.length ? [el("h3", {}, "Foreign keys"),
+        grid([{ name: "columns" }, { name: "references" }, { name: "on update" }, { name: "on delete" }],
+          table.foreignKeys.map((fk) => [fk.columns.join(", "), `${fk.referencedTable}(${fk.referencedColumns.join(", ")})`, fk.onUpdate, fk.onDelete]))] : null,
+      table.indexes.length ? [el("h3", {}, "Indexes"),
+        grid([{ name: "name" }, { name: "columns" }, { name: "unique" }],
+          table.indexes.map((ix) => [ix.name, ix.columns.map((c) => c || "(expression)").join(", "), ix.unique ? "yes" : ""]))] : null,
+      table.triggers.length ? [el("h3", {}, "Triggers"), table.triggers.map((t) => el("pre", {}, t.sql))] : null);
+  },
+};
+
+function quoteIdent(name) {
+  return /^[A-Za-z_][A-Za-z0-9_]*$/.test(name) ? name : `"${name.replace(/"/g, '""')}"`;
+}
+
+// ----- SQL editor -----
+
+views.sql = {
+  result: null,
+  load() { $("sql-text").focus(); },
+  async run() {
+    const status = $("sql-status");
+    const sql = $("sql-text").value.trim();
+    if (!sql) return;
+    const body = { sql, format: "arrays", maxRows: Number($("sql-max-rows").value) || 0 };
+    if ($("sql-params").value.trim()) {
+      try { body.params = JSON.parse($("sql-params").value); } catch (err) {
+        status.className = "status error";
+        status.textContent = `Params must be a JSON array: ${err.message}`;
+        return;
+      }
+    }
+    status.className = "status";
+    status.textContent = "Running...";
+    const { response, body: result, text, ms } = await request("/query", { method: "POST", headers: { "Content-Type": "application/json" }, body: JSON.stringify(body) });
+    this.setResult(null);
+    if (!response.ok) {
+      status.className = "status error";
+      status.textContent = text.trim() || response.statusText;
+      $("sql-result").replaceChildren();
+      return;
+    }
+    if (result && "rowsAffected" in result) {
+      status.textContent = `${result.rowsAffected} row(s) affected` + (result.lastInsertId !== null ? `, last insert id ${result.lastInsertId}` : "") + ` in ${ms} ms`;
+      $("sql-result").replaceChildren();
+      return;
+    }
+    status.textContent = `${result.rowCount} row(s)${result.truncated ? " (truncated)" : ""}, query ${result.queryDurationMs} ms, total ${ms} ms`;
+    $("sql-result").replaceChildren(grid(result.columns, result.rows));
+    this.setResult(result);
+  },
+  setResult(result) {
+    this.result = result;
+    $("sql-csv").disabled = $("sql-json").disabled = !result;
+  },
+  exportCSV() {
+    const { columns, rows } = this.result;
+    const lines = [columns.map((c) => csvField(c.name)).join(",")].concat(rows.map((r) => r.map(csvField).join(",")));
+    download("query.csv", "text/csv", lines.join("\r\n") + "\r\n");
+  },
+  exportJSON() {
+    const { columns, rows } = this.result;
+    const objects = rows.map((r) => Object.fromEntries(columns.map((c, i) => [c.name, r[i]])));
+    download("query.json", "application/json", JSON.stringify(objects, null, 2));
+  },
+};
+
+$("sql-run").addEventListener("click", () => views.sql.run());
+$("sql-csv").addEventListener("click", () => views.sql.exportCSV());
+$("sql-json").addEventListener("click", () => views.sql.exportJSON());
+$("sql-text").addEventListener("keydown", (e) => {
+  if (e.key === "Enter" && (e.ctrlKey || e.metaKey)) {
+    e.preventDefault();
+    views.sql.run();
+  }
+});
+
+// ----- Endpoints -----
+
+views.endpoints = {
+  loaded: false,
+  async load() {
+    if (this.loaded) return;
+    const list = $("endpoint-list");
+    try {
+      const endpoints = await getJSON("/admin/endpoints");
+      list.replaceChildren(endpoints.length ? endpoints.map((e) => this.link(e)) : el("p", { class: "muted" }, "No API description loaded."));
+      this.loaded = true;
+    } catch (err) {
+      list.replaceChildren(el("p", { class: "error" }, err.message));
+    }
+  },
+  link(endpoint) {
+    const link = el("a", { title: endpoint.description, onclick: () => {
+      $("endpoint-list").querySelectorAll("a").forEach((a) => a.classList.remove("active"));
+      link.classList.add("active");
+      this.show(endpoint);
+    } }, el("span", { class: "method" }, endpoint.method), endpoint.path);
+    return link;
+  },
+  // A form with a field per param; path params go into the URL, others into the query string (GET) or a JSON body
+  show(endpoint) {
+    const inputs = {};
+    const field = (name, where) => {
+      inputs[name] = el("input", { name });
+      return [el("label", {}, name, " ", el("small", { class: "muted" }, where)), inputs[name]];
+    };
+    const output = el("div", {});
+    const send = async () => {
+      let path = endpoint.path;
+      for (const name of endpoint.pathParams) path = path.replace(`:${name}`, encodeURIComponent(inputs[name].value));
+      const options = { method: endpoint.method, headers: {} };
+      const values = Object.fromEntries(endpoint.params.filter((n) => inputs[n].value !== "").map((n) => [n, inputs[n].value]));
+      if (endpoint.method === "GET" || endpoint.method === "DELETE") {
+        const query = new URLSearchParams(values).toString();
+        if (query) path += `?${query}`;
+      } else {
+        options.headers["Content-Type"] = "application/json";
+        options.body = JSON.stringify(values);
+      }
+      const { response, body, ms } = await request(path, options);
+      output.replaceChildren(
+        el("p", { class: response.ok ? "status" : "status error" },
+          `${endpoint.method} ${path} → ${response.status} ${response.statusText} in ${ms} ms`,
+          response.headers.get("X-Request-ID") ? ` (request ${response.headers.get("X-Request-ID")})` : ""),
+        renderJSON(body));
+    };
+    $("endpoint-detail").replaceChildren(
+      el("h2", {}, el("span", { class: "method" }, endpoint.method), endpoint.path),
+      endpoint.description ? el("p", {}, endpoint.description) : null,
+      el("pre", {}, endpoint.sql),
+      el("div", { class: "form" },
+        endpoint.pathParams.map((n) => field(n, "path")),
+        endpoint.params.map((n) => field(n, endpoint.method === "GET" || endpoint.method === "DELETE" ? "query" : "body"))),
+      el("button", { onclick: send }, "Send"),
+      output);
+  },
+};
+
+// ----- Recent requests -----
+
+views.requests = {
+  async load() {
+    const status = $("requests-status");
+    try {
+      const errorsOnly = $("requests-errors").checked;
+      const entries = await getJSON(`/admin/requests${errorsOnly ? "?errors=true" : ""}`);
+      status.className = "status";
+      status.textContent = `${entries.length} request(s), newest first`;
+      const columns = ["time", "method", "path", "template", "status", "rows", "durationMs", "clientIp", "error", "params", "requestId"];
+      $("requests-result").replaceChildren(grid(
+        columns.map((name) => ({ name })),
+        entries.map((e) => columns.map((c) => (c === "time" ? new Date(e.time).toLocaleTimeString() : e[c]))),
+        (i) => (entries[i].status >= 400 ? "failed" : null)));
+    } catch (err) {
+      status.className = "status error";
+      status.textContent = err.message;
+    }
+  },
+};
+
+$("requests-errors").addEventListener("change", () => views.requests.load());
+$("requests-reload").addEventListener("click", () => views.requests.load());
+setInterval(() => {
+  if (currentView === "requests" && $("requests-refresh").checked && !document.hidden) views.requests.load();
+}, 5000);
+
+showView(views[location.hash.slice(1)] ? location.hash.slice(1) : "schema");
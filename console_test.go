@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecentRequests(t *testing.T) {
+	recent := newRecentRequests(3)
+	ids := func() []string {
+		var list []string
+		for _, entry := range recent.list() {
+			list = append(list, entry.RequestID)
+		}
+		return list
+	}
+
+	if got := recent.list(); len(got) != 0 {
+		t.Errorf("new list = %v, want empty", got)
+	}
+	for _, id := range []string{"a", "b"} {
+		recent.add(requestLogEntry{RequestID: id})
+	}
+	if got, want := ids(), []string{"b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("list = %v, want %v", got, want)
+	}
+	for _, id := range []string{"c", "d", "e"} {
+		recent.add(requestLogEntry{RequestID: id})
+	}
+	if got, want := ids(), []string{"e", "d", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("list after wrapping = %v, want %v", got, want)
+	}
+}
+
+func TestConsole(t *testing.T) {
+	s := newTestServer(t, "")
+	useEndpoints(s, EndpointDefinition{Path: "/clients/:id", Methods: map[string]MethodDefinition{
+		"GET":    {SQL: "SELECT * FROM clients WHERE id = :id", Params: []string{"id", "fields"}, Result: shapeSingle, Description: "One client"},
+		"DELETE": {SQL: "DELETE FROM clients WHERE id = :id", Params: []string{"id"}},
+	}})
+	s.recent = newRecentRequests(recentRequestCount)
+	mux := http.NewServeMux()
+	if err := s.registerConsole(mux, "tools/console"); err != nil {
+		t.Fatalf("registerConsole: %v", err)
+	}
+	handler := s.logMiddleware(mux)
+	request := func(target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		r.RemoteAddr = "127.0.0.1:5000"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("/tools/console/"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<html") {
+		t.Errorf("console page: status %d", w.Code)
+	}
+
+	// Requests for the console itself aren't listed
+	s.recent.add(requestLogEntry{RequestID: "ok", Path: "/api/clients/1", Status: 200})
+	s.recent.add(requestLogEntry{RequestID: "failed", Path: "/api/clients/2", Status: 404})
+	request("/admin/requests")
+	var entries []requestLogEntry
+	if err := json.Unmarshal(request("/admin/requests").Body.Bytes(), &entries); err != nil || len(entries) != 2 || entries[0].RequestID != "failed" {
+		t.Errorf("requests = %+v (%v), want the two API requests, newest first", entries, err)
+	}
+	if err := json.Unmarshal(request("/admin/requests?errors=true").Body.Bytes(), &entries); err != nil || len(entries) != 1 || entries[0].RequestID != "failed" {
+		t.Errorf("failed requests = %+v (%v), want the one", entries, err)
+	}
+
+	var endpoints []EndpointSummary
+	if err := json.Unmarshal(request("/admin/endpoints").Body.Bytes(), &endpoints); err != nil {
+		t.Fatalf("endpoints: %v", err)
+	}
+	want := []EndpointSummary{
+		{Path: "/api/clients/:id", Method: "DELETE", PathParams: []string{"id"}, Params: []string{}, SQL: "DELETE FROM clients WHERE id = :id", Exec: true},
+		{Path: "/api/clients/:id", Method: "GET", Description: "One client", PathParams: []string{"id"}, Params: []string{"fields"},
+			SQL: "SELECT * FROM clients WHERE id = :id", Result: shapeSingle},
+	}
+	if !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("endpoints = %+v, want %+v", endpoints, want)
+	}
+
+	// Remote clients need the admin token
+	r := httptest.NewRequest("GET", "/admin/endpoints", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("remote request without a token: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ===== CORS Policy =====
+
+// CORSConfig describes a cross-origin policy. A global policy comes from the
+// "cors" block of the API description and the --cors-* flags; an endpoint can
+// override any part of it with its own "cors" block.
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowedOrigins,omitempty"` // Exact origins, "*", or glob patterns like "https://*.example.com"
+	AllowedHeaders   []string `json:"allowedHeaders,omitempty"` // Request headers allowed on preflight ("*" echoes the requested headers)
+	ExposedHeaders   []string `json:"exposedHeaders,omitempty"` // Response headers readable by the client
+	AllowCredentials *bool    `json:"allowCredentials,omitempty"`
+	MaxAge           *int     `json:"maxAge,omitempty"` // Preflight cache lifetime in seconds
+}
+
+// Default policy: any origin, any header, no credentials
+func defaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedHeaders: []string{"*"},
+	}
+}
+
+// Merge returns a copy of c with every field that is set in override replacing its counterpart
+func (c CORSConfig) Merge(override *CORSConfig) CORSConfig {
+	if override == nil {
+		return c
+	}
+	if override.AllowedOrigins != nil {
+		c.AllowedOrigins = override.AllowedOrigins
+	}
+	if override.AllowedHeaders != nil {
+		c.AllowedHeaders = override.AllowedHeaders
+	}
+	if override.ExposedHeaders != nil {
+		c.ExposedHeaders = override.ExposedHeaders
+	}
+	if override.AllowCredentials != nil {
+		c.AllowCredentials = override.AllowCredentials
+	}
+	if override.MaxAge != nil {
+		c.MaxAge = override.MaxAge
+	}
+	return c
+}
+
+func (c CORSConfig) credentials() bool {
+	return c.AllowCredentials != nil && *c.AllowCredentials
+}
+
+// Check whether an origin is allowed by the policy
+func (c CORSConfig) originAllowed(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if strings.Contains(allowed, "*") {
+			if ok, err := path.Match(strings.ToLower(allowed), strings.ToLower(origin)); err == nil && ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c CORSConfig) wildcardOrigin() bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Credentials let a site read responses with the user's cookies, so they need a list of
+// trusted origins. With "*" any site could read them.
+func (c CORSConfig) validate() error {
+	if c.credentials() && c.wildcardOrigin() {
+		return fmt.Errorf("CORS credentials can't be allowed for every origin (\"*\"): list the allowed origins")
+	}
+	return nil
+}
+
+// Check the global CORS policy and every endpoint's
+func (s *Server) validateCORS() error {
+	if err := s.cors.validate(); err != nil {
+		return err
+	}
+	if s.apiDesc == nil {
+		return nil
+	}
+	for _, endpoint := range s.apiDesc.Endpoints {
+		if err := s.cors.Merge(endpoint.CORS).validate(); err != nil {
+			return fmt.Errorf("endpoint %s: %w", endpoint.Path, err)
+		}
+	}
+	return nil
+}
+
+// Split a comma-separated flag value into a trimmed list
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Find the CORS policy and allowed methods for a request URL's path.
+// Returns ok=false for paths the server does not serve.
+func (s *Server) corsPolicyFor(u *url.URL) (CORSConfig, []string, bool) {
+	requestPath := u.Path
+	switch {
+	case requestPath == "/query":
+		return s.cors, []string{"POST", "OPTIONS"}, true
+	case requestPath == "/schema":
+		return s.cors, []string{"GET", "OPTIONS"}, true
+	case requestPath == "/graphql" && s.graphql != nil:
+		return s.cors, []string{"GET", "OPTIONS", "POST"}, true
+	case strings.HasPrefix(requestPath, "/proxy/"):
+		return s.cors, []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}, true
+	case strings.HasPrefix(requestPath, "/admin/"):
+		return s.cors, []string{"GET", "POST", "DELETE", "OPTIONS"}, true
+	}
+
+	if s.apiDesc != nil && s.isAPIPath(requestPath) {
+		endpoint, _ := s.findMatchingEndpoint(requestPath)
+		if endpoint == nil {
+			if resource, key := s.findCRUDResource(u.EscapedPath()); resource != nil {
+				return s.cors, resource.methods(key), true
+			}
+			return CORSConfig{}, nil, false
+		}
+		methods := []string{"OPTIONS"}
+		for method := range endpoint.Methods {
+			methods = append(methods, strings.ToUpper(method))
+		}
+		sort.Strings(methods)
+		return s.cors.Merge(endpoint.CORS), methods, true
+	}
+
+	// Everything else is a static file
+	return s.cors, []string{"GET", "HEAD", "OPTIONS"}, true
+}
+
+// Check whether a request path falls under the API base path
+func (s *Server) isAPIPath(requestPath string) bool {
+	basePath := strings.TrimSuffix(s.apiDesc.BasePath, "/")
+	return basePath != "" && (requestPath == basePath || strings.HasPrefix(requestPath, basePath+"/"))
+}
+
+// Apply the CORS policy and answer preflight requests for known paths
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+
+		policy, methods, known := s.corsPolicyFor(r.URL)
+		if !known {
+			if preflight {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !policy.originAllowed(origin) {
+			if preflight {
+				logger(r.Context()).Info("CORS: rejected preflight", "origin", origin, "path", r.URL.Path)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Credentials only go with listed origins; validateCORS refuses them with a wildcard
+		if policy.wildcardOrigin() {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if policy.credentials() {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if !preflight {
+			if len(policy.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Preflight: the requested method must be one the path supports
+		requestedMethod := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+		if !containsString(methods, requestedMethod) {
+			logger(r.Context()).Info("CORS: method not allowed", "method", requestedMethod, "path", r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+		if containsString(policy.AllowedHeaders, "*") {
+			if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				w.Header().Set("Access-Control-Allow-Headers", requested)
+			}
+		} else if len(policy.AllowedHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+		}
+		if policy.MaxAge != nil {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(*policy.MaxAge))
+		}
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestCORSConfigMerge(t *testing.T) {
+	yes, age := true, 600
+	base := CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowedHeaders: []string{"*"}, MaxAge: &age}
+
+	if got := base.Merge(nil); !reflect.DeepEqual(got, base) {
+		t.Errorf("Merge(nil) = %+v, want the base unchanged", got)
+	}
+	got := base.Merge(&CORSConfig{AllowedOrigins: []string{"https://other.example.com"}, AllowCredentials: &yes})
+	want := CORSConfig{AllowedOrigins: []string{"https://other.example.com"}, AllowedHeaders: []string{"*"}, AllowCredentials: &yes, MaxAge: &age}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge = %+v, want %+v", got, want)
+	}
+	// An empty list is set, and clears the base's
+	if got := base.Merge(&CORSConfig{AllowedHeaders: []string{}}); len(got.AllowedHeaders) != 0 || len(got.AllowedOrigins) != 1 {
+		t.Errorf("Merge with empty headers = %+v", got)
+	}
+}
+
+func TestCORSConfigValidate(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name    string
+		config  CORSConfig
+		wantErr bool
+	}{
+		{"default", defaultCORSConfig(), false},
+		{"credentials with listed origins", CORSConfig{AllowedOrigins: []string{"https://a.example.com"}, AllowCredentials: &yes}, false},
+		{"credentials with pattern", CORSConfig{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: &yes}, false},
+		{"credentials with wildcard", CORSConfig{AllowedOrigins: []string{"https://a.example.com", "*"}, AllowCredentials: &yes}, true},
+		{"wildcard without credentials", CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: &no}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.config.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validate error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCORSOriginAllowed(t *testing.T) {
+	config := CORSConfig{AllowedOrigins: []string{"https://app.example.com", "https://*.preview.example.com"}}
+	tests := map[string]bool{
+		"https://app.example.com":          true,
+		"HTTPS://APP.EXAMPLE.COM":          true,
+		"https://pr-1.preview.example.com": true,
+		"http://app.example.com":           false,
+		"https://evil.example.com":         false,
+		"https://preview.example.com":      false,
+	}
+	for origin, want := range tests {
+		if got := config.originAllowed(origin); got != want {
+			t.Errorf("originAllowed(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	yes := true
+	s := &Server{
+		cors: defaultCORSConfig().Merge(&CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: &yes}),
+		apiDesc: &APIDescription{BasePath: "/api", Endpoints: []EndpointDefinition{
+			{Path: "/clients", Methods: map[string]MethodDefinition{"GET": {}, "POST": {}}},
+			{Path: "/public", Methods: map[string]MethodDefinition{"GET": {}}, CORS: &CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: new(bool)}},
+		}},
+		pathRegexps: map[string]*regexp.Regexp{},
+	}
+	for _, endpoint := range s.apiDesc.Endpoints {
+		s.pathRegexps[endpoint.Path] = regexp.MustCompile(pathToRegexp(endpoint.Path))
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		preflight   string // Access-Control-Request-Method
+		wantStatus  int
+		wantOrigin  string
+		wantMethods string
+		wantCreds   string
+	}{
+		{"preflight", "OPTIONS", "/api/clients", "https://app.example.com", "POST", http.StatusNoContent, "https://app.example.com", "GET, OPTIONS, POST", "true"},
+		{"preflight, method not supported", "OPTIONS", "/api/clients", "https://app.example.com", "DELETE", http.StatusForbidden, "https://app.example.com", "", "true"},
+		{"preflight, origin not allowed", "OPTIONS", "/api/clients", "https://evil.example.com", "GET", http.StatusForbidden, "", "", ""},
+		{"preflight, no origin", "OPTIONS", "/api/clients", "", "GET", http.StatusForbidden, "", "", ""},
+		{"preflight, unknown path", "OPTIONS", "/api/nothing", "https://app.example.com", "GET", http.StatusNotFound, "", "", ""},
+		{"preflight, endpoint policy", "OPTIONS", "/api/public", "https://anyone.example.org", "GET", http.StatusNoContent, "*", "GET, OPTIONS", ""},
+		{"preflight, query", "OPTIONS", "/query", "https://app.example.com", "POST", http.StatusNoContent, "https://app.example.com", "POST, OPTIONS", "true"},
+		{"simple request", "GET", "/api/clients", "https://app.example.com", "", http.StatusOK, "https://app.example.com", "", "true"},
+		{"simple request, origin not allowed", "GET", "/api/clients", "https://evil.example.com", "", http.StatusOK, "", "", ""},
+		{"plain OPTIONS", "OPTIONS", "/api/nothing", "https://app.example.com", "", http.StatusOK, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight != "" {
+				r.Header.Set("Access-Control-Request-Method", tt.preflight)
+			}
+			w := httptest.NewRecorder()
+			s.corsMiddleware(next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Allow-Origin %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("Allow-Methods %q, want %q", got, tt.wantMethods)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCreds {
+				t.Errorf("Allow-Credentials %q, want %q", got, tt.wantCreds)
+			}
+		})
+	}
+}
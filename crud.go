@@ -0,0 +1,451 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ===== Generated CRUD Resources =====
+
+// CRUDConfig selects tables and views to expose as REST resources under the API base path.
+// Hand-written endpoints take precedence over generated ones with the same path.
+type CRUDConfig struct {
+	Include  []string `json:"include,omitempty"`  // Table names or glob patterns (default: all)
+	Exclude  []string `json:"exclude,omitempty"`  // Table names or glob patterns to leave out
+	ReadOnly bool     `json:"readOnly,omitempty"` // Expose only list and get (always the case for views and virtual tables)
+	Prefix   string   `json:"prefix,omitempty"`   // Path prefix for resources, e.g. "/tables"
+}
+
+type crudResource struct {
+	table    TableInfo
+	path     string // Collection path relative to the API base path, e.g. "/clients"
+	readOnly bool
+}
+
+// Tables the server manages itself, which are never exposed
+func (s *Server) internalTables() []string {
+	tables := []string{migrationsTable}
+	if s.audit != nil {
+		tables = append(tables, auditTable)
+	}
+	return tables
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok || pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Introspect the database and build the resources selected by the API description
+func (s *Server) setupCRUD() error {
+	if s.apiDesc == nil || s.apiDesc.CRUD == nil {
+		return nil
+	}
+	config := s.apiDesc.CRUD
+
+	tables, err := s.introspectTables()
+	if err != nil {
+		return err
+	}
+
+	s.crud = make(map[string]*crudResource)
+	for _, table := range tables {
+		if containsString(s.internalTables(), table.Name) {
+			continue
+		}
+		if len(config.Include) > 0 && !matchesAny(config.Include, table.Name) {
+			continue
+		}
+		if matchesAny(config.Exclude, table.Name) {
+			continue
+		}
+
+		resource := &crudResource{
+			table:    table,
+			path:     strings.TrimSuffix(config.Prefix, "/") + "/" + table.Name,
+			readOnly: config.ReadOnly || table.Type != "table",
+		}
+		s.crud[resource.path] = resource
+		log.Printf("CRUD resource: %s (%s %s, key: %s, read-only: %v)",
+			resource.path, table.Type, table.Name, strings.Join(table.PrimaryKey, ","), resource.readOnly)
+	}
+	return nil
+}
+
+// Strip the API base path from a request path
+func (s *Server) relativeAPIPath(requestPath string) string {
+	basePath := s.apiDesc.BasePath
+	if basePath != "" && strings.HasPrefix(requestPath, basePath) {
+		requestPath = strings.TrimPrefix(requestPath, basePath)
+	}
+	requestPath = strings.TrimSuffix(requestPath, "/")
+	if requestPath == "" {
+		requestPath = "/"
+	}
+	return requestPath
+}
+
+// Find the generated resource for an escaped request path (URL.EscapedPath), and the key
+// segment if it addresses one row. The key stays escaped, so an encoded "/" or "," in a key
+// value can't be taken for a separator.
+func (s *Server) findCRUDResource(escapedPath string) (*crudResource, string) {
+	if s.apiDesc == nil || len(s.crud) == 0 {
+		return nil, ""
+	}
+	relative := s.relativeAPIPath(escapedPath)
+	if resource, ok := s.crud[unescapePath(relative)]; ok {
+		return resource, ""
+	}
+	slash := strings.LastIndex(relative, "/")
+	if slash < 0 {
+		return nil, ""
+	}
+	if resource, ok := s.crud[unescapePath(relative[:slash])]; ok && len(resource.table.PrimaryKey) > 0 {
+		return resource, relative[slash+1:]
+	}
+	return nil, ""
+}
+
+// Decode an escaped path, leaving it as is when it isn't validly escaped
+func unescapePath(escaped string) string {
+	if unescaped, err := url.PathUnescape(escaped); err == nil {
+		return unescaped
+	}
+	return escaped
+}
+
+// Methods a resource accepts for the collection or for a single row
+func (resource *crudResource) methods(key string) []string {
+	methods := []string{"GET", "OPTIONS"}
+	if !resource.readOnly {
+		if key == "" {
+			methods = append(methods, "POST")
+		} else {
+			methods = append(methods, "PUT", "PATCH", "DELETE")
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Build "pk1 = ? AND pk2 = ?" for an escaped key segment. Composite keys are separated by
+// commas; a comma within a value is sent percent-encoded as %2C.
+func (resource *crudResource) keyCondition(key string) (string, []interface{}, error) {
+	pk := resource.table.PrimaryKey
+	values := strings.Split(key, ",")
+	if len(values) != len(pk) {
+		return "", nil, fmt.Errorf("expected %d key value(s) for %s", len(pk), resource.table.Name)
+	}
+	conditions := make([]string, len(pk))
+	params := make([]interface{}, len(pk))
+	for i, column := range pk {
+		value, err := url.PathUnescape(values[i])
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid key value %q for %s", values[i], column)
+		}
+		conditions[i] = quoteIdent(column) + " = ?"
+		params[i] = value
+	}
+	return strings.Join(conditions, " AND "), params, nil
+}
+
+// Convert a JSON body value to a SQL parameter; objects and arrays are stored as JSON text
+func sqlValue(value interface{}) interface{} {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil
+		}
+		return string(encoded)
+	}
+	return value
+}
+
+// Handle a request for a generated resource
+func (s *Server) handleCRUD(w http.ResponseWriter, r *http.Request, resource *crudResource, key string) {
+	logger(r.Context()).Debug("CRUD", "method", r.Method, "path", r.URL.Path)
+
+	if !containsString(resource.methods(key), r.Method) {
+		sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if key == "" {
+		requestInfoFrom(r.Context()).note(resource.path, nil)
+	} else {
+		requestInfoFrom(r.Context()).note(resource.path+"/:key", map[string]interface{}{"key": key})
+	}
+
+	switch {
+	case key == "" && r.Method == "GET":
+		s.crudList(w, r, resource)
+	case key == "" && r.Method == "POST":
+		s.crudCreate(w, r, resource)
+	case r.Method == "GET":
+		s.crudGet(w, r, resource, key)
+	case r.Method == "PUT" || r.Method == "PATCH":
+		s.crudUpdate(w, r, resource, key)
+	case r.Method == "DELETE":
+		s.crudDelete(w, r, resource, key)
+	}
+}
+
+// GET /resource?column=value&order=-column&limit=10&offset=20
+func (s *Server) crudList(w http.ResponseWriter, r *http.Request, resource *crudResource) {
+	table := resource.table
+	query := "SELECT * FROM " + quoteIdent(table.Name)
+
+	queryParams := extractQueryParams(r)
+	names := make([]string, 0, len(queryParams))
+	for name := range queryParams {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Keep the generated SQL stable
+
+	var conditions, order []string
+	var params []interface{}
+	for _, name := range names {
+		value := queryParams[name]
+		switch name {
+		case "limit", "offset":
+			continue
+		case "order":
+			for _, column := range splitList(value) {
+				direction := "ASC"
+				if strings.HasPrefix(column, "-") {
+					column, direction = column[1:], "DESC"
+				}
+				if !table.hasColumn(column) {
+					sendErrorResponse(w, fmt.Sprintf("Unknown column: %s", column), http.StatusBadRequest)
+					return
+				}
+				order = append(order, quoteIdent(column)+" "+direction)
+			}
+		default:
+			if !table.hasColumn(name) {
+				sendErrorResponse(w, fmt.Sprintf("Unknown column: %s", name), http.StatusBadRequest)
+				return
+			}
+			conditions = append(conditions, quoteIdent(name)+" = ?")
+			params = append(params, value)
+		}
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if len(order) > 0 {
+		query += " ORDER BY " + strings.Join(order, ", ")
+	}
+	limit, err := parseCount(queryParams["limit"], -1)
+	if err != nil {
+		sendErrorResponse(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	offset, err := parseCount(queryParams["offset"], 0)
+	if err != nil {
+		sendErrorResponse(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case limit >= 0:
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	case offset > 0 && s.dbType == "postgres":
+		query += fmt.Sprintf(" OFFSET %d", offset)
+	case offset > 0:
+		query += fmt.Sprintf(" LIMIT -1 OFFSET %d", offset)
+	}
+
+	result, err := s.runQuery(r.Context(), query, params, s.types, s.maxRows)
+	if err != nil {
+		sendErrorResponse(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	rows := result.maps()
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	if result.Truncated {
+		w.Header().Set("X-Result-Truncated", "true")
+	}
+	requestInfoFrom(r.Context()).noteRows(int64(len(rows)))
+	s.sendJSONResponse(w, rows, http.StatusOK)
+}
+
+// Parse a non-negative count from a query parameter, with a default when it is absent
+func parseCount(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid count: %s", value)
+	}
+	return n, nil
+}
+
+// GET /resource/{key}
+func (s *Server) crudGet(w http.ResponseWriter, r *http.Request, resource *crudResource, key string) {
+	condition, params, err := resource.keyCondition(key)
+	if err != nil {
+		sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := s.executeQuery(r.Context(), "SELECT * FROM "+quoteIdent(resource.table.Name)+" WHERE "+condition, params)
+	if err != nil {
+		sendErrorResponse(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if len(result) == 0 {
+		sendErrorResponse(w, "Not found", http.StatusNotFound)
+		return
+	}
+	requestInfoFrom(r.Context()).noteRows(int64(len(result)))
+	s.sendJSONResponse(w, result[0], http.StatusOK)
+}
+
+// Read the request body as a row, rejecting unknown columns. The filename, MIME type and size
+// of uploaded files are dropped unless the table has columns for them.
+func (s *Server) readRowBody(w http.ResponseWriter, r *http.Request, table TableInfo) (map[string]interface{}, error) {
+	body, err := extractBodyParams(w, r, s.maxBodyBytes)
+	if err != nil {
+		return nil, err
+	}
+	for name := range body {
+		if table.hasColumn(name) {
+			continue
+		}
+		if isUploadMetadata(body, name) {
+			delete(body, name)
+			continue
+		}
+		return nil, fmt.Errorf("unknown column: %s", name)
+	}
+	return body, nil
+}
+
+// Check whether a body param describes an uploaded file in another param
+func isUploadMetadata(body map[string]interface{}, name string) bool {
+	for _, suffix := range []string{"_filename", "_mimetype", "_size"} {
+		if field, ok := strings.CutSuffix(name, suffix); ok {
+			if _, isFile := body[field].([]byte); isFile {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// POST /resource
+func (s *Server) crudCreate(w http.ResponseWriter, r *http.Request, resource *crudResource) {
+	body, err := s.readRowBody(w, r, resource.table)
+	if err != nil {
+		sendBodyError(w, err)
+		return
+	}
+
+	query := "INSERT INTO " + quoteIdent(resource.table.Name)
+	var params []interface{}
+	if len(body) == 0 {
+		query += " DEFAULT VALUES"
+	} else {
+		var columns, placeholders []string
+		for _, column := range resource.table.Columns {
+			if value, ok := body[column.Name]; ok {
+				columns = append(columns, quoteIdent(column.Name))
+				placeholders = append(placeholders, "?")
+				params = append(params, sqlValue(value))
+			}
+		}
+		query += " (" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+	}
+	query += " RETURNING *"
+
+	result, err := s.executeQuery(r.Context(), query, params)
+	if err != nil {
+		sendErrorResponse(w, fmt.Sprintf("Database error: %v", err), http.StatusBadRequest)
+		return
+	}
+	var created interface{}
+	if len(result) > 0 {
+		created = result[0]
+	}
+	requestInfoFrom(r.Context()).noteRows(int64(len(result)))
+	s.sendJSONResponse(w, created, http.StatusCreated)
+}
+
+// PATCH /resource/{key} updates the given columns; PUT /resource/{key} replaces every non-key column
+func (s *Server) crudUpdate(w http.ResponseWriter, r *http.Request, resource *crudResource, key string) {
+	condition, keyParams, err := resource.keyCondition(key)
+	if err != nil {
+		sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := s.readRowBody(w, r, resource.table)
+	if err != nil {
+		sendBodyError(w, err)
+		return
+	}
+
+	var assignments []string
+	var params []interface{}
+	for _, column := range resource.table.Columns {
+		value, ok := body[column.Name]
+		if r.Method == "PUT" && !column.PrimaryKey {
+			ok = true // Missing columns are set to NULL
+		}
+		if ok {
+			assignments = append(assignments, quoteIdent(column.Name)+" = ?")
+			params = append(params, sqlValue(value))
+		}
+	}
+	if len(assignments) == 0 {
+		sendErrorResponse(w, "No columns to update", http.StatusBadRequest)
+		return
+	}
+
+	query := "UPDATE " + quoteIdent(resource.table.Name) + " SET " + strings.Join(assignments, ", ") +
+		" WHERE " + condition + " RETURNING *"
+	result, err := s.executeQuery(r.Context(), query, append(params, keyParams...))
+	if err != nil {
+		sendErrorResponse(w, fmt.Sprintf("Database error: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(result) == 0 {
+		sendErrorResponse(w, "Not found", http.StatusNotFound)
+		return
+	}
+	requestInfoFrom(r.Context()).noteRows(int64(len(result)))
+	s.sendJSONResponse(w, result[0], http.StatusOK)
+}
+
+// DELETE /resource/{key}
+func (s *Server) crudDelete(w http.ResponseWriter, r *http.Request, resource *crudResource, key string) {
+	condition, params, err := resource.keyCondition(key)
+	if err != nil {
+		sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := s.executeQuery(r.Context(), "DELETE FROM "+quoteIdent(resource.table.Name)+" WHERE "+condition+" RETURNING *", params)
+	if err != nil {
+		sendErrorResponse(w, fmt.Sprintf("Database error: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(result) == 0 {
+		sendErrorResponse(w, "Not found", http.StatusNotFound)
+		return
+	}
+	requestInfoFrom(r.Context()).noteRows(int64(len(result)))
+	w.WriteHeader(http.StatusNoContent)
+}
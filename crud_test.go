@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// A server exposing every table of setupSQL as a CRUD resource under /api
+func newCRUDTestServer(t *testing.T, setupSQL string) *Server {
+	t.Helper()
+	s := newTestServer(t, setupSQL)
+	s.apiDesc = &APIDescription{BasePath: "/api", CRUD: &CRUDConfig{}}
+	if err := s.setupCRUD(); err != nil {
+		t.Fatalf("setupCRUD: %v", err)
+	}
+	return s
+}
+
+func TestCRUDKeys(t *testing.T) {
+	s := newCRUDTestServer(t, `
+		CREATE TABLE tags (name TEXT PRIMARY KEY, color TEXT);
+		CREATE TABLE lines (doc TEXT, line INTEGER, text TEXT, PRIMARY KEY (doc, line));
+		INSERT INTO tags VALUES ('red,green', 'mixed'), ('a/b', 'slash'), ('50%', 'half'), ('plain', 'plain');
+		INSERT INTO lines VALUES ('notes, draft', 1, 'first'), ('notes', 2, 'second');`)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		want   map[string]interface{}
+	}{
+		{"plain key", "/api/tags/plain", http.StatusOK, map[string]interface{}{"name": "plain", "color": "plain"}},
+		{"encoded comma", "/api/tags/red%2Cgreen", http.StatusOK, map[string]interface{}{"name": "red,green", "color": "mixed"}},
+		{"encoded slash", "/api/tags/a%2Fb", http.StatusOK, map[string]interface{}{"name": "a/b", "color": "slash"}},
+		{"encoded percent", "/api/tags/50%25", http.StatusOK, map[string]interface{}{"name": "50%", "color": "half"}},
+		{"unencoded comma splits", "/api/tags/red,green", http.StatusBadRequest, nil},
+		{"composite", "/api/lines/notes,2", http.StatusOK, map[string]interface{}{"doc": "notes", "line": float64(2), "text": "second"}},
+		{"composite with encoded comma", "/api/lines/notes%2C%20draft,1", http.StatusOK,
+			map[string]interface{}{"doc": "notes, draft", "line": float64(1), "text": "first"}},
+		{"composite with too few values", "/api/lines/notes", http.StatusBadRequest, nil},
+		{"missing row", "/api/tags/blue", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveTest(s, http.HandlerFunc(s.handleAPI), "GET", tt.target, "")
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.want == nil {
+				return
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("response %q: %v", w.Body, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("row = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Updates and deletes address rows the same way
+	if w := serveTest(s, http.HandlerFunc(s.handleAPI), "PATCH", "/api/tags/red%2Cgreen", `{"color": "brown"}`); w.Code != http.StatusOK {
+		t.Fatalf("PATCH: status %d: %s", w.Code, w.Body)
+	}
+	if n := queryInt(t, s, "SELECT count(*) FROM tags WHERE name = 'red,green' AND color = 'brown'"); n != 1 {
+		t.Error("PATCH didn't update the row with a comma in its key")
+	}
+	if w := serveTest(s, http.HandlerFunc(s.handleAPI), "DELETE", "/api/lines/notes%2C%20draft,1", ""); w.Code >= 300 {
+		t.Fatalf("DELETE: status %d: %s", w.Code, w.Body)
+	}
+	if n := queryInt(t, s, "SELECT count(*) FROM lines"); n != 1 {
+		t.Errorf("%d lines after DELETE, want 1", n)
+	}
+}
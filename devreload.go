@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Development Live Reload =====
+
+// Paths of the reload event stream and the script that listens to it
+const (
+	devReloadPath = "/__dev/reload"
+	devScriptPath = "/__dev/reload.js"
+)
+
+// How often the watched files are checked for changes
+const devPollInterval = 500 * time.Millisecond
+
+// Static files that reload the page when they change. Other files, like logs written
+// into the static root, are ignored.
+var devWatchExtensions = []string{
+	".html", ".htm", ".xmlui", ".xs", ".js", ".mjs", ".css", ".json", ".md",
+	".svg", ".png", ".jpg", ".jpeg", ".gif", ".webp", ".ico", ".woff", ".woff2",
+}
+
+// Loaded by every HTML page in --dev mode: reloads the page when the server says files changed,
+// and once more when the server comes back after restarting for an API description change
+const devReloadScript = `(function () {
+  var restarting = false;
+  var source = new EventSource(%q);
+  source.addEventListener("reload", function () { location.reload(); });
+  source.addEventListener("restart", function () { restarting = true; });
+  source.onopen = function () { if (restarting) location.reload(); };
+})();
+`
+
+// Watches the static root, the API description and its SQL files, and tells browsers when they change
+type devReloader struct {
+	staticRoot  string
+	skip        func(name string) bool // Static files that aren't served, like the database, by their path relative to the root
+	apiDescPath string
+	sqlFiles    []string
+
+	mu      sync.Mutex
+	clients map[chan string]bool
+}
+
+func newDevReloader(static *staticHandler, apiDescPath string, sqlFiles []string) *devReloader {
+	return &devReloader{
+		staticRoot:  static.root,
+		skip:        static.denied,
+		apiDescPath: apiDescPath,
+		sqlFiles:    sqlFiles,
+		clients:     make(map[chan string]bool),
+	}
+}
+
+// SQL files the API description's methods read, resolved like methodSQL does
+func (s *Server) apiSQLFiles() []string {
+	if s.apiDesc == nil {
+		return nil
+	}
+	var files []string
+	var collect func(methods map[string]MethodDefinition)
+	collect = func(methods map[string]MethodDefinition) {
+		for _, def := range methods {
+			if def.SQLFile != "" {
+				files = append(files, filepath.Join(filepath.Dir(s.apiDescPath), def.SQLFile))
+			}
+			collect(def.Nested)
+		}
+	}
+	for _, endpoint := range s.apiDesc.Endpoints {
+		collect(endpoint.Methods)
+	}
+	return files
+}
+
+// Modification time and size of every watched file
+func (d *devReloader) snapshot() map[string]string {
+	files := make(map[string]string)
+	stamp := func(info fs.FileInfo) string {
+		return fmt.Sprintf("%d|%d", info.ModTime().UnixNano(), info.Size())
+	}
+	filepath.WalkDir(d.staticRoot, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path == d.staticRoot {
+			return nil
+		}
+		rel, err := filepath.Rel(d.staticRoot, path)
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if d.skip(filepath.ToSlash(rel)) || entry.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.skip(filepath.ToSlash(rel)) || !containsString(devWatchExtensions, strings.ToLower(filepath.Ext(path))) {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			files[path] = stamp(info)
+		}
+		return nil
+	})
+	for _, file := range append([]string{d.apiDescPath}, d.sqlFiles...) {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			files[file] = stamp(info)
+		}
+	}
+	return files
+}
+
+// Poll for changes; browsers reload on any change, and the server restarts when the API description changes
+func (d *devReloader) watch() {
+	previous := d.snapshot()
+	for range time.Tick(devPollInterval) {
+		current := d.snapshot()
+		var changed []string
+		for file, stamp := range current {
+			if previous[file] != stamp {
+				changed = append(changed, file)
+			}
+		}
+		for file := range previous {
+			if _, ok := current[file]; !ok {
+				changed = append(changed, file)
+			}
+		}
+		previous = current
+		if len(changed) == 0 {
+			continue
+		}
+		sort.Strings(changed)
+		log.Printf("Dev: changed %s", strings.Join(changed, ", "))
+
+		if d.apiDescPath != "" && containsString(changed, d.apiDescPath) && canRestart {
+			if _, err := loadAPIDescription(d.apiDescPath); err != nil {
+				log.Printf("Warning: not restarting for the changed API description: %v", err)
+				continue
+			}
+			d.broadcast("restart")
+			time.Sleep(100 * time.Millisecond) // Let the event reach the browsers
+			restartServer()
+			continue
+		}
+		d.broadcast("reload")
+	}
+}
+
+func (d *devReloader) broadcast(event string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for client := range d.clients {
+		select {
+		case client <- event:
+		default:
+		}
+	}
+}
+
+// GET /__dev/reload: a server-sent event stream of "reload" and "restart" events
+func (d *devReloader) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendErrorResponse(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(w, "retry: 500\n\n")
+	flusher.Flush()
+
+	client := make(chan string, 1)
+	d.mu.Lock()
+	d.clients[client] = true
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.clients, client)
+		d.mu.Unlock()
+	}()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event := <-client:
+			fmt.Fprintf(w, "event: %s\ndata: {}\n\n", event)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// GET /__dev/reload.js
+func (d *devReloader) handleScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, devReloadScript, devReloadPath)
+}
+
+// Add the reload script to an HTML page, before </body> when it has one
+func injectReloadScript(page []byte) []byte {
+	tag := []byte(`<script src="` + devScriptPath + `"></script>`)
+	if i := bytes.LastIndex(bytes.ToLower(page), []byte("</body>")); i >= 0 {
+		return append(append(append([]byte{}, page[:i]...), tag...), page[i:]...)
+	}
+	return append(append([]byte{}, page...), tag...)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInjectReloadScript(t *testing.T) {
+	tag := `<script src="` + devScriptPath + `"></script>`
+	tests := []struct {
+		name string
+		page string
+		want string
+	}{
+		{"before body end", "<html><body><p>hi</p></body></html>", "<html><body><p>hi</p>" + tag + "</body></html>"},
+		{"uppercase tag", "<HTML><BODY>x</BODY></HTML>", "<HTML><BODY>x" + tag + "</BODY></HTML>"},
+		{"last body end", "<body><pre>&lt;/body&gt; </body></pre></body>", "<body><pre>&lt;/body&gt; </body></pre>" + tag + "</body>"},
+		{"no body", "<p>fragment</p>", "<p>fragment</p>" + tag},
+		{"empty", "", tag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := []byte(tt.page)
+			if got := string(injectReloadScript(page)); got != tt.want {
+				t.Errorf("injectReloadScript = %q, want %q", got, tt.want)
+			}
+			if string(page) != tt.page {
+				t.Error("the original page was changed")
+			}
+		})
+	}
+}
+
+func TestDevModeStaticPages(t *testing.T) {
+	h := newTestStaticHandler(t, StaticConfig{DevReload: true, SPAFallback: true}, map[string]string{
+		"index.html":    "<html><body>app</body></html>",
+		"index.html.gz": "compressed",
+		"app.js":        "js",
+	})
+	tag := `<script src="` + devScriptPath + `"></script>`
+
+	tests := []struct {
+		path   string
+		inject bool
+	}{
+		{"/", true},
+		{"/clients/42", true}, // SPA fallback
+		{"/app.js", false},
+	}
+	for _, tt := range tests {
+		w := getStatic(h, tt.path, "Accept-Encoding", "gzip", "Accept", "text/html")
+		if got := strings.Contains(w.Body.String(), tag); got != tt.inject {
+			t.Errorf("GET %s: script injected %v, want %v: %q", tt.path, got, tt.inject, w.Body)
+		}
+		if tt.inject && w.Header().Get("Content-Encoding") != "" {
+			t.Errorf("GET %s: served the compressed page, which can't carry the script", tt.path)
+		}
+		if w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("GET %s: Cache-Control %q, want no-store", tt.path, w.Header().Get("Cache-Control"))
+		}
+	}
+}
+
+func TestDevReloaderSnapshot(t *testing.T) {
+	root := t.TempDir()
+	h := newTestStaticHandler(t, StaticConfig{Root: root, DenyFiles: []string{filepath.Join(root, "api.json")}}, map[string]string{
+		"index.html":                "x",
+		"js/app.js":                 "x",
+		"api.json":                  "{}",
+		"data.db":                   "x",
+		"server.log":                "x",
+		".git/HEAD":                 "x",
+		"node_modules/lib/index.js": "x",
+		"migrations/0001_a.up.sql":  "x",
+	})
+	sqlFile := filepath.Join(t.TempDir(), "clients.sql")
+	writeFiles(t, filepath.Dir(sqlFile), map[string]string{"clients.sql": "SELECT 1"})
+
+	d := newDevReloader(h, filepath.Join(root, "api.json"), []string{sqlFile, filepath.Join(root, "missing.sql")})
+	var got []string
+	for file := range d.snapshot() {
+		if rel, err := filepath.Rel(root, file); err == nil && !strings.HasPrefix(rel, "..") {
+			file = filepath.ToSlash(rel)
+		}
+		got = append(got, file)
+	}
+	sort.Strings(got)
+	// The API description is watched although it isn't served
+	want := []string{sqlFile, "api.json", "index.html", "js/app.js"}
+	sort.Strings(want)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("watched files = %v, want %v", got, want)
+	}
+}
+
+func TestDevReloaderEvents(t *testing.T) {
+	h := newTestStaticHandler(t, StaticConfig{}, nil)
+	d := newDevReloader(h, "", nil)
+	server := httptest.NewServer(http.HandlerFunc(d.handleEvents))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type %q, want text/event-stream", ct)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || lines.Text() != "retry: 500" {
+		t.Fatalf("first line %q, want the retry interval", lines.Text())
+	}
+	// The client is registered once the stream has started; wait for it before broadcasting
+	for i := 0; i < 100; i++ {
+		d.mu.Lock()
+		registered := len(d.clients)
+		d.mu.Unlock()
+		if registered == 1 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	d.broadcast("reload")
+	for lines.Scan() {
+		if lines.Text() == "event: reload" {
+			return
+		}
+	}
+	t.Errorf("no reload event received: %v", lines.Err())
+}
+
+func TestDevReloadScript(t *testing.T) {
+	d := newDevReloader(newTestStaticHandler(t, StaticConfig{}, nil), "", nil)
+	w := httptest.NewRecorder()
+	d.handleScript(w, httptest.NewRequest("GET", devScriptPath, nil))
+	if !strings.Contains(w.Body.String(), `new EventSource("`+devReloadPath+`")`) {
+		t.Errorf("script doesn't listen on %s: %s", devReloadPath, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/javascript") {
+		t.Errorf("Content-Type %q", ct)
+	}
+}
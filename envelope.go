@@ -0,0 +1,63 @@
+package main
+
+import "time"
+
+// ===== Response Envelope =====
+
+// Result formats for /query and API methods
+const (
+	formatObjects  = "objects"  // A plain array of row objects
+	formatEnvelope = "envelope" // An Envelope with row objects
+	formatArrays   = "arrays"   // An Envelope with rows as arrays in column order
+)
+
+var resultFormats = []string{formatObjects, formatEnvelope, formatArrays}
+
+// Envelope wraps query rows with column metadata and timings
+type Envelope struct {
+	Columns         []EnvelopeColumn `json:"columns"`
+	Rows            interface{}      `json:"rows"`
+	RowCount        int              `json:"rowCount"`
+	Truncated       bool             `json:"truncated"`
+	QueryDurationMs float64          `json:"queryDurationMs"`
+	TotalDurationMs float64          `json:"totalDurationMs"`
+}
+
+// EnvelopeColumn describes a result column, in select order
+type EnvelopeColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // Database type name; empty when the driver doesn't know it
+}
+
+// Build an envelope; rows holds the result as maps, which may carry nested results
+func newEnvelope(result *queryResult, rows []map[string]interface{}, format string, start time.Time) Envelope {
+	envelope := Envelope{
+		Columns:         make([]EnvelopeColumn, len(result.Columns)),
+		RowCount:        len(result.Rows),
+		Truncated:       result.Truncated,
+		QueryDurationMs: milliseconds(result.Duration),
+	}
+	for i, name := range result.Columns {
+		envelope.Columns[i] = EnvelopeColumn{Name: name, Type: result.Types[i]}
+	}
+
+	if format == formatArrays {
+		values := result.Rows
+		if values == nil {
+			values = [][]interface{}{}
+		}
+		envelope.Rows = values
+	} else {
+		if rows == nil {
+			rows = []map[string]interface{}{}
+		}
+		envelope.Rows = rows
+	}
+
+	envelope.TotalDurationMs = milliseconds(time.Since(start))
+	return envelope
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewEnvelope(t *testing.T) {
+	result := &queryResult{
+		Columns:   []string{"id", "name"},
+		Types:     []string{"INTEGER", ""},
+		Rows:      [][]interface{}{{int64(1), "Acme"}},
+		Truncated: true,
+		Duration:  1500 * time.Microsecond,
+	}
+	rows := result.maps()
+
+	envelope := newEnvelope(result, rows, formatEnvelope, time.Now().Add(-3*time.Millisecond))
+	wantColumns := []EnvelopeColumn{{Name: "id", Type: "INTEGER"}, {Name: "name", Type: ""}}
+	if !reflect.DeepEqual(envelope.Columns, wantColumns) {
+		t.Errorf("columns = %+v, want %+v", envelope.Columns, wantColumns)
+	}
+	if envelope.RowCount != 1 || !envelope.Truncated || envelope.QueryDurationMs != 1.5 {
+		t.Errorf("envelope = %+v, want 1 truncated row and a 1.5 ms query", envelope)
+	}
+	if envelope.TotalDurationMs < 3 {
+		t.Errorf("total duration %v ms, want at least 3", envelope.TotalDurationMs)
+	}
+	if !reflect.DeepEqual(envelope.Rows, rows) {
+		t.Errorf("rows = %v, want the row objects", envelope.Rows)
+	}
+
+	arrays := newEnvelope(result, rows, formatArrays, time.Now())
+	if !reflect.DeepEqual(arrays.Rows, result.Rows) {
+		t.Errorf("arrays rows = %v, want %v", arrays.Rows, result.Rows)
+	}
+
+	// No rows encode as [], never null
+	empty := &queryResult{Columns: []string{"id"}, Types: []string{"INTEGER"}}
+	for _, format := range []string{formatEnvelope, formatArrays} {
+		encoded, err := json.Marshal(newEnvelope(empty, empty.maps(), format, time.Now()).Rows)
+		if err != nil || string(encoded) != "[]" {
+			t.Errorf("%s: empty rows encode as %s (%v), want []", format, encoded, err)
+		}
+	}
+}
+
+func TestQueryFormats(t *testing.T) {
+	s := newTestServer(t, "CREATE TABLE t (id INTEGER, name TEXT); INSERT INTO t VALUES (1, 'a'), (2, 'b');")
+
+	tests := []struct {
+		format   string
+		wantRows string
+	}{
+		{"", `[{"id":1,"name":"a"},{"id":2,"name":"b"}]`},
+		{formatObjects, `[{"id":1,"name":"a"},{"id":2,"name":"b"}]`},
+		{formatEnvelope, `[{"id":1,"name":"a"},{"id":2,"name":"b"}]`},
+		{formatArrays, `[[1,"a"],[2,"b"]]`},
+	}
+	for _, tt := range tests {
+		t.Run("format "+tt.format, func(t *testing.T) {
+			body := `{"sql": "SELECT id, name FROM t ORDER BY id", "maxRows": 5, "format": "` + tt.format + `"}`
+			w := serveTest(s, http.HandlerFunc(s.handleQuery), "POST", "/query", body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			if tt.format == "" || tt.format == formatObjects {
+				if got := compactJSON(t, w.Body.Bytes()); got != tt.wantRows {
+					t.Errorf("response %s, want %s", got, tt.wantRows)
+				}
+				return
+			}
+			var envelope struct {
+				Columns  []EnvelopeColumn `json:"columns"`
+				Rows     json.RawMessage  `json:"rows"`
+				RowCount int              `json:"rowCount"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+				t.Fatal(err)
+			}
+			if got := compactJSON(t, envelope.Rows); got != tt.wantRows {
+				t.Errorf("rows %s, want %s", got, tt.wantRows)
+			}
+			if envelope.RowCount != 2 || len(envelope.Columns) != 2 || envelope.Columns[0] != (EnvelopeColumn{Name: "id", Type: "INTEGER"}) {
+				t.Errorf("envelope %s", w.Body)
+			}
+		})
+	}
+
+	if w := serveTest(s, http.HandlerFunc(s.handleQuery), "POST", "/query", `{"sql": "SELECT 1", "format": "table"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+// Re-encode JSON without insignificant whitespace
+func compactJSON(t *testing.T, data []byte) string {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ===== SQLite Extensions =====
+
+// A loadable SQLite extension and the function that initializes it
+type SQLiteExtension struct {
+	Path       string
+	EntryPoint string // Empty for SQLite's default: sqlite3_extension_init, then sqlite3_<name>_init
+}
+
+func (e SQLiteExtension) String() string {
+	if e.EntryPoint == "" {
+		return e.Path
+	}
+	return e.Path + ":" + e.EntryPoint
+}
+
+// Extensions to load into every SQLite connection
+type ExtensionConfig struct {
+	Extensions []SQLiteExtension
+	Required   bool              // Refuse connections whose extensions fail to load
+	Steampipe  *SteampipeConfig  // Overrides the API description's Steampipe settings
+	Attach     map[string]string // Database files attached to every connection, by schema name
+}
+
+// In-memory database attached to every SQLite connection, for extensions to keep tables in
+const extensionMemorySchema = "extension_mem"
+
+// An entry point is a C identifier, which keeps a Windows drive letter from being taken for one
+var entryPointPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Parse a comma-separated list of extensions, each a path optionally followed by :entry_point
+func parseExtensions(value string) []SQLiteExtension {
+	var extensions []SQLiteExtension
+	for _, item := range splitList(value) {
+		extension := SQLiteExtension{Path: item}
+		if i := strings.LastIndex(item, ":"); i > 1 && entryPointPattern.MatchString(item[i+1:]) {
+			extension = SQLiteExtension{Path: item[:i], EntryPoint: item[i+1:]}
+		}
+		if absPath, err := filepath.Abs(extension.Path); err == nil {
+			extension.Path = absPath
+		}
+		extensions = append(extensions, extension)
+	}
+	return extensions
+}
+
+// Entry points to try, in order. go-sqlite3 always passes one, so SQLite's own
+// fallback from the file name is repeated here.
+func (e SQLiteExtension) entryPoints() []string {
+	if e.EntryPoint != "" {
+		return []string{e.EntryPoint}
+	}
+	name := strings.TrimPrefix(filepath.Base(e.Path), "lib")
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+	return []string{"sqlite3_extension_init", "sqlite3_" + name + "_init"}
+}
+
+func (e SQLiteExtension) load(conn *sqlite3.SQLiteConn) error {
+	var err error
+	for _, entryPoint := range e.entryPoints() {
+		if err = conn.LoadExtension(e.Path, entryPoint); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Each set of extensions and attached databases needs its own registered driver
+var extensionDrivers int32
+
+// Open a SQLite database whose every connection attaches the extension memory database and
+// the attach databases, then loads the extensions and configures the Steampipe plugins among
+// them. ATTACH only affects the connection it runs on, so it belongs here too: a pooled
+// connection opened later would otherwise miss the schemas. An extension failure refuses the
+// connection when required, and is only logged otherwise; a failed attach is only logged.
+func openSQLite(dsn string, extensions []SQLiteExtension, required bool, steampipe *steampipeSetup, attach map[string]string) (*sql.DB, error) {
+	schemas := make([]string, 0, len(attach))
+	for schema := range attach {
+		schemas = append(schemas, schema)
+	}
+	sort.Strings(schemas)
+
+	driverName := fmt.Sprintf("sqlite3_extensions_%d", atomic.AddInt32(&extensionDrivers, 1))
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if _, err := conn.Exec("ATTACH DATABASE ':memory:' AS "+extensionMemorySchema, nil); err != nil {
+				log.Printf("Warning: failed to attach memory database: %v", err)
+			}
+			for _, schema := range schemas {
+				if _, err := conn.Exec("ATTACH DATABASE ? AS "+quoteIdent(schema), []driver.Value{attach[schema]}); err != nil {
+					log.Printf("Warning: failed to attach %s: %v", schema, err)
+				}
+			}
+
+			for _, extension := range extensions {
+				err := extension.load(conn)
+				if err == nil {
+					err = steampipe.configure(conn, extension)
+				}
+				if err != nil {
+					if required {
+						return fmt.Errorf("failed to load extension %s: %w", extension, err)
+					}
+					log.Printf("Warning: failed to load extension %s: %v", extension, err)
+					continue
+				}
+				slog.Debug("Extension loaded", "extension", extension.String())
+			}
+			return nil
+		},
+	})
+	return sql.Open(driverName, dsn)
+}
+
+func joinExtensions(extensions []SQLiteExtension) string {
+	names := make([]string, len(extensions))
+	for i, extension := range extensions {
+		names[i] = extension.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+func extensionPaths(extensions []SQLiteExtension) []string {
+	paths := make([]string, len(extensions))
+	for i, extension := range extensions {
+		paths[i] = extension.Path
+	}
+	return paths
+}
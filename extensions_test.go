@@ -0,0 +1,36 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestAttachOnEveryConnection(t *testing.T) {
+	dir := t.TempDir()
+	other, err := sql.Open("sqlite3", filepath.Join(dir, "other.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Exec("CREATE TABLE entries (id INTEGER); INSERT INTO entries VALUES (1), (2)"); err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+
+	server, err := NewServer(filepath.Join(dir, "test.db"), PostgresConfig{}, ExtensionConfig{
+		Attach: map[string]string{"other": filepath.Join(dir, "other.db")},
+	}, "", false)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer server.db.Close()
+
+	// Without idle connections every query runs on a new one
+	server.db.SetMaxIdleConns(0)
+	for i := 0; i < 3; i++ {
+		if n := queryInt(t, server, "SELECT count(*) FROM other.entries"); n != 2 {
+			t.Errorf("connection %d: %d rows in the attached database, want 2", i, n)
+		}
+		queryInt(t, server, "SELECT count(*) FROM "+extensionMemorySchema+".sqlite_master")
+	}
+}
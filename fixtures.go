@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ===== Fixtures and Reset =====
+
+// Fixture files are loaded in filename order. <table>.json holds an array of row objects,
+// <table>.csv a header row followed by data rows (empty cells are NULL), and *.sql is executed
+// as is. A numeric prefix such as 01_clients.json controls ordering and is not part of the table name.
+var fixturePrefixRegexp = regexp.MustCompile(`^\d+[_-]`)
+
+type fixtureState struct {
+	dir    string
+	tables []string // Tables populated from JSON/CSV files, in load order
+}
+
+// Quote an identifier for use in SQL
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Load every fixture file in dir, replacing the contents of the tables they populate
+func (s *Server) loadFixtures(dir string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadFixturesLocked(dir, nil)
+}
+
+// Load the fixtures in one transaction, after emptying the truncate tables in it (Postgres)
+func (s *Server) loadFixturesLocked(dir string, truncate []string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read fixtures directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(truncate) > 0 {
+		quoted := make([]string, len(truncate))
+		for i, table := range truncate {
+			quoted[i] = quoteIdent(table)
+		}
+		if _, err := tx.Exec("TRUNCATE " + strings.Join(quoted, ", ") + " RESTART IDENTITY CASCADE"); err != nil {
+			return fmt.Errorf("failed to truncate fixture tables: %w", err)
+		}
+	}
+
+	state := &fixtureState{dir: dir}
+	for _, name := range names {
+		filePath := filepath.Join(dir, name)
+		ext := strings.ToLower(filepath.Ext(name))
+		table := fixturePrefixRegexp.ReplaceAllString(strings.TrimSuffix(name, filepath.Ext(name)), "")
+
+		var columns []string
+		var rows [][]interface{}
+		switch ext {
+		case ".sql":
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				return err
+			}
+			log.Printf("Loading fixture script: %s", name)
+			if _, err := tx.Exec(string(data)); err != nil {
+				return fmt.Errorf("fixture %s: %w", name, err)
+			}
+			continue
+		case ".json":
+			columns, rows, err = readJSONFixture(filePath)
+		case ".csv":
+			columns, rows, err = readCSVFixture(filePath)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("fixture %s: %w", name, err)
+		}
+
+		log.Printf("Loading fixture: %s (%d rows into %s)", name, len(rows), table)
+		if _, err := tx.Exec("DELETE FROM " + quoteIdent(table)); err != nil {
+			return fmt.Errorf("fixture %s: %w", name, err)
+		}
+		if err := s.insertRows(tx, table, columns, rows); err != nil {
+			return fmt.Errorf("fixture %s: %w", name, err)
+		}
+		state.tables = append(state.tables, table)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.fixtures = state
+	return nil
+}
+
+// Insert rows into a table, one prepared statement for all of them
+func (s *Server) insertRows(tx *sql.Tx, table string, columns []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdent(column)
+		placeholders[i] = s.bindVar(i + 1)
+	}
+	stmt, err := tx.Prepare(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quoteIdent(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		if _, err := stmt.Exec(row...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read a JSON array of objects; the columns are the union of all keys
+func readJSONFixture(filePath string) ([]string, [][]interface{}, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Keep numbers as written, so large integers don't lose precision as floats
+	var records []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&records); err != nil {
+		return nil, nil, fmt.Errorf("expected a JSON array of objects: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var columns []string
+	for _, record := range records {
+		for key := range record {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+	sort.Strings(columns)
+
+	rows := make([][]interface{}, len(records))
+	for i, record := range records {
+		row := make([]interface{}, len(columns))
+		for j, column := range columns {
+			value := record[column]
+			switch v := value.(type) {
+			case map[string]interface{}, []interface{}:
+				// Nested values are stored as JSON text
+				encoded, err := json.Marshal(value)
+				if err != nil {
+					return nil, nil, err
+				}
+				value = string(encoded)
+			case json.Number:
+				value = fixtureNumber(v)
+			}
+			row[j] = value
+		}
+		rows[i] = row
+	}
+	return columns, rows, nil
+}
+
+// Convert a JSON number to an int64 when it is an integer that fits, otherwise to a float64.
+// Integers too large for an int64 are kept as text rather than rounded.
+func fixtureNumber(n json.Number) interface{} {
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if !strings.ContainsAny(string(n), ".eE") {
+		return string(n)
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return string(n)
+}
+
+// Read a CSV file with a header row
+func readCSVFixture(filePath string) ([]string, [][]interface{}, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("missing header row")
+	}
+
+	columns := records[0]
+	var rows [][]interface{}
+	for _, record := range records[1:] {
+		row := make([]interface{}, len(columns))
+		for j := range columns {
+			if j < len(record) && record[j] != "" {
+				row[j] = record[j]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, nil
+}
+
+// Keep an in-memory copy of the database as it is now, for fast resets (SQLite only)
+func (s *Server) capturePristine() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dbType != "sqlite" {
+		return nil
+	}
+	if s.pristine == nil {
+		memDB, err := openMemoryDatabase()
+		if err != nil {
+			return err
+		}
+		s.pristine = memDB
+	}
+	return copySQLiteDatabase(s.pristine, s.db)
+}
+
+// Reset the database to its fixture state
+func (s *Server) resetDatabase() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// SQLite: restore the pristine copy in one backup step
+	if s.pristine != nil {
+		return s.keepingAuditLog(func() error {
+			return copySQLiteDatabase(s.db, s.pristine)
+		})
+	}
+
+	if s.fixtures == nil {
+		return fmt.Errorf("no fixtures loaded")
+	}
+
+	// Postgres: truncate the fixture tables and reload every fixture, all in one transaction
+	var truncate []string
+	if s.dbType == "postgres" {
+		truncate = s.fixtures.tables
+	}
+	return s.loadFixturesLocked(s.fixtures.dir, truncate)
+}
+
+// Handle POST /admin/reset
+func (s *Server) handleReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		sendErrorResponse(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	start := time.Now()
+	if err := s.resetDatabase(); err != nil {
+		sendErrorResponse(w, fmt.Sprintf("Reset failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.sendJSONResponse(w, map[string]interface{}{
+		"status":     "reset",
+		"durationMs": time.Since(start).Milliseconds(),
+	}, http.StatusOK)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+const fixtureSchema = `
+	CREATE TABLE clients (id INTEGER PRIMARY KEY, name TEXT, balance, tags TEXT, note TEXT);
+	CREATE TABLE orders (id INTEGER PRIMARY KEY, client_id INTEGER, total REAL);`
+
+// Write fixture files to a new directory
+func writeFixtures(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+	return dir
+}
+
+func TestLoadFixtures(t *testing.T) {
+	s := newTestServer(t, fixtureSchema+`
+		INSERT INTO clients (id, name) VALUES (99, 'stale');
+		INSERT INTO orders (id, client_id, total) VALUES (99, 99, 1);`)
+	dir := writeFixtures(t, map[string]string{
+		"01_clients.json": `[
+			{"id": 1, "name": "Acme", "balance": 9007199254740993, "tags": ["a", "b"]},
+			{"id": 2, "name": "Globex", "balance": 12.5, "note": "VIP"},
+			{"id": 3, "name": "Huge", "balance": 123456789012345678901234567890}
+		]`,
+		"02_orders.csv": "id,client_id,total\n1,1,10.5\n2,,\n",
+		"03_extra.sql":  "UPDATE clients SET note = 'from sql' WHERE id = 1;",
+		"README.md":     "not a fixture",
+	})
+	if err := s.loadFixtures(dir); err != nil {
+		t.Fatalf("loadFixtures: %v", err)
+	}
+
+	if n := queryInt(t, s, "SELECT count(*) FROM clients WHERE id = 99"); n != 0 {
+		t.Error("rows from before the fixtures were kept")
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT typeof(balance) || ':' || balance FROM clients WHERE id = 1", "integer:9007199254740993"},
+		{"SELECT typeof(balance) || ':' || balance FROM clients WHERE id = 2", "real:12.5"},
+		{"SELECT typeof(balance) || ':' || balance FROM clients WHERE id = 3", "text:123456789012345678901234567890"},
+		{"SELECT tags FROM clients WHERE id = 1", `["a","b"]`},
+		{"SELECT note FROM clients WHERE id = 1", "from sql"},
+		{"SELECT coalesce(note, 'NULL') FROM clients WHERE id = 3", "NULL"},
+		{"SELECT total FROM orders WHERE id = 1", "10.5"},
+		{"SELECT coalesce(client_id, 'NULL') || coalesce(total, 'NULL') FROM orders WHERE id = 2", "NULLNULL"},
+	}
+	for _, tt := range tests {
+		var got string
+		if err := s.db.QueryRow(tt.query).Scan(&got); err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+	if want := []string{"clients", "orders"}; len(s.fixtures.tables) != 2 || s.fixtures.tables[0] != want[0] || s.fixtures.tables[1] != want[1] {
+		t.Errorf("fixture tables = %v, want %v", s.fixtures.tables, want)
+	}
+}
+
+func TestLoadFixturesRollsBack(t *testing.T) {
+	s := newTestServer(t, fixtureSchema+"INSERT INTO clients (id, name) VALUES (99, 'kept');")
+	dir := writeFixtures(t, map[string]string{
+		"01_clients.json": `[{"id": 1, "name": "Acme"}]`,
+		"02_orders.json":  `[{"id": 1, "missing_column": 1}]`,
+	})
+	if err := s.loadFixtures(dir); err == nil {
+		t.Fatal("loadFixtures succeeded with a bad fixture, want an error")
+	}
+	if n := queryInt(t, s, "SELECT count(*) FROM clients WHERE id = 99"); n != 1 {
+		t.Error("a failed load changed the database")
+	}
+	if s.fixtures != nil {
+		t.Error("a failed load was recorded as the fixture state")
+	}
+}
+
+func TestResetDatabase(t *testing.T) {
+	tests := []struct {
+		name     string
+		pristine bool // Reset from the in-memory copy, rather than by reloading the fixtures
+	}{
+		{"from pristine copy", true},
+		{"by reloading fixtures", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, fixtureSchema)
+			dir := writeFixtures(t, map[string]string{"clients.json": `[{"id": 1, "name": "Acme"}, {"id": 2, "name": "Globex"}]`})
+			if err := s.loadFixtures(dir); err != nil {
+				t.Fatalf("loadFixtures: %v", err)
+			}
+			if tt.pristine {
+				if err := s.capturePristine(); err != nil {
+					t.Fatalf("capturePristine: %v", err)
+				}
+				t.Cleanup(func() { s.pristine.Close() })
+			}
+
+			if _, err := s.db.Exec("DELETE FROM clients WHERE id = 1; UPDATE clients SET name = 'changed'; INSERT INTO clients (id) VALUES (3)"); err != nil {
+				t.Fatal(err)
+			}
+			w := serveTest(s, http.HandlerFunc(s.handleReset), "POST", "/admin/reset", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("reset: status %d: %s", w.Code, w.Body)
+			}
+			if n := queryInt(t, s, "SELECT count(*) FROM clients WHERE (id = 1 AND name = 'Acme') OR (id = 2 AND name = 'Globex')"); n != 2 {
+				t.Error("reset didn't restore the fixture rows")
+			}
+			if n := queryInt(t, s, "SELECT count(*) FROM clients"); n != 2 {
+				t.Errorf("%d clients after reset, want 2", n)
+			}
+		})
+	}
+}
+
+func TestResetDatabaseErrors(t *testing.T) {
+	s := newTestServer(t, "")
+	if w := serveTest(s, http.HandlerFunc(s.handleReset), "GET", "/admin/reset", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if w := serveTest(s, http.HandlerFunc(s.handleReset), "POST", "/admin/reset", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("without fixtures: status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if err := s.loadFixtures(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("loadFixtures with a missing directory succeeded")
+	}
+}
+
+func TestCopySQLiteDatabase(t *testing.T) {
+	src := newTestServer(t, "CREATE TABLE t (a); INSERT INTO t VALUES (1), (2);")
+	dest := newTestServer(t, "CREATE TABLE other (b); INSERT INTO other VALUES (1);")
+
+	memDB, err := openMemoryDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memDB.Close()
+
+	// To memory and back, as a reset does
+	if err := copySQLiteDatabase(memDB, src.db); err != nil {
+		t.Fatalf("copy to memory: %v", err)
+	}
+	if _, err := src.db.Exec("DELETE FROM t"); err != nil {
+		t.Fatal(err)
+	}
+	if err := copySQLiteDatabase(dest.db, memDB); err != nil {
+		t.Fatalf("copy from memory: %v", err)
+	}
+	if n := queryInt(t, dest, "SELECT sum(a) FROM t"); n != 3 {
+		t.Errorf("sum(a) = %d in the copy, want 3", n)
+	}
+	if n := queryInt(t, dest, "SELECT count(*) FROM sqlite_master WHERE name = 'other'"); n != 0 {
+		t.Error("the copy kept a table the source doesn't have")
+	}
+}
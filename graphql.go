@@ -0,0 +1,972 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ===== GraphQL Endpoint =====
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphQLError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// Keys per batched query; keeps IN lists well under the databases' parameter limits
+const gqlBatchSize = 500
+
+// Limits on the size of a request, so that one request can't fan out into any number of queries
+const (
+	gqlMaxDepth    = 10  // Nesting of fields, counting the root fields as 1
+	gqlMaxFields   = 500 // Fields in an operation once fragments are expanded
+	gqlMaxRequests = 20  // Requests in a batch
+)
+
+// Handle GET and POST /graphql. A POST body may hold an array of requests, answered with an array.
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	logger(r.Context()).Debug("GraphQL", "method", r.Method, "path", r.URL.Path)
+
+	var requests []graphQLRequest
+	batch := false
+	switch r.Method {
+	case "GET":
+		req := graphQLRequest{Query: r.URL.Query().Get("query"), OperationName: r.URL.Query().Get("operationName")}
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				sendErrorResponse(w, fmt.Sprintf("Invalid variables: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		requests = append(requests, req)
+
+	case "POST":
+		if s.maxBodyBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendBodyError(w, readBodyError(err, "failed to read request body"))
+			return
+		}
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/graphql" {
+			requests = append(requests, graphQLRequest{Query: string(body)})
+			break
+		}
+		body = bytes.TrimSpace(body)
+		if batch = len(body) > 0 && body[0] == '['; batch {
+			err = json.Unmarshal(body, &requests)
+		} else {
+			var req graphQLRequest
+			err = json.Unmarshal(body, &req)
+			requests = append(requests, req)
+		}
+		if err != nil {
+			sendErrorResponse(w, fmt.Sprintf("Invalid GraphQL request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+	default:
+		sendErrorResponse(w, "Only GET and POST methods are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(requests) > gqlMaxRequests {
+		sendErrorResponse(w, fmt.Sprintf("Too many requests in a batch (at most %d)", gqlMaxRequests), http.StatusBadRequest)
+		return
+	}
+
+	logged := make([]interface{}, len(requests))
+	for i, req := range requests {
+		logged[i] = map[string]interface{}{"query": req.Query, "operationName": req.OperationName, "variables": req.Variables}
+	}
+	requestInfoFrom(r.Context()).note("/graphql", logged)
+
+	responses := make([]map[string]interface{}, len(requests))
+	for i, req := range requests {
+		responses[i] = s.executeGraphQL(r, req)
+	}
+	if batch {
+		s.sendJSONResponse(w, responses, http.StatusOK)
+		return
+	}
+	s.sendJSONResponse(w, responses[0], http.StatusOK)
+}
+
+// Run one GraphQL request and build its response
+func (s *Server) executeGraphQL(r *http.Request, req graphQLRequest) map[string]interface{} {
+	fail := func(err error) map[string]interface{} {
+		return map[string]interface{}{"errors": []graphQLError{{Message: err.Error()}}}
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return fail(fmt.Errorf("query is required"))
+	}
+	doc, err := parseGraphQL(req.Query)
+	if err != nil {
+		return fail(err)
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return fail(err)
+	}
+	if op.kind != "query" {
+		return fail(fmt.Errorf("only queries are supported, not %ss", op.kind))
+	}
+	if err := doc.checkSize(op.selections); err != nil {
+		return fail(err)
+	}
+
+	// Variables fall back to their defaults
+	vars := make(map[string]interface{})
+	for _, def := range op.variables {
+		if value, ok := req.Variables[def.name]; ok {
+			vars[def.name] = value
+		} else if def.hasDefault {
+			vars[def.name] = gqlResolveValue(def.defaultValue, nil)
+		} else if strings.HasSuffix(def.typ, "!") {
+			return fail(fmt.Errorf("variable $%s of type %s is required", def.name, def.typ))
+		}
+	}
+
+	e := &gqlExecutor{ctx: r.Context(), r: r, s: s, schema: s.graphql, doc: doc, vars: vars}
+	data, err := e.executeQuery(op.selections)
+	if err != nil {
+		response := fail(err)
+		response["data"] = nil
+		return response
+	}
+	return map[string]interface{}{"data": data}
+}
+
+// gqlObject is a response object that keeps its fields in selection order
+type gqlObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newGQLObject() *gqlObject {
+	return &gqlObject{values: make(map[string]interface{})}
+}
+
+func (o *gqlObject) set(key string, value interface{}) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *gqlObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+type gqlExecutor struct {
+	ctx    context.Context
+	r      *http.Request // The request the query came in, which endpoint limits are checked against
+	s      *Server
+	schema *gqlSchema
+	doc    *gqlDocument
+	vars   map[string]interface{}
+}
+
+// A field to resolve, with the selections of every occurrence of its response key merged
+type gqlCollectedField struct {
+	key        string
+	sel        *gqlSelection
+	selections []*gqlSelection
+}
+
+// Flatten fragments and apply @skip and @include, grouping fields by response key
+func (e *gqlExecutor) collectFields(typeName string, selections []*gqlSelection) ([]*gqlCollectedField, error) {
+	var fields []*gqlCollectedField
+	byKey := make(map[string]*gqlCollectedField)
+	visited := make(map[string]bool)
+
+	var collect func(selections []*gqlSelection) error
+	collect = func(selections []*gqlSelection) error {
+		for _, sel := range selections {
+			include, err := e.included(sel.directives)
+			if err != nil {
+				return err
+			}
+			if !include {
+				continue
+			}
+
+			switch {
+			case sel.spread != "":
+				fragment, ok := e.doc.fragments[sel.spread]
+				if !ok {
+					return fmt.Errorf("unknown fragment %q", sel.spread)
+				}
+				if visited[sel.spread] || fragment.typeCondition != typeName {
+					continue
+				}
+				visited[sel.spread] = true
+				if include, err := e.included(fragment.directives); err != nil || !include {
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				if err := collect(fragment.selections); err != nil {
+					return err
+				}
+
+			case sel.inline:
+				if sel.typeCondition != "" && sel.typeCondition != typeName {
+					continue
+				}
+				if err := collect(sel.selections); err != nil {
+					return err
+				}
+
+			default:
+				key := sel.responseKey()
+				if field, ok := byKey[key]; ok {
+					if field.sel.name != sel.name {
+						return fmt.Errorf("fields %q and %q both use the response key %q", field.sel.name, sel.name, key)
+					}
+					field.selections = append(field.selections, sel.selections...)
+					continue
+				}
+				field := &gqlCollectedField{key: key, sel: sel, selections: sel.selections}
+				byKey[key] = field
+				fields = append(fields, field)
+			}
+		}
+		return nil
+	}
+	return fields, collect(selections)
+}
+
+// Evaluate @skip(if:) and @include(if:)
+func (e *gqlExecutor) included(directives []gqlDirective) (bool, error) {
+	for _, directive := range directives {
+		if directive.name != "skip" && directive.name != "include" {
+			continue
+		}
+		var condition interface{}
+		for _, arg := range directive.args {
+			if arg.name == "if" {
+				condition = gqlResolveValue(arg.value, e.vars)
+			}
+		}
+		value, ok := condition.(bool)
+		if !ok {
+			return false, fmt.Errorf("@%s needs a Boolean \"if\" argument", directive.name)
+		}
+		if directive.name == "skip" && value || directive.name == "include" && !value {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Check a field's arguments against the ones it declares
+func checkArgs(typeName string, field *gqlField, args map[string]interface{}) error {
+	for name := range args {
+		known := false
+		for _, arg := range field.args {
+			known = known || arg.name == name
+		}
+		if !known {
+			return fmt.Errorf("unknown argument %q on field %s.%s", name, typeName, field.name)
+		}
+	}
+	for _, arg := range field.args {
+		if arg.typ.kind == "NON_NULL" && args[arg.name] == nil {
+			return fmt.Errorf("argument %q of type %s is required on field %s.%s", arg.name, arg.typ, typeName, field.name)
+		}
+	}
+	return nil
+}
+
+// Resolve the fields of the query root
+func (e *gqlExecutor) executeQuery(selections []*gqlSelection) (*gqlObject, error) {
+	fields, err := e.collectFields("Query", selections)
+	if err != nil {
+		return nil, err
+	}
+
+	data := newGQLObject()
+	for _, f := range fields {
+		args := f.sel.argValues(e.vars)
+		switch f.sel.name {
+		case "__typename":
+			data.set(f.key, "Query")
+			continue
+		case "__schema":
+			value, err := e.introspect(e.schemaIntrospection(), f.selections)
+			if err != nil {
+				return nil, err
+			}
+			data.set(f.key, value)
+			continue
+		case "__type":
+			name, _ := args["name"].(string)
+			var value interface{}
+			if t, ok := e.schema.types[name]; ok {
+				if value, err = e.introspect(e.typeIntrospection(t), f.selections); err != nil {
+					return nil, err
+				}
+			}
+			data.set(f.key, value)
+			continue
+		}
+
+		field := e.schema.query.field(f.sel.name)
+		if field == nil {
+			return nil, fmt.Errorf("cannot query field %q on type \"Query\"", f.sel.name)
+		}
+		if err := checkArgs("Query", field, args); err != nil {
+			return nil, err
+		}
+
+		var value interface{}
+		switch field.kind {
+		case gqlRowsField:
+			value, err = e.resolveRows(field.table, args, f.selections)
+		case gqlByKeyField:
+			value, err = e.resolveByKey(field, args, f.selections)
+		case gqlEndpointField:
+			value, err = e.resolveEndpoint(field, args, f.selections)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.key, err)
+		}
+		data.set(f.key, value)
+	}
+	return data, nil
+}
+
+// Query root: rows of a table with filters, ordering and pagination
+func (e *gqlExecutor) resolveRows(table *gqlTable, args map[string]interface{}, selections []*gqlSelection) (interface{}, error) {
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("field of type %s must have a selection of subfields", table.typ.name)
+	}
+	query := "SELECT * FROM " + quoteIdent(table.info.Name)
+	var params []interface{}
+
+	condition, err := e.compileFilter(table, args["where"], &params)
+	if err != nil {
+		return nil, err
+	}
+	if condition != "" {
+		query += " WHERE " + condition
+	}
+	order, err := e.compileOrder(table, args["orderBy"])
+	if err != nil {
+		return nil, err
+	}
+	if order != "" {
+		query += " ORDER BY " + order
+	}
+	limit, offset, err := e.pagination(args)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case limit >= 0:
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	case offset > 0 && e.s.dbType == "postgres":
+		query += fmt.Sprintf(" OFFSET %d", offset)
+	case offset > 0:
+		query += fmt.Sprintf(" LIMIT -1 OFFSET %d", offset)
+	}
+
+	result, err := e.s.runQuery(e.ctx, query, params, e.s.types, e.s.maxRows)
+	if err != nil {
+		return nil, err
+	}
+	return e.completeRows(table, result.maps(), selections)
+}
+
+// Query root: one row by primary key
+func (e *gqlExecutor) resolveByKey(field *gqlField, args map[string]interface{}, selections []*gqlSelection) (interface{}, error) {
+	table := field.table
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("field of type %s must have a selection of subfields", table.typ.name)
+	}
+	var conditions []string
+	var params []interface{}
+	for _, arg := range field.args {
+		conditions = append(conditions, quoteIdent(table.columns[arg.name])+" = ?")
+		params = append(params, args[arg.name])
+	}
+	result, err := e.s.runQuery(e.ctx, "SELECT * FROM "+quoteIdent(table.info.Name)+" WHERE "+strings.Join(conditions, " AND "),
+		params, e.s.types, 1)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := e.completeRows(table, result.maps(), selections)
+	if err != nil || len(objects) == 0 {
+		return nil, err
+	}
+	return objects[0], nil
+}
+
+// Query root: an API description endpoint, run as its GET method would be
+func (e *gqlExecutor) resolveEndpoint(field *gqlField, args map[string]interface{}, selections []*gqlSelection) (interface{}, error) {
+	if len(selections) > 0 {
+		return nil, fmt.Errorf("field of type JSON can't have a selection of subfields")
+	}
+
+	// The endpoint's own limits apply as they do to its GET requests
+	if limiter := e.s.endpointRateLimits[field.endpoint]; limiter != nil {
+		if ok, retryAfter := limiter.take(e.r); !ok {
+			return nil, fmt.Errorf("too many requests to %s, retry after %d seconds", field.endpoint, retryAfter)
+		}
+	}
+	if slots := e.s.endpointSlots[field.endpoint]; slots != nil {
+		if !slots.acquire(e.ctx) {
+			logger(e.ctx).Warn("concurrency limit reached", "endpoint", field.endpoint)
+			return nil, fmt.Errorf("server busy, %s can't take more requests", field.endpoint)
+		}
+		defer slots.release()
+	}
+
+	method := field.method
+	sqlQuery, err := e.s.methodSQL(method)
+	if err != nil {
+		return nil, err
+	}
+	paramValue := func(name string) interface{} {
+		return sqlValue(args[name])
+	}
+	sqlQuery, sqlParams := bindNamed(sqlQuery, e.s.dbType, method.Params, paramValue)
+	result, rows, err := e.s.queryMethod(e.ctx, method, sqlQuery, sqlParams, paramValue)
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	data, _, err := shapeResult(result, rows, method.Result, method.Column)
+	return data, err
+}
+
+// Resolve a selection on rows of a table. Relations are loaded with one query per field
+// for all the rows at once, rather than one query per row.
+func (e *gqlExecutor) completeRows(table *gqlTable, rows []map[string]interface{}, selections []*gqlSelection) ([]*gqlObject, error) {
+	objects := make([]*gqlObject, len(rows))
+	for i := range rows {
+		objects[i] = newGQLObject()
+	}
+	if len(rows) == 0 {
+		return objects, nil
+	}
+
+	fields, err := e.collectFields(table.typ.name, selections)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		if f.sel.name == "__typename" {
+			for _, object := range objects {
+				object.set(f.key, table.typ.name)
+			}
+			continue
+		}
+		field := table.typ.field(f.sel.name)
+		if field == nil {
+			return nil, fmt.Errorf("cannot query field %q on type %q", f.sel.name, table.typ.name)
+		}
+		args := f.sel.argValues(e.vars)
+		if err := checkArgs(table.typ.name, field, args); err != nil {
+			return nil, err
+		}
+		if field.kind == gqlColumnField {
+			if len(f.selections) > 0 {
+				return nil, fmt.Errorf("field %s.%s of type %s can't have a selection of subfields", table.typ.name, field.name, field.typ)
+			}
+			for i, row := range rows {
+				objects[i].set(f.key, gqlCoerce(field.scalar, row[field.column]))
+			}
+			continue
+		}
+		if len(f.selections) == 0 {
+			return nil, fmt.Errorf("field %s.%s of type %s must have a selection of subfields", table.typ.name, field.name, field.typ)
+		}
+
+		switch field.kind {
+		case gqlParentField:
+			if err := e.resolveParents(field, rows, objects, f); err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", table.typ.name, field.name, err)
+			}
+		case gqlChildrenField:
+			if err := e.resolveChildren(field, rows, objects, f, args); err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", table.typ.name, field.name, err)
+			}
+		}
+	}
+	return objects, nil
+}
+
+// Join key of a row on some columns; false when any of them is null
+func gqlRowKey(row map[string]interface{}, columns []string) (string, bool) {
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		value := row[column]
+		if value == nil {
+			return "", false
+		}
+		parts[i] = fmt.Sprint(value) // Compare as text, like nested query joins
+	}
+	return strings.Join(parts, "\x00"), true
+}
+
+// Distinct join keys of rows, with the values to bind for each
+func gqlDistinctKeys(rows []map[string]interface{}, columns []string) ([]string, map[string][]interface{}) {
+	var keys []string
+	values := make(map[string][]interface{})
+	for _, row := range rows {
+		key, ok := gqlRowKey(row, columns)
+		if !ok {
+			continue
+		}
+		if _, seen := values[key]; seen {
+			continue
+		}
+		keys = append(keys, key)
+		for _, column := range columns {
+			values[key] = append(values[key], row[column])
+		}
+	}
+	return keys, values
+}
+
+// Build "col IN (?, ?)" or "(a = ? AND b = ?) OR ..." for a batch of keys
+func gqlKeyCondition(columns []string, keys []string, values map[string][]interface{}, params *[]interface{}) string {
+	if len(columns) == 1 {
+		placeholders := make([]string, len(keys))
+		for i, key := range keys {
+			placeholders[i] = "?"
+			*params = append(*params, values[key][0])
+		}
+		return quoteIdent(columns[0]) + " IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	alternatives := make([]string, len(keys))
+	for i, key := range keys {
+		conditions := make([]string, len(columns))
+		for j, column := range columns {
+			conditions[j] = quoteIdent(column) + " = ?"
+			*params = append(*params, values[key][j])
+		}
+		alternatives[i] = "(" + strings.Join(conditions, " AND ") + ")"
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+// Load the parent rows a foreign key points at, for all child rows at once
+func (e *gqlExecutor) resolveParents(field *gqlField, rows []map[string]interface{}, objects []*gqlObject, f *gqlCollectedField) error {
+	parent := field.table
+	keys, values := gqlDistinctKeys(rows, field.fk.Columns)
+
+	var parents []map[string]interface{}
+	for start := 0; start < len(keys); start += gqlBatchSize {
+		batch := keys[start:min(start+gqlBatchSize, len(keys))]
+		var params []interface{}
+		query := "SELECT * FROM " + quoteIdent(parent.info.Name) + " WHERE " +
+			gqlKeyCondition(field.fkTarget, batch, values, &params)
+		result, err := e.s.runQuery(e.ctx, query, params, e.s.types, 0)
+		if err != nil {
+			return err
+		}
+		parents = append(parents, result.maps()...)
+	}
+
+	parentObjects, err := e.completeRows(parent, parents, f.selections)
+	if err != nil {
+		return err
+	}
+	byKey := make(map[string]*gqlObject)
+	for i, row := range parents {
+		if key, ok := gqlRowKey(row, field.fkTarget); ok {
+			byKey[key] = parentObjects[i]
+		}
+	}
+	for i, row := range rows {
+		var value interface{}
+		if key, ok := gqlRowKey(row, field.fk.Columns); ok {
+			if object, found := byKey[key]; found {
+				value = object
+			}
+		}
+		objects[i].set(f.key, value)
+	}
+	return nil
+}
+
+// Load the child rows that reference each parent row, for all parent rows at once.
+// Limits and offsets apply per parent, using ROW_NUMBER() over each parent's children.
+func (e *gqlExecutor) resolveChildren(field *gqlField, rows []map[string]interface{}, objects []*gqlObject, f *gqlCollectedField, args map[string]interface{}) error {
+	child := field.table
+	keys, values := gqlDistinctKeys(rows, field.fkTarget)
+
+	order, err := e.compileOrder(child, args["orderBy"])
+	if err != nil {
+		return err
+	}
+	limit, offset, err := e.pagination(args)
+	if err != nil {
+		return err
+	}
+
+	var children []map[string]interface{}
+	for start := 0; start < len(keys); start += gqlBatchSize {
+		batch := keys[start:min(start+gqlBatchSize, len(keys))]
+		var params []interface{}
+		conditions := []string{gqlKeyCondition(field.fk.Columns, batch, values, &params)}
+		filter, err := e.compileFilter(child, args["where"], &params)
+		if err != nil {
+			return err
+		}
+		if filter != "" {
+			conditions = append(conditions, filter)
+		}
+
+		query := "SELECT * FROM " + quoteIdent(child.info.Name) + " WHERE " + strings.Join(conditions, " AND ")
+		if limit >= 0 || offset > 0 {
+			partition := make([]string, len(field.fk.Columns))
+			for i, column := range field.fk.Columns {
+				partition[i] = quoteIdent(column)
+			}
+			window := "PARTITION BY " + strings.Join(partition, ", ")
+			if order != "" {
+				window += " ORDER BY " + order
+			}
+			query = "SELECT * FROM (SELECT *, ROW_NUMBER() OVER (" + window + ") AS \"__row\" FROM " +
+				quoteIdent(child.info.Name) + " WHERE " + strings.Join(conditions, " AND ") + ") AS \"__rows\"" +
+				fmt.Sprintf(" WHERE \"__row\" > %d", offset)
+			if limit >= 0 {
+				query += fmt.Sprintf(" AND \"__row\" <= %d", offset+limit)
+			}
+			query += " ORDER BY \"__row\""
+		} else if order != "" {
+			query += " ORDER BY " + order
+		}
+
+		result, err := e.s.runQuery(e.ctx, query, params, e.s.types, 0)
+		if err != nil {
+			return err
+		}
+		for _, row := range result.maps() {
+			delete(row, "__row")
+			children = append(children, row)
+		}
+	}
+
+	childObjects, err := e.completeRows(child, children, f.selections)
+	if err != nil {
+		return err
+	}
+	byKey := make(map[string][]*gqlObject)
+	for i, row := range children {
+		if key, ok := gqlRowKey(row, field.fk.Columns); ok {
+			byKey[key] = append(byKey[key], childObjects[i])
+		}
+	}
+	for i, row := range rows {
+		list := []*gqlObject{}
+		if key, ok := gqlRowKey(row, field.fkTarget); ok && byKey[key] != nil {
+			list = byKey[key]
+		}
+		objects[i].set(f.key, list)
+	}
+	return nil
+}
+
+// Compile a filter object to a parameterized condition; "" when there is nothing to check
+func (e *gqlExecutor) compileFilter(table *gqlTable, filter interface{}, params *[]interface{}) (string, error) {
+	if filter == nil {
+		return "", nil
+	}
+	fields, ok := filter.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("filter on %s must be an object", table.info.Name)
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names) // Keep the generated SQL stable
+
+	var conditions []string
+	for _, name := range names {
+		value := fields[name]
+		switch name {
+		case "_and", "_or":
+			items, ok := value.([]interface{})
+			if !ok {
+				items = []interface{}{value} // A single value stands for a list of one
+			}
+			var parts []string
+			for _, item := range items {
+				part, err := e.compileFilter(table, item, params)
+				if err != nil {
+					return "", err
+				}
+				if part != "" {
+					parts = append(parts, part)
+				}
+			}
+			if len(parts) > 0 {
+				separator := " AND "
+				if name == "_or" {
+					separator = " OR "
+				}
+				conditions = append(conditions, "("+strings.Join(parts, separator)+")")
+			}
+		case "_not":
+			part, err := e.compileFilter(table, value, params)
+			if err != nil {
+				return "", err
+			}
+			if part != "" {
+				conditions = append(conditions, "NOT "+part)
+			}
+		default:
+			column, ok := table.columns[name]
+			if !ok {
+				return "", fmt.Errorf("unknown column %q in filter on %s", name, table.info.Name)
+			}
+			part, err := e.compileComparison(quoteIdent(column), value, params)
+			if err != nil {
+				return "", fmt.Errorf("%s: %v", name, err)
+			}
+			if part != "" {
+				conditions = append(conditions, part)
+			}
+		}
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")", nil
+}
+
+// Compile the operators of a column comparison such as {_gt: 1, _lt: 10}
+func (e *gqlExecutor) compileComparison(column string, comparison interface{}, params *[]interface{}) (string, error) {
+	operators, ok := comparison.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("comparison must be an object")
+	}
+	names := make([]string, 0, len(operators))
+	for name := range operators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	binary := map[string]string{"_eq": "=", "_neq": "<>", "_gt": ">", "_gte": ">=", "_lt": "<", "_lte": "<=", "_like": "LIKE", "_ilike": "LIKE"}
+	if e.s.dbType == "postgres" {
+		binary["_ilike"] = "ILIKE"
+	}
+
+	var conditions []string
+	for _, name := range names {
+		value := operators[name]
+		switch name {
+		case "_eq", "_neq", "_gt", "_gte", "_lt", "_lte", "_like", "_ilike":
+			if value == nil {
+				switch name {
+				case "_eq":
+					conditions = append(conditions, column+" IS NULL")
+				case "_neq":
+					conditions = append(conditions, column+" IS NOT NULL")
+				default:
+					return "", fmt.Errorf("%s can't compare with null", name)
+				}
+				continue
+			}
+			conditions = append(conditions, column+" "+binary[name]+" ?")
+			*params = append(*params, sqlValue(value))
+		case "_in", "_nin":
+			items, ok := value.([]interface{})
+			if !ok {
+				items = []interface{}{value}
+			}
+			if len(items) == 0 {
+				// Nothing is in an empty list
+				if name == "_in" {
+					conditions = append(conditions, "1 = 0")
+				}
+				continue
+			}
+			placeholders := make([]string, len(items))
+			for i, item := range items {
+				placeholders[i] = "?"
+				*params = append(*params, sqlValue(item))
+			}
+			operator := " IN ("
+			if name == "_nin" {
+				operator = " NOT IN ("
+			}
+			conditions = append(conditions, column+operator+strings.Join(placeholders, ", ")+")")
+		case "_is_null":
+			isNull, ok := value.(bool)
+			if !ok {
+				return "", fmt.Errorf("_is_null must be a Boolean")
+			}
+			if isNull {
+				conditions = append(conditions, column+" IS NULL")
+			} else {
+				conditions = append(conditions, column+" IS NOT NULL")
+			}
+		default:
+			return "", fmt.Errorf("unknown operator %q", name)
+		}
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// Compile an orderBy argument: a list of {column: ASC|DESC} objects, or a single one.
+// Several columns in one object are ordered as in the table.
+func (e *gqlExecutor) compileOrder(table *gqlTable, orderBy interface{}) (string, error) {
+	if orderBy == nil {
+		return "", nil
+	}
+	items, ok := orderBy.([]interface{})
+	if !ok {
+		items = []interface{}{orderBy}
+	}
+
+	var terms []string
+	for _, item := range items {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("orderBy on %s must be a list of objects", table.info.Name)
+		}
+		for name := range fields {
+			if _, ok := table.columns[name]; !ok {
+				return "", fmt.Errorf("unknown column %q in orderBy on %s", name, table.info.Name)
+			}
+		}
+		for _, field := range table.typ.fields {
+			direction, ok := fields[field.name]
+			if !ok || field.kind != gqlColumnField {
+				continue
+			}
+			text, _ := direction.(string)
+			switch strings.ToUpper(text) {
+			case "ASC", "DESC":
+				terms = append(terms, quoteIdent(field.column)+" "+strings.ToUpper(text))
+			default:
+				return "", fmt.Errorf("invalid order direction %v for %s", direction, field.name)
+			}
+		}
+	}
+	return strings.Join(terms, ", "), nil
+}
+
+// Read the limit (-1 when absent) and offset arguments
+func gqlPagination(args map[string]interface{}) (limit int, offset int, err error) {
+	limit, offset = -1, 0
+	if value, ok := args["limit"]; ok && value != nil {
+		if limit, err = gqlCount(value); err != nil {
+			return 0, 0, fmt.Errorf("invalid limit: %v", err)
+		}
+	}
+	if value, ok := args["offset"]; ok && value != nil {
+		if offset, err = gqlCount(value); err != nil {
+			return 0, 0, fmt.Errorf("invalid offset: %v", err)
+		}
+	}
+	return limit, offset, nil
+}
+
+// Read the pagination arguments with --max-rows applied: the limit defaults to it and can't
+// exceed it. Children fields get it per parent row.
+func (e *gqlExecutor) pagination(args map[string]interface{}) (limit int, offset int, err error) {
+	limit, offset, err = gqlPagination(args)
+	if maxRows := e.s.maxRows; err == nil && maxRows > 0 && (limit < 0 || limit > maxRows) {
+		limit = maxRows
+	}
+	return limit, offset, err
+}
+
+// Read a non-negative integer argument, which arrives as int64 from a literal or float64 from JSON
+func gqlCount(value interface{}) (int, error) {
+	var n float64
+	switch v := value.(type) {
+	case int64:
+		n = float64(v)
+	case float64:
+		n = v
+	default:
+		return 0, fmt.Errorf("%v is not an integer", value)
+	}
+	if n < 0 || n != math.Trunc(n) {
+		return 0, fmt.Errorf("%v is not a non-negative integer", value)
+	}
+	return int(n), nil
+}
+
+// Coerce a column value to the field's scalar, since SQLite stores values of any type in any column
+func gqlCoerce(scalar string, value interface{}) interface{} {
+	switch scalar {
+	case "Boolean":
+		switch v := value.(type) {
+		case int64:
+			return v != 0
+		case float64:
+			return v != 0
+		case string:
+			return v == "1" || strings.EqualFold(v, "t") || strings.EqualFold(v, "true")
+		}
+	case "Int":
+		switch v := value.(type) {
+		case float64:
+			if v == math.Trunc(v) {
+				return int64(v)
+			}
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n
+			}
+		}
+	case "Float":
+		switch v := value.(type) {
+		case int64:
+			return float64(v)
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f
+			}
+		}
+	case "String":
+		switch v := value.(type) {
+		case int64, float64, bool:
+			return fmt.Sprint(v)
+		}
+	}
+	return value
+}
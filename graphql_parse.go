@@ -0,0 +1,850 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ===== GraphQL Parsing =====
+
+// A parsed GraphQL document: operations and the fragments they can spread
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+type gqlOperation struct {
+	kind       string // "query", "mutation" or "subscription"
+	name       string
+	variables  []gqlVariableDef
+	directives []gqlDirective
+	selections []*gqlSelection
+}
+
+type gqlVariableDef struct {
+	name         string
+	typ          string // Type as written, e.g. "[Int!]!"
+	defaultValue interface{}
+	hasDefault   bool
+}
+
+type gqlFragment struct {
+	name          string
+	typeCondition string
+	directives    []gqlDirective
+	selections    []*gqlSelection
+}
+
+// A field, a fragment spread (spread is set) or an inline fragment (inline is set)
+type gqlSelection struct {
+	alias      string
+	name       string
+	args       []gqlArgument
+	directives []gqlDirective
+	selections []*gqlSelection
+
+	spread        string
+	inline        bool
+	typeCondition string
+}
+
+type gqlArgument struct {
+	name  string
+	value interface{}
+}
+
+type gqlDirective struct {
+	name string
+	args []gqlArgument
+}
+
+// Literal values are int64, float64, string, bool, nil, []interface{}, or one of these
+type gqlVariable string           // $name
+type gqlEnum string               // An enum value such as ASC
+type gqlObjectValue []gqlArgument // {name: value, ...} in source order
+
+// The key a field's value is stored under in the response
+func (sel *gqlSelection) responseKey() string {
+	if sel.alias != "" {
+		return sel.alias
+	}
+	return sel.name
+}
+
+// Resolve a selection's arguments against the operation's variables. Arguments given
+// a variable that wasn't provided are left out, as if they hadn't been written.
+func (sel *gqlSelection) argValues(vars map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, arg := range sel.args {
+		if name, ok := arg.value.(gqlVariable); ok {
+			if _, provided := vars[string(name)]; !provided {
+				continue
+			}
+		}
+		values[arg.name] = gqlResolveValue(arg.value, vars)
+	}
+	return values
+}
+
+// Replace variables in a value and convert enums and objects to plain Go values
+func gqlResolveValue(value interface{}, vars map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case gqlVariable:
+		return vars[string(v)]
+	case gqlEnum:
+		return string(v)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = gqlResolveValue(item, vars)
+		}
+		return items
+	case gqlObjectValue:
+		fields := make(map[string]interface{}, len(v))
+		for _, field := range v {
+			fields[field.name] = gqlResolveValue(field.value, vars)
+		}
+		return fields
+	}
+	return value
+}
+
+// Find the operation to run: the named one, or the only one
+func (doc *gqlDocument) operation(name string) (*gqlOperation, error) {
+	if name == "" {
+		if len(doc.operations) != 1 {
+			return nil, fmt.Errorf("operationName is required when the document has %d operations", len(doc.operations))
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+// Reject selections nested deeper than gqlMaxDepth or holding more than gqlMaxFields
+// fields. Fragment spreads count as the fields they expand to, every time they're spread.
+func (doc *gqlDocument) checkSize(selections []*gqlSelection) error {
+	fields := 0
+	spreading := make(map[string]bool)
+
+	var walk func(selections []*gqlSelection, depth int) error
+	walk = func(selections []*gqlSelection, depth int) error {
+		for _, sel := range selections {
+			switch {
+			case sel.spread != "":
+				fragment, ok := doc.fragments[sel.spread]
+				if !ok {
+					return fmt.Errorf("unknown fragment %q", sel.spread)
+				}
+				if spreading[sel.spread] {
+					return fmt.Errorf("fragment %q spreads itself", sel.spread)
+				}
+				spreading[sel.spread] = true
+				err := walk(fragment.selections, depth)
+				spreading[sel.spread] = false
+				if err != nil {
+					return err
+				}
+
+			case sel.inline:
+				if err := walk(sel.selections, depth); err != nil {
+					return err
+				}
+
+			default:
+				if depth+1 > gqlMaxDepth {
+					return fmt.Errorf("query is nested too deeply (at most %d levels)", gqlMaxDepth)
+				}
+				if fields++; fields > gqlMaxFields {
+					return fmt.Errorf("query has too many fields (at most %d)", gqlMaxFields)
+				}
+				if err := walk(sel.selections, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return walk(selections, 0)
+}
+
+// ----- Lexer -----
+
+type gqlTokenKind int
+
+const (
+	gqlEOF gqlTokenKind = iota
+	gqlPunct
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+type gqlToken struct {
+	kind  gqlTokenKind
+	value string
+	pos   int
+}
+
+type gqlLexer struct {
+	src string
+	pos int
+}
+
+func (l *gqlLexer) errorf(pos int, format string, args ...interface{}) error {
+	line, column := 1, 1
+	for _, c := range l.src[:pos] {
+		if c == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+	return fmt.Errorf("syntax error at %d:%d: %s", line, column, fmt.Sprintf(format, args...))
+}
+
+func (l *gqlLexer) next() (gqlToken, error) {
+	// Skip whitespace, commas, byte order marks and comments
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.pos++
+		} else if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+		} else if strings.HasPrefix(l.src[l.pos:], "\ufeff") {
+			l.pos += len("\ufeff")
+		} else {
+			break
+		}
+	}
+	if l.pos >= len(l.src) {
+		return gqlToken{kind: gqlEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		return gqlToken{gqlPunct, "...", start}, nil
+
+	case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+		l.pos++
+		return gqlToken{gqlPunct, string(c), start}, nil
+
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for l.pos < len(l.src) && isGQLNameChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return gqlToken{gqlName, l.src[start:l.pos], start}, nil
+
+	case c == '-' || c >= '0' && c <= '9':
+		return l.number()
+
+	case strings.HasPrefix(l.src[l.pos:], `"""`):
+		return l.blockString()
+
+	case c == '"':
+		return l.string()
+	}
+	return gqlToken{}, l.errorf(start, "unexpected character %q", c)
+}
+
+func isGQLNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (l *gqlLexer) number() (gqlToken, error) {
+	start := l.pos
+	digits := func() int {
+		n := 0
+		for l.pos < len(l.src) && l.src[l.pos] >= '0' && l.src[l.pos] <= '9' {
+			l.pos++
+			n++
+		}
+		return n
+	}
+
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	if digits() == 0 {
+		return gqlToken{}, l.errorf(start, "invalid number")
+	}
+	kind := gqlInt
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		l.pos++
+		if digits() == 0 {
+			return gqlToken{}, l.errorf(start, "invalid number")
+		}
+		kind = gqlFloat
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		if digits() == 0 {
+			return gqlToken{}, l.errorf(start, "invalid number")
+		}
+		kind = gqlFloat
+	}
+	if l.pos < len(l.src) && (isGQLNameChar(l.src[l.pos]) || l.src[l.pos] == '.') {
+		return gqlToken{}, l.errorf(start, "invalid number")
+	}
+	return gqlToken{kind, l.src[start:l.pos], start}, nil
+}
+
+func (l *gqlLexer) string() (gqlToken, error) {
+	start := l.pos
+	var b strings.Builder
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		c := l.src[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return gqlToken{gqlString, b.String(), start}, nil
+		case c == '\n' || c == '\r':
+			return gqlToken{}, l.errorf(start, "unterminated string")
+		case c != '\\':
+			b.WriteByte(c)
+			continue
+		}
+
+		// Escape sequence
+		l.pos++
+		if l.pos >= len(l.src) {
+			break
+		}
+		switch l.src[l.pos] {
+		case '"', '\\', '/':
+			b.WriteByte(l.src[l.pos])
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			r, ok := l.unicodeEscape()
+			if !ok {
+				return gqlToken{}, l.errorf(l.pos, "invalid unicode escape")
+			}
+			// A surrogate pair is written as two escapes
+			if utf16.IsSurrogate(r) && strings.HasPrefix(l.src[l.pos+1:], `\u`) {
+				l.pos += 2
+				low, ok := l.unicodeEscape()
+				if !ok {
+					return gqlToken{}, l.errorf(l.pos, "invalid unicode escape")
+				}
+				r = utf16.DecodeRune(r, low)
+			}
+			b.WriteRune(r)
+		default:
+			return gqlToken{}, l.errorf(l.pos, "invalid escape \\%c", l.src[l.pos])
+		}
+	}
+	return gqlToken{}, l.errorf(start, "unterminated string")
+}
+
+// Read the XXXX of \uXXXX, leaving pos on its last digit
+func (l *gqlLexer) unicodeEscape() (rune, bool) {
+	if l.pos+4 >= len(l.src) {
+		return 0, false
+	}
+	code, err := strconv.ParseUint(l.src[l.pos+1:l.pos+5], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	l.pos += 4
+	return rune(code), true
+}
+
+func (l *gqlLexer) blockString() (gqlToken, error) {
+	start := l.pos
+	var b strings.Builder
+	for l.pos += 3; l.pos < len(l.src); l.pos++ {
+		if strings.HasPrefix(l.src[l.pos:], `\"""`) {
+			b.WriteString(`"""`)
+			l.pos += 3
+			continue
+		}
+		if strings.HasPrefix(l.src[l.pos:], `"""`) {
+			l.pos += 3
+			return gqlToken{gqlString, dedentBlockString(b.String()), start}, nil
+		}
+		b.WriteByte(l.src[l.pos])
+	}
+	return gqlToken{}, l.errorf(start, "unterminated block string")
+}
+
+// Remove the common indentation and the leading and trailing blank lines of a block string
+func dedentBlockString(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(strings.ReplaceAll(raw, "\r\n", "\n"), "\r", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && (indent < 0 || len(line)-len(trimmed) < indent) {
+			indent = len(line) - len(trimmed)
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = strings.TrimLeft(lines[i], " \t")
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ----- Parser -----
+
+type gqlParser struct {
+	lex gqlLexer
+	tok gqlToken
+}
+
+// Parse a GraphQL document
+func parseGraphQL(src string) (*gqlDocument, error) {
+	p := &gqlParser{lex: gqlLexer{src: src}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &gqlDocument{fragments: make(map[string]*gqlFragment)}
+	for p.tok.kind != gqlEOF {
+		switch {
+		case p.isPunct("{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &gqlOperation{kind: "query", selections: selections})
+
+		case p.isName("query"), p.isName("mutation"), p.isName("subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+
+		case p.isName("fragment"):
+			fragment, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := doc.fragments[fragment.name]; exists {
+				return nil, fmt.Errorf("fragment %q is defined more than once", fragment.name)
+			}
+			doc.fragments[fragment.name] = fragment
+
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("document has no operations")
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *gqlParser) isPunct(value string) bool {
+	return p.tok.kind == gqlPunct && p.tok.value == value
+}
+
+func (p *gqlParser) isName(value string) bool {
+	return p.tok.kind == gqlName && p.tok.value == value
+}
+
+func (p *gqlParser) unexpected() error {
+	if p.tok.kind == gqlEOF {
+		return p.lex.errorf(p.tok.pos, "unexpected end of document")
+	}
+	return p.lex.errorf(p.tok.pos, "unexpected %q", p.tok.value)
+}
+
+func (p *gqlParser) expectPunct(value string) error {
+	if !p.isPunct(value) {
+		return p.lex.errorf(p.tok.pos, "expected %q, found %q", value, p.tok.value)
+	}
+	return p.advance()
+}
+
+func (p *gqlParser) expectName() (string, error) {
+	if p.tok.kind != gqlName {
+		return "", p.lex.errorf(p.tok.pos, "expected a name, found %q", p.tok.value)
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	op := &gqlOperation{kind: p.tok.value}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == gqlName {
+		op.name = p.tok.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.isPunct("(") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for !p.isPunct(")") {
+			def, err := p.variableDef()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = append(op.variables, def)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if op.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if op.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *gqlParser) variableDef() (gqlVariableDef, error) {
+	var def gqlVariableDef
+	if err := p.expectPunct("$"); err != nil {
+		return def, err
+	}
+	name, err := p.expectName()
+	if err != nil {
+		return def, err
+	}
+	def.name = name
+	if err := p.expectPunct(":"); err != nil {
+		return def, err
+	}
+	if def.typ, err = p.typeRef(); err != nil {
+		return def, err
+	}
+	if p.isPunct("=") {
+		if err := p.advance(); err != nil {
+			return def, err
+		}
+		if def.defaultValue, err = p.value(true); err != nil {
+			return def, err
+		}
+		def.hasDefault = true
+	}
+	// Directives on variable definitions have no effect here
+	_, err = p.directives()
+	return def, err
+}
+
+// Parse a type reference, returning it as written
+func (p *gqlParser) typeRef() (string, error) {
+	var typ string
+	if p.isPunct("[") {
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+		inner, err := p.typeRef()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return "", err
+		}
+		typ = "[" + inner + "]"
+	} else {
+		name, err := p.expectName()
+		if err != nil {
+			return "", err
+		}
+		typ = name
+	}
+	if p.isPunct("!") {
+		typ += "!"
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+	}
+	return typ, nil
+}
+
+func (p *gqlParser) fragment() (*gqlFragment, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	name, err := p.expectName()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, p.lex.errorf(p.tok.pos, "a fragment can't be named \"on\"")
+	}
+	fragment := &gqlFragment{name: name}
+	if !p.isName("on") {
+		return nil, p.lex.errorf(p.tok.pos, "expected \"on\", found %q", p.tok.value)
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if fragment.typeCondition, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	if fragment.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if fragment.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return fragment, nil
+}
+
+func (p *gqlParser) selectionSet() ([]*gqlSelection, error) {
+	if err := p.expectPunct("{"); err != nil {
+		return nil, err
+	}
+	var selections []*gqlSelection
+	for !p.isPunct("}") {
+		if p.tok.kind == gqlEOF {
+			return nil, p.unexpected()
+		}
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	if len(selections) == 0 {
+		return nil, p.lex.errorf(p.tok.pos, "empty selection set")
+	}
+	return selections, p.advance()
+}
+
+func (p *gqlParser) selection() (*gqlSelection, error) {
+	sel := &gqlSelection{}
+	var err error
+
+	if p.isPunct("...") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		switch {
+		case p.isName("on"):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if sel.typeCondition, err = p.expectName(); err != nil {
+				return nil, err
+			}
+			sel.inline = true
+		case p.isPunct("{"), p.isPunct("@"):
+			sel.inline = true
+		default:
+			if sel.spread, err = p.expectName(); err != nil {
+				return nil, err
+			}
+		}
+		if sel.directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		if sel.inline {
+			if sel.selections, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		return sel, nil
+	}
+
+	if sel.name, err = p.expectName(); err != nil {
+		return nil, err
+	}
+	if p.isPunct(":") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		sel.alias = sel.name
+		if sel.name, err = p.expectName(); err != nil {
+			return nil, err
+		}
+	}
+	if sel.args, err = p.arguments(false); err != nil {
+		return nil, err
+	}
+	if sel.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.isPunct("{") {
+		if sel.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+func (p *gqlParser) arguments(constant bool) ([]gqlArgument, error) {
+	if !p.isPunct("(") {
+		return nil, nil
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var args []gqlArgument
+	for !p.isPunct(")") {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.value(constant)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, gqlArgument{name, value})
+	}
+	return args, p.advance()
+}
+
+func (p *gqlParser) directives() ([]gqlDirective, error) {
+	var directives []gqlDirective
+	for p.isPunct("@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.arguments(false)
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, gqlDirective{name, args})
+	}
+	return directives, nil
+}
+
+// Parse a value; constant values can't contain variables
+func (p *gqlParser) value(constant bool) (interface{}, error) {
+	tok := p.tok
+	switch tok.kind {
+	case gqlInt:
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, p.lex.errorf(tok.pos, "integer out of range: %s", tok.value)
+		}
+		return n, p.advance()
+
+	case gqlFloat:
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, p.lex.errorf(tok.pos, "invalid float: %s", tok.value)
+		}
+		return f, p.advance()
+
+	case gqlString:
+		return tok.value, p.advance()
+
+	case gqlName:
+		var value interface{}
+		switch tok.value {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			value = gqlEnum(tok.value)
+		}
+		return value, p.advance()
+	}
+
+	switch {
+	case p.isPunct("$") && !constant:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		return gqlVariable(name), nil
+
+	case p.isPunct("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		items := []interface{}{}
+		for !p.isPunct("]") {
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, p.advance()
+
+	case p.isPunct("{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		object := gqlObjectValue{}
+		for !p.isPunct("}") {
+			name, err := p.expectName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(":"); err != nil {
+				return nil, err
+			}
+			value, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, gqlArgument{name, value})
+		}
+		return object, p.advance()
+	}
+	return nil, p.unexpected()
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGraphQLSelections(t *testing.T) {
+	doc, err := parseGraphQL(`
+		# Clients and their orders
+		query Clients($n: Int = 10, $active: Boolean!) @cached {
+			top: clients(limit: $n, where: {active: {eq: $active}}, orderBy: [{name: ASC}]) {
+				id
+				name @include(if: $active)
+				...Orders
+				... on Client { email }
+				... @skip(if: true) { phone }
+			}
+		}
+		fragment Orders on Client { orders { total } }`)
+	if err != nil {
+		t.Fatalf("parseGraphQL error: %v", err)
+	}
+
+	op, err := doc.operation("")
+	if err != nil {
+		t.Fatalf("operation error: %v", err)
+	}
+	if op.kind != "query" || op.name != "Clients" {
+		t.Errorf("operation = %s %s, want query Clients", op.kind, op.name)
+	}
+	wantVars := []gqlVariableDef{
+		{name: "n", typ: "Int", defaultValue: int64(10), hasDefault: true},
+		{name: "active", typ: "Boolean!"},
+	}
+	if !reflect.DeepEqual(op.variables, wantVars) {
+		t.Errorf("variables = %+v, want %+v", op.variables, wantVars)
+	}
+	if len(op.directives) != 1 || op.directives[0].name != "cached" {
+		t.Errorf("directives = %+v, want @cached", op.directives)
+	}
+
+	top := op.selections[0]
+	if top.alias != "top" || top.name != "clients" || top.responseKey() != "top" {
+		t.Errorf("field = %s: %s, want top: clients", top.alias, top.name)
+	}
+	args := top.argValues(map[string]interface{}{"n": int64(5), "active": true})
+	wantArgs := map[string]interface{}{
+		"limit":   int64(5),
+		"where":   map[string]interface{}{"active": map[string]interface{}{"eq": true}},
+		"orderBy": []interface{}{map[string]interface{}{"name": "ASC"}},
+	}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args = %v, want %v", args, wantArgs)
+	}
+
+	sels := top.selections
+	if len(sels) != 5 {
+		t.Fatalf("got %d selections, want 5", len(sels))
+	}
+	if sels[1].name != "name" || len(sels[1].directives) != 1 || sels[1].directives[0].name != "include" {
+		t.Errorf("selection 1 = %+v, want name @include", sels[1])
+	}
+	if sels[2].spread != "Orders" {
+		t.Errorf("selection 2 spreads %q, want Orders", sels[2].spread)
+	}
+	if !sels[3].inline || sels[3].typeCondition != "Client" || sels[3].selections[0].name != "email" {
+		t.Errorf("selection 3 = %+v, want an inline fragment on Client", sels[3])
+	}
+	if !sels[4].inline || sels[4].typeCondition != "" || sels[4].directives[0].name != "skip" {
+		t.Errorf("selection 4 = %+v, want an inline fragment with @skip", sels[4])
+	}
+
+	fragment := doc.fragments["Orders"]
+	if fragment == nil || fragment.typeCondition != "Client" || fragment.selections[0].name != "orders" {
+		t.Errorf("fragment Orders = %+v", fragment)
+	}
+}
+
+func TestParseGraphQLValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  interface{}
+	}{
+		{"int", "-42", int64(-42)},
+		{"float", "1.5e3", 1500.0},
+		{"string", `"a\"bé\n"`, "a\"bé\n"},
+		{"block string", "\"\"\"\n    first\n      second\n\"\"\"", "first\n  second"},
+		{"true", "true", true},
+		{"null", "null", nil},
+		{"enum", "DESC", "DESC"},
+		{"list", "[1, 2 3]", []interface{}{int64(1), int64(2), int64(3)}},
+		{"empty list", "[]", []interface{}{}},
+		{"object", `{a: 1, b: {c: "d"}}`, map[string]interface{}{"a": int64(1), "b": map[string]interface{}{"c": "d"}}},
+		{"variable", "$v", "from variable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseGraphQL("{ f(x: " + tt.value + ") }")
+			if err != nil {
+				t.Fatalf("parseGraphQL error: %v", err)
+			}
+			args := doc.operations[0].selections[0].argValues(map[string]interface{}{"v": "from variable"})
+			if !reflect.DeepEqual(args["x"], tt.want) {
+				t.Errorf("x = %#v, want %#v", args["x"], tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGraphQLDocument(t *testing.T) {
+	doc, err := parseGraphQL("query A { a } query B { b } mutation C { c }")
+	if err != nil {
+		t.Fatalf("parseGraphQL error: %v", err)
+	}
+	if _, err := doc.operation(""); err == nil {
+		t.Error("operation(\"\") with three operations succeeded, want an error")
+	}
+	if op, err := doc.operation("B"); err != nil || op.selections[0].name != "b" {
+		t.Errorf("operation(\"B\") = %+v, %v", op, err)
+	}
+	if op, err := doc.operation("C"); err != nil || op.kind != "mutation" {
+		t.Errorf("operation(\"C\") = %+v, %v", op, err)
+	}
+	if _, err := doc.operation("D"); err == nil {
+		t.Error("operation(\"D\") succeeded, want an error")
+	}
+}
+
+func TestParseGraphQLErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"empty", "", "document has no operations"},
+		{"unclosed selection", "{ a { b }", "unexpected end of document"},
+		{"empty selection", "{ }", "empty selection set"},
+		{"missing colon", "{ f(x 1) }", `expected ":"`},
+		{"variable in default", "query ($a: Int = $b) { f }", "syntax error"},
+		{"unterminated string", `{ f(x: "abc) }`, "syntax error"},
+		{"bad character", "{ a % }", "syntax error"},
+		{"error position", "{\n  a\n  }}", "syntax error at 3:4"},
+		{"duplicate fragment", "{ ...F } fragment F on T { a } fragment F on T { b }", `fragment "F" is defined more than once`},
+		{"stray name", "clients { id }", `unexpected "clients"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseGraphQL(tt.query)
+			if err == nil {
+				t.Fatalf("parseGraphQL(%q) succeeded, want an error containing %q", tt.query, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseGraphQL(%q) error = %q, want it to contain %q", tt.query, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphQLCheckSize(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("{ a ", depth) + strings.Repeat("}", depth)
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  string // Error substring; "" when the query is within the limits
+	}{
+		{"at max depth", nested(gqlMaxDepth), ""},
+		{"too deep", nested(gqlMaxDepth + 1), "nested too deeply"},
+		{"too deep through fragment", "{ a { ...F } } fragment F on T " + nested(gqlMaxDepth), "nested too deeply"},
+		{"at max fields", "{" + strings.Repeat(" a", gqlMaxFields) + " }", ""},
+		{"too many fields", "{" + strings.Repeat(" a", gqlMaxFields+1) + " }", "too many fields"},
+		{"fragments counted per spread",
+			"{ a { ...F ...F ...F } } fragment F on T { b { ...G ...G ...G } } fragment G on T {" + strings.Repeat(" c", 60) + " }",
+			"too many fields"},
+		{"fragment cycle", "{ a { ...F } } fragment F on T { b { ...G } } fragment G on T { ...F }", `fragment "F" spreads itself`},
+		{"unknown fragment", "{ ...F }", `unknown fragment "F"`},
+		{"fragment spread twice side by side", "{ a { ...F ...F } } fragment F on T { b }", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseGraphQL(tt.query)
+			if err != nil {
+				t.Fatalf("parseGraphQL error: %v", err)
+			}
+			err = doc.checkSize(doc.operations[0].selections)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("checkSize error: %v", err)
+			case tt.want != "" && err == nil:
+				t.Errorf("checkSize succeeded, want an error containing %q", tt.want)
+			case tt.want != "" && !strings.Contains(err.Error(), tt.want):
+				t.Errorf("checkSize error = %q, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
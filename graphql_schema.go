@@ -0,0 +1,616 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ===== GraphQL Schema =====
+
+// GraphQLConfig selects tables and views to expose through /graphql
+type GraphQLConfig struct {
+	Include []string `json:"include,omitempty"` // Table names or glob patterns (default: all)
+	Exclude []string `json:"exclude,omitempty"` // Table names or glob patterns to leave out
+}
+
+// A GraphQL type. Named types live in the schema; LIST and NON_NULL wrap ofType.
+type gqlType struct {
+	kind        string // "SCALAR", "OBJECT", "INPUT_OBJECT", "ENUM", "LIST" or "NON_NULL"
+	name        string
+	description string
+	ofType      *gqlType
+	fields      []*gqlField      // OBJECT
+	inputFields []*gqlInputValue // INPUT_OBJECT
+	enumValues  []string         // ENUM
+}
+
+// Ways a field gets its value
+const (
+	gqlColumnField   = "column"   // A column of the row
+	gqlParentField   = "parent"   // The row a foreign key points at
+	gqlChildrenField = "children" // Rows whose foreign key points at this row
+	gqlRowsField     = "rows"     // Query root: rows of a table
+	gqlByKeyField    = "byKey"    // Query root: one row by primary key
+	gqlEndpointField = "endpoint" // Query root: an API description endpoint
+)
+
+type gqlField struct {
+	name        string
+	description string
+	args        []*gqlInputValue
+	typ         *gqlType
+
+	kind     string
+	column   string           // Column fields
+	scalar   string           // Column fields: the scalar the value is coerced to
+	table    *gqlTable        // The table the field returns rows of
+	fk       ForeignKeyInfo   // Parent and children fields: the foreign key, on the child table
+	fkTarget []string         // Parent and children fields: the referenced columns of the parent table
+	method   MethodDefinition // Endpoint fields
+	endpoint string           // Endpoint fields: the endpoint's path, which its limits are kept by
+}
+
+type gqlInputValue struct {
+	name        string
+	description string
+	typ         *gqlType
+}
+
+// A table exposed through GraphQL
+type gqlTable struct {
+	info    TableInfo
+	typ     *gqlType
+	filter  *gqlType
+	orderBy *gqlType
+	columns map[string]string // GraphQL field name -> column name
+}
+
+type gqlSchema struct {
+	query *gqlType
+	types map[string]*gqlType
+	names []string // Named types in definition order
+}
+
+func (t *gqlType) field(name string) *gqlField {
+	for _, field := range t.fields {
+		if field.name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// The type as it is written in a schema, e.g. "[Orders!]!"
+func (t *gqlType) String() string {
+	switch t.kind {
+	case "LIST":
+		return "[" + t.ofType.String() + "]"
+	case "NON_NULL":
+		return t.ofType.String() + "!"
+	}
+	return t.name
+}
+
+func gqlList(t *gqlType) *gqlType    { return &gqlType{kind: "LIST", ofType: t} }
+func gqlNonNull(t *gqlType) *gqlType { return &gqlType{kind: "NON_NULL", ofType: t} }
+
+func (schema *gqlSchema) add(t *gqlType) *gqlType {
+	schema.types[t.name] = t
+	schema.names = append(schema.names, t.name)
+	return t
+}
+
+// Make a valid GraphQL name from a table or column name
+func gqlSanitize(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if isGQLNameChar(name[i]) {
+			b.WriteByte(name[i])
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	sanitized := b.String()
+	if sanitized == "" || sanitized[0] >= '0' && sanitized[0] <= '9' {
+		sanitized = "_" + sanitized
+	}
+	if strings.HasPrefix(sanitized, "__") {
+		sanitized = "x" + sanitized // Names starting with "__" are reserved for introspection
+	}
+	return sanitized
+}
+
+// Make a type name from a table name: order_lines -> OrderLines
+func gqlTypeName(name string) string {
+	var b strings.Builder
+	upper := true
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !isGQLNameChar(c) || c == '_' {
+			upper = true
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		b.WriteByte(c)
+		upper = false
+	}
+	return gqlSanitize(b.String())
+}
+
+// Pick a name that isn't used yet, adding a numeric suffix if needed, and mark it used
+func gqlUniqueName(used map[string]bool, base string) string {
+	name := base
+	for n := 2; used[name]; n++ {
+		name = fmt.Sprintf("%s_%d", base, n)
+	}
+	used[name] = true
+	return name
+}
+
+// The scalar a column is exposed as, from its declared type
+func (s *Server) gqlScalar(columnType string) string {
+	t := strings.ToLower(columnType)
+	switch {
+	case t == "":
+		return "JSON" // Untyped SQLite columns and view expressions can hold anything
+	case strings.Contains(t, "int") || strings.Contains(t, "serial"):
+		return "Int"
+	case strings.Contains(t, "bool"):
+		return "Boolean"
+	case strings.Contains(t, "real"), strings.Contains(t, "floa"), strings.Contains(t, "doub"):
+		return "Float"
+	case strings.Contains(t, "numeric"), strings.Contains(t, "decimal"):
+		if s.types.Numeric == "number" {
+			return "Float"
+		}
+		return "String"
+	case strings.Contains(t, "json"):
+		return "JSON"
+	}
+	return "String"
+}
+
+// Build the GraphQL schema for the given tables and the API description's GET endpoints
+func (s *Server) buildGraphQLSchema(tables []TableInfo) *gqlSchema {
+	schema := &gqlSchema{types: make(map[string]*gqlType)}
+	typeNames := map[string]bool{"Query": true, "OrderDirection": true}
+
+	// Built-in scalars, plus JSON for values of any shape
+	scalars := map[string]*gqlType{}
+	for _, name := range []string{"Int", "Float", "String", "Boolean", "ID", "JSON"} {
+		scalars[name] = schema.add(&gqlType{kind: "SCALAR", name: name})
+		typeNames[name] = true
+	}
+	scalars["JSON"].description = "Any JSON value"
+	orderDirection := schema.add(&gqlType{kind: "ENUM", name: "OrderDirection", enumValues: []string{"ASC", "DESC"}})
+
+	// Comparison operators for each scalar, used in filters
+	comparisons := map[string]*gqlType{}
+	comparison := func(scalar string) *gqlType {
+		if t, ok := comparisons[scalar]; ok {
+			return t
+		}
+		name := gqlUniqueName(typeNames, scalar+"Comparison")
+		t := schema.add(&gqlType{kind: "INPUT_OBJECT", name: name, description: "Conditions on a " + scalar + " column"})
+		value := scalars[scalar]
+		if scalar != "JSON" {
+			t.inputFields = append(t.inputFields,
+				&gqlInputValue{name: "_eq", typ: value},
+				&gqlInputValue{name: "_neq", typ: value})
+			if scalar != "Boolean" {
+				t.inputFields = append(t.inputFields,
+					&gqlInputValue{name: "_gt", typ: value},
+					&gqlInputValue{name: "_gte", typ: value},
+					&gqlInputValue{name: "_lt", typ: value},
+					&gqlInputValue{name: "_lte", typ: value},
+					&gqlInputValue{name: "_in", typ: gqlList(gqlNonNull(value))},
+					&gqlInputValue{name: "_nin", typ: gqlList(gqlNonNull(value))})
+			}
+			if scalar == "String" {
+				t.inputFields = append(t.inputFields,
+					&gqlInputValue{name: "_like", typ: value},
+					&gqlInputValue{name: "_ilike", typ: value})
+			}
+		}
+		t.inputFields = append(t.inputFields, &gqlInputValue{name: "_is_null", typ: scalars["Boolean"]})
+		comparisons[scalar] = t
+		return t
+	}
+
+	// One object type, filter type and order type per table
+	var gqlTables []*gqlTable
+	byName := make(map[string]*gqlTable)
+	for _, info := range tables {
+		base := gqlTypeName(info.Name)
+		table := &gqlTable{info: info, columns: make(map[string]string)}
+		table.typ = schema.add(&gqlType{kind: "OBJECT", name: gqlUniqueName(typeNames, base),
+			description: fmt.Sprintf("A row of the %s %s", info.Name, info.Type)})
+		table.filter = schema.add(&gqlType{kind: "INPUT_OBJECT", name: gqlUniqueName(typeNames, base+"Filter"),
+			description: "Conditions on " + info.Name + " rows"})
+		table.orderBy = schema.add(&gqlType{kind: "INPUT_OBJECT", name: gqlUniqueName(typeNames, base+"OrderBy"),
+			description: "Sort order for " + info.Name + " rows"})
+		gqlTables = append(gqlTables, table)
+		byName[info.Name] = table
+	}
+
+	// Columns
+	fieldNames := make(map[*gqlTable]map[string]bool)
+	for _, table := range gqlTables {
+		used := map[string]bool{"__typename": true}
+		fieldNames[table] = used
+		for _, column := range table.info.Columns {
+			name := gqlUniqueName(used, gqlSanitize(column.Name))
+			scalar := s.gqlScalar(column.Type)
+			typ := scalars[scalar]
+			if column.NotNull || column.PrimaryKey {
+				typ = gqlNonNull(typ)
+			}
+			table.typ.fields = append(table.typ.fields, &gqlField{
+				name: name, typ: typ, kind: gqlColumnField, column: column.Name, scalar: scalar,
+				description: strings.TrimSpace(column.Type),
+			})
+			table.columns[name] = column.Name
+			table.filter.inputFields = append(table.filter.inputFields, &gqlInputValue{name: name, typ: comparison(scalar)})
+			table.orderBy.inputFields = append(table.orderBy.inputFields, &gqlInputValue{name: name, typ: orderDirection})
+		}
+		table.filter.inputFields = append(table.filter.inputFields,
+			&gqlInputValue{name: "_and", typ: gqlList(gqlNonNull(table.filter))},
+			&gqlInputValue{name: "_or", typ: gqlList(gqlNonNull(table.filter))},
+			&gqlInputValue{name: "_not", typ: table.filter})
+	}
+
+	// Arguments of fields that return a list of rows
+	listArgs := func(table *gqlTable) []*gqlInputValue {
+		return []*gqlInputValue{
+			{name: "where", typ: table.filter},
+			{name: "orderBy", typ: gqlList(gqlNonNull(table.orderBy))},
+			{name: "limit", typ: scalars["Int"]},
+			{name: "offset", typ: scalars["Int"]},
+		}
+	}
+
+	// Relations from foreign keys: the parent row on the child, the child rows on the parent
+	for _, child := range gqlTables {
+		for _, fk := range child.info.ForeignKeys {
+			parent := byName[fk.ReferencedTable]
+			if parent == nil {
+				continue
+			}
+			target := fk.ReferencedColumns
+			if len(target) == 0 || containsString(target, "") {
+				target = parent.info.PrimaryKey // SQLite: REFERENCES parent without columns
+			}
+			if len(target) != len(fk.Columns) {
+				continue
+			}
+
+			parentName := gqlSanitize(parent.info.Name)
+			if len(fk.Columns) == 1 {
+				lower := strings.ToLower(fk.Columns[0])
+				if strings.HasSuffix(lower, "_id") && len(lower) > 3 {
+					parentName = gqlSanitize(fk.Columns[0][:len(lower)-3])
+				}
+			}
+			child.typ.fields = append(child.typ.fields, &gqlField{
+				name: gqlUniqueName(fieldNames[child], parentName), typ: parent.typ,
+				kind: gqlParentField, table: parent, fk: fk, fkTarget: target,
+				description: fmt.Sprintf("The %s row referenced by %s", parent.info.Name, strings.Join(fk.Columns, ", ")),
+			})
+
+			childrenName := gqlSanitize(child.info.Name)
+			if countForeignKeys(child.info, parent.info.Name) > 1 {
+				childrenName = gqlSanitize(child.info.Name + "_by_" + strings.Join(fk.Columns, "_"))
+			}
+			parent.typ.fields = append(parent.typ.fields, &gqlField{
+				name: gqlUniqueName(fieldNames[parent], childrenName), typ: gqlNonNull(gqlList(gqlNonNull(child.typ))),
+				kind: gqlChildrenField, table: child, fk: fk, fkTarget: target, args: listArgs(child),
+				description: fmt.Sprintf("The %s rows that reference this row by %s", child.info.Name, strings.Join(fk.Columns, ", ")),
+			})
+		}
+	}
+
+	// Query root: rows of each table, and one row by primary key
+	schema.query = schema.add(&gqlType{kind: "OBJECT", name: "Query"})
+	rootNames := map[string]bool{"__typename": true, "__schema": true, "__type": true}
+	for _, table := range gqlTables {
+		name := gqlUniqueName(rootNames, gqlSanitize(table.info.Name))
+		schema.query.fields = append(schema.query.fields, &gqlField{
+			name: name, typ: gqlNonNull(gqlList(gqlNonNull(table.typ))), kind: gqlRowsField, table: table,
+			args: listArgs(table), description: "Rows of " + table.info.Name,
+		})
+		if len(table.info.PrimaryKey) == 0 {
+			continue
+		}
+		field := &gqlField{
+			name: gqlUniqueName(rootNames, name+"_by_pk"), typ: table.typ, kind: gqlByKeyField, table: table,
+			description: "One row of " + table.info.Name + " by primary key",
+		}
+		for _, key := range table.info.PrimaryKey {
+			for _, column := range table.typ.fields {
+				if column.kind == gqlColumnField && column.column == key {
+					field.args = append(field.args, &gqlInputValue{name: column.name, typ: gqlNonNull(scalars[column.scalar])})
+				}
+			}
+		}
+		schema.query.fields = append(schema.query.fields, field)
+	}
+
+	// API description endpoints that read rows, as JSON-valued fields
+	if s.apiDesc != nil {
+		for _, endpoint := range s.apiDesc.Endpoints {
+			method, ok := endpoint.Methods["GET"]
+			if !ok {
+				continue
+			}
+			if sqlQuery, err := s.methodSQL(method); err != nil || method.isExec(sqlQuery, s.dbType) {
+				continue
+			}
+			name := method.GraphQL
+			if name == "" {
+				name = gqlEndpointName(endpoint.Path)
+			}
+			if rootNames[name] {
+				log.Printf("Warning: GraphQL field %s for %s is already taken", name, endpoint.Path)
+				continue
+			}
+			rootNames[name] = true
+
+			field := &gqlField{name: name, typ: scalars["JSON"], kind: gqlEndpointField, method: method,
+				endpoint: endpoint.Path, description: method.Description}
+			pathParams := endpointPathParams(endpoint.Path)
+			for _, param := range method.Params {
+				typ := scalars["JSON"]
+				if containsString(pathParams, param) {
+					typ = gqlNonNull(typ)
+				}
+				field.args = append(field.args, &gqlInputValue{name: param, typ: typ})
+			}
+			schema.query.fields = append(schema.query.fields, field)
+		}
+	}
+	return schema
+}
+
+func countForeignKeys(table TableInfo, referencedTable string) int {
+	count := 0
+	for _, fk := range table.ForeignKeys {
+		if fk.ReferencedTable == referencedTable {
+			count++
+		}
+	}
+	return count
+}
+
+// Make a field name from an endpoint path: /clients/:id/orders -> clients_by_id_orders
+func gqlEndpointName(endpointPath string) string {
+	var parts []string
+	for _, segment := range strings.Split(endpointPath, "/") {
+		switch {
+		case segment == "":
+		case strings.HasPrefix(segment, ":"):
+			parts = append(parts, "by_"+segment[1:])
+		default:
+			parts = append(parts, segment)
+		}
+	}
+	return gqlSanitize(strings.Join(parts, "_"))
+}
+
+// The :param names in an endpoint path
+func endpointPathParams(endpointPath string) []string {
+	var params []string
+	for _, segment := range strings.Split(endpointPath, "/") {
+		if strings.HasPrefix(segment, ":") {
+			params = append(params, segment[1:])
+		}
+	}
+	return params
+}
+
+// Introspect the database and build the GraphQL schema when the API description or --graphql asks for it
+func (s *Server) setupGraphQL(enabled bool) error {
+	var config GraphQLConfig
+	if s.apiDesc != nil && s.apiDesc.GraphQL != nil {
+		config = *s.apiDesc.GraphQL
+	} else if !enabled {
+		return nil
+	}
+
+	tables, err := s.introspectTables()
+	if err != nil {
+		return err
+	}
+	var selected []TableInfo
+	for _, table := range tables {
+		if containsString(s.internalTables(), table.Name) {
+			continue
+		}
+		if len(config.Include) > 0 && !matchesAny(config.Include, table.Name) {
+			continue
+		}
+		if matchesAny(config.Exclude, table.Name) {
+			continue
+		}
+		selected = append(selected, table)
+	}
+
+	s.graphql = s.buildGraphQLSchema(selected)
+	log.Printf("GraphQL schema: %d table(s), %d query field(s)", len(selected), len(s.graphql.query.fields))
+	return nil
+}
+
+// ----- Introspection -----
+
+// Introspection values are maps of field values keyed by name, with "__typename" set.
+// A value can be a func() interface{} so that types referring to each other are only
+// expanded as far as the query selects.
+func (e *gqlExecutor) introspect(value interface{}, selections []*gqlSelection) (interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			if items[i], err = e.introspect(item, selections); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+
+	case map[string]interface{}:
+		typeName, _ := v["__typename"].(string)
+		if len(selections) == 0 {
+			return nil, fmt.Errorf("field of type %s must have a selection of subfields", typeName)
+		}
+		fields, err := e.collectFields(typeName, selections)
+		if err != nil {
+			return nil, err
+		}
+		object := newGQLObject()
+		for _, f := range fields {
+			fieldValue, ok := v[f.sel.name]
+			if !ok {
+				return nil, fmt.Errorf("cannot query field %q on type %q", f.sel.name, typeName)
+			}
+			if compute, ok := fieldValue.(func() interface{}); ok {
+				fieldValue = compute()
+			}
+			if fieldValue, err = e.introspect(fieldValue, f.selections); err != nil {
+				return nil, err
+			}
+			object.set(f.key, fieldValue)
+		}
+		return object, nil
+	}
+	return value, nil
+}
+
+func gqlNullable(text string) interface{} {
+	if text == "" {
+		return nil
+	}
+	return text
+}
+
+func (e *gqlExecutor) schemaIntrospection() map[string]interface{} {
+	return map[string]interface{}{
+		"__typename":       "__Schema",
+		"description":      nil,
+		"queryType":        func() interface{} { return e.typeIntrospection(e.schema.query) },
+		"mutationType":     nil,
+		"subscriptionType": nil,
+		"types": func() interface{} {
+			types := make([]interface{}, len(e.schema.names))
+			for i, name := range e.schema.names {
+				types[i] = e.typeIntrospection(e.schema.types[name])
+			}
+			return types
+		},
+		"directives": func() interface{} {
+			var directives []interface{}
+			for _, name := range []string{"include", "skip"} {
+				directives = append(directives, map[string]interface{}{
+					"__typename":   "__Directive",
+					"name":         name,
+					"description":  nil,
+					"locations":    []interface{}{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+					"isRepeatable": false,
+					"args": func() interface{} {
+						return []interface{}{e.inputValueIntrospection(&gqlInputValue{
+							name: "if", typ: gqlNonNull(e.schema.types["Boolean"])})}
+					},
+				})
+			}
+			return directives
+		},
+	}
+}
+
+func (e *gqlExecutor) typeIntrospection(t *gqlType) map[string]interface{} {
+	return map[string]interface{}{
+		"__typename":     "__Type",
+		"kind":           t.kind,
+		"name":           gqlNullable(t.name),
+		"description":    gqlNullable(t.description),
+		"specifiedByURL": nil,
+		"isOneOf":        false,
+		"possibleTypes":  nil,
+		"fields": func() interface{} {
+			if t.kind != "OBJECT" {
+				return nil
+			}
+			fields := make([]interface{}, len(t.fields))
+			for i, field := range t.fields {
+				fields[i] = e.fieldIntrospection(field)
+			}
+			return fields
+		},
+		"interfaces": func() interface{} {
+			if t.kind != "OBJECT" {
+				return nil
+			}
+			return []interface{}{}
+		},
+		"enumValues": func() interface{} {
+			if t.kind != "ENUM" {
+				return nil
+			}
+			values := make([]interface{}, len(t.enumValues))
+			for i, value := range t.enumValues {
+				values[i] = map[string]interface{}{
+					"__typename": "__EnumValue", "name": value, "description": nil,
+					"isDeprecated": false, "deprecationReason": nil,
+				}
+			}
+			return values
+		},
+		"inputFields": func() interface{} {
+			if t.kind != "INPUT_OBJECT" {
+				return nil
+			}
+			fields := make([]interface{}, len(t.inputFields))
+			for i, field := range t.inputFields {
+				fields[i] = e.inputValueIntrospection(field)
+			}
+			return fields
+		},
+		"ofType": func() interface{} {
+			if t.ofType == nil {
+				return nil
+			}
+			return e.typeIntrospection(t.ofType)
+		},
+	}
+}
+
+func (e *gqlExecutor) fieldIntrospection(field *gqlField) map[string]interface{} {
+	return map[string]interface{}{
+		"__typename":        "__Field",
+		"name":              field.name,
+		"description":       gqlNullable(field.description),
+		"isDeprecated":      false,
+		"deprecationReason": nil,
+		"type":              func() interface{} { return e.typeIntrospection(field.typ) },
+		"args": func() interface{} {
+			args := make([]interface{}, len(field.args))
+			for i, arg := range field.args {
+				args[i] = e.inputValueIntrospection(arg)
+			}
+			return args
+		},
+	}
+}
+
+func (e *gqlExecutor) inputValueIntrospection(value *gqlInputValue) map[string]interface{} {
+	return map[string]interface{}{
+		"__typename":        "__InputValue",
+		"name":              value.name,
+		"description":       gqlNullable(value.description),
+		"defaultValue":      nil,
+		"isDeprecated":      false,
+		"deprecationReason": nil,
+		"type":              func() interface{} { return e.typeIntrospection(value.typ) },
+	}
+}
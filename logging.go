@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ===== Logging =====
+
+// Header carrying the ID that ties a request's log lines together
+const requestIDHeader = "X-Request-ID"
+
+// Set up the default slog logger; log.Printf output goes through it too
+func setupLogging(format, level string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown log format %q (use text or json)", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// Per-request values carried in the request context
+type requestInfo struct {
+	id       string
+	clientIP string
+	proxied  bool // The peer is a trusted proxy
+	logger   *slog.Logger
+	identity string      // Who made the request, for the audit trail
+	template string      // Set by handlers for the request log
+	params   interface{} // Set by handlers for the request log
+	rows     *int64      // Set by handlers for the request log
+}
+
+type requestInfoKey struct{}
+
+// The values for a request's context; nil outside the log middleware
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// The logger for a request's context, tagged with its request ID
+func logger(ctx context.Context) *slog.Logger {
+	if info := requestInfoFrom(ctx); info != nil {
+		return info.logger
+	}
+	return slog.Default()
+}
+
+// The logger for a response, tagged with the request ID set on it by the log middleware
+func responseLogger(w http.ResponseWriter) *slog.Logger {
+	if id := w.Header().Get(requestIDHeader); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
+
+// Use the client's request ID if it is sensible, otherwise make one up
+func requestID(r *http.Request) string {
+	id := r.Header.Get(requestIDHeader)
+	if id != "" && len(id) <= 128 && strings.IndexFunc(id, func(c rune) bool { return c <= ' ' || c > '~' }) < 0 {
+		return id
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Parse a comma-separated list of trusted proxy addresses and CIDR ranges
+func parseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range splitList(list) {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// Whether an address belongs to a trusted proxy
+func (s *Server) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range s.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// The address of the peer that sent the request
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// The client's address: the peer, or when the peer is a trusted proxy, the last
+// X-Forwarded-For entry that wasn't added by a trusted proxy
+func (s *Server) resolveClientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !s.isTrustedProxy(ip) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !s.isTrustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// How much of an error response body is kept as its error message
+const maxErrorLength = 500
+
+// A response writer that remembers the status, counts the bytes written and keeps the start of an error body
+type accessRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	errors strings.Builder
+}
+
+func (a *accessRecorder) WriteHeader(statusCode int) {
+	if a.status == 0 {
+		a.status = statusCode
+	}
+	a.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (a *accessRecorder) Write(b []byte) (int, error) {
+	if a.status == 0 {
+		a.status = http.StatusOK
+	}
+	n, err := a.ResponseWriter.Write(b)
+	a.bytes += int64(n)
+	if a.status >= 400 && a.errors.Len() < maxErrorLength {
+		a.errors.Write(b[:min(n, maxErrorLength-a.errors.Len())])
+	}
+	return n, err
+}
+
+// Flush streamed responses, which the reverse proxy relies on
+func (a *accessRecorder) Flush() {
+	if flusher, ok := a.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Let the reverse proxy take over the connection for upgrades
+func (a *accessRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := a.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijacking not supported")
+	}
+	return hijacker.Hijack()
+}
+
+// Assign every request an ID and client address, and write an access log line when it completes
+func (s *Server) logMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		method, path := r.Method, redactedRequestURI(r.URL, s.secretParams())
+		info := &requestInfo{id: requestID(r), clientIP: s.resolveClientIP(r), proxied: s.isTrustedProxy(remoteIP(r))}
+		info.logger = slog.Default().With("request_id", info.id)
+		if s.audit != nil {
+			info.identity = s.audit.identity(r, info.proxied)
+		}
+
+		// Pass the ID on to proxied services and back to the client
+		r.Header.Set(requestIDHeader, info.id)
+		w.Header().Set(requestIDHeader, info.id)
+
+		recorder := &accessRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		info.logger.Info("Access",
+			"method", method,
+			"path", path,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"duration_ms", milliseconds(time.Since(start)),
+			"client_ip", info.clientIP,
+			"user_agent", r.UserAgent())
+
+		if s.requestLog == nil && s.recent == nil {
+			return
+		}
+		entry := requestLogEntry{
+			Time:       start,
+			RequestID:  info.id,
+			Method:     method,
+			Path:       path,
+			Template:   info.template,
+			Params:     redactValue(info.params, s.secretParams()),
+			Status:     recorder.status,
+			Rows:       info.rows,
+			DurationMs: milliseconds(time.Since(start)),
+			Error:      strings.TrimSpace(recorder.errors.String()),
+			ClientIP:   info.clientIP,
+		}
+		if s.requestLog != nil {
+			s.requestLog.record(entry)
+		}
+		if s.recent != nil && !s.isConsoleRequest(path) {
+			s.recent.add(entry)
+		}
+	})
+}
+
+// Param names whose values are never logged or recorded
+func (s *Server) secretParams() []string {
+	if s.redactParams == nil {
+		return defaultRedactedParams
+	}
+	return s.redactParams
+}
+
+// An error log for the standard library, tagged with the request ID
+func errorLog(ctx context.Context) *log.Logger {
+	return slog.NewLogLogger(logger(ctx).Handler(), slog.LevelError)
+}
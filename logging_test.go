@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"127.0.0.1, ::1", []string{"127.0.0.1/32", "::1/128"}, false},
+		{"10.0.0.0/8,fd00::/8", []string{"10.0.0.0/8", "fd00::/8"}, false},
+		{"10.1.2.3/8", []string{"10.0.0.0/8"}, false},
+		{"proxy.local", nil, true},
+		{"10.0.0.0/33", nil, true},
+	}
+	for _, tt := range tests {
+		nets, err := parseTrustedProxies(tt.list)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTrustedProxies(%q) error = %v, want error %v", tt.list, err, tt.wantErr)
+			continue
+		}
+		var got []string
+		for _, ipNet := range nets {
+			got = append(got, ipNet.String())
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("parseTrustedProxies(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestResolveClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies("127.0.0.1,::1,10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{trustedProxies: proxies}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string // X-Forwarded-For header lines
+		want       string
+	}{
+		{"direct client", "192.0.2.1:5000", nil, "192.0.2.1"},
+		{"direct client spoofing the header", "192.0.2.1:5000", []string{"203.0.113.9"}, "192.0.2.1"},
+		{"behind a proxy", "127.0.0.1:5000", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"behind an IPv6 proxy", "[::1]:5000", []string{"2001:db8::7"}, "2001:db8::7"},
+		{"proxy without the header", "127.0.0.1:5000", nil, "127.0.0.1"},
+		{"client-supplied entries are skipped", "127.0.0.1:5000", []string{"198.51.100.1, 203.0.113.9"}, "203.0.113.9"},
+		{"chain of trusted proxies", "127.0.0.1:5000", []string{"203.0.113.9, 10.0.0.5, 10.0.0.6"}, "203.0.113.9"},
+		{"several header lines", "127.0.0.1:5000", []string{"198.51.100.1", "203.0.113.9, 10.0.0.5"}, "203.0.113.9"},
+		{"every hop trusted", "127.0.0.1:5000", []string{"10.0.0.5"}, "10.0.0.5"},
+		{"garbage stops the walk", "127.0.0.1:5000", []string{"203.0.113.9, not-an-ip, 10.0.0.5"}, "10.0.0.5"},
+		{"empty entries", "127.0.0.1:5000", []string{" , 203.0.113.9 ,"}, "203.0.113.9"},
+		{"remote address without port", "192.0.2.1", nil, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, line := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", line)
+			}
+			if got := s.resolveClientIP(r); got != tt.want {
+				t.Errorf("resolveClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		header string
+		keep   bool
+	}{
+		{"abc-123", true},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+		{"with space", false},
+		{"naïve", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set(requestIDHeader, tt.header)
+		}
+		id := requestID(r)
+		if (id == tt.header) != tt.keep {
+			t.Errorf("requestID with header %q = %q, want it kept: %v", tt.header, id, tt.keep)
+		}
+		if !tt.keep && len(id) != 32 {
+			t.Errorf("generated request ID %q, want 32 hex digits", id)
+		}
+	}
+}
+
+func TestLogMiddlewareRequestID(t *testing.T) {
+	s := &Server{}
+	var seen string
+	handler := s.logMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(requestIDHeader)
+		if requestInfoFrom(r.Context()).id != seen {
+			t.Error("the request context carries a different ID")
+		}
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(requestIDHeader, "client-id")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if seen != "client-id" || w.Header().Get(requestIDHeader) != "client-id" {
+		t.Errorf("request ID passed on as %q and returned as %q, want the client's", seen, w.Header().Get(requestIDHeader))
+	}
+}
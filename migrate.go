@@ -0,0 +1,380 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== Schema Migrations =====
+
+// Migration files are named <version>_<name>[.<dialect>].<up|down>.sql, for example
+// 0001_create_clients.up.sql or 0002_add_index.postgres.up.sql. A dialect-specific
+// file takes precedence over the generic one for the same version and direction.
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_([^.]+)(?:\.(sqlite|postgres))?\.(up|down)\.sql$`)
+
+const migrationsTable = "schema_migrations"
+
+type Migration struct {
+	Version  string
+	Number   int // The version as a number, which orders the migrations
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of the up and down scripts
+
+	upChecksum string // SHA-256 of the up script alone, as recorded by earlier versions
+}
+
+// Whether a recorded checksum is this migration's. Checksums recorded before the down
+// script was included cover the up script only, and still count.
+func (m Migration) matches(checksum string) bool {
+	return checksum == m.Checksum || checksum == m.upChecksum
+}
+
+type AppliedMigration struct {
+	Version   string
+	Name      string
+	Checksum  string
+	AppliedAt string
+}
+
+// Load the migrations in a directory for the given database type, ordered by version
+func loadMigrations(dir string, dbType string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	type script struct {
+		sql      string
+		specific bool
+	}
+	byVersion := make(map[string]*Migration)
+	scripts := make(map[string]script) // "version/direction" -> best script so far
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		version, name, dialect, direction := m[1], m[2], m[3], m[4]
+		if dialect != "" && dialect != dbType {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		number, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has a version that is too large", entry.Name())
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Number: number, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration version %s is used by both %q and %q", version, migration.Name, name)
+		}
+
+		key := version + "/" + direction
+		if existing, ok := scripts[key]; ok && existing.specific && dialect == "" {
+			continue
+		}
+		scripts[key] = script{sql: string(data), specific: dialect != ""}
+	}
+
+	var migrations []Migration
+	for version, migration := range byVersion {
+		up, ok := scripts[version+"/up"]
+		if !ok {
+			return nil, fmt.Errorf("migration %s_%s has no up script for %s", version, migration.Name, dbType)
+		}
+		migration.Up = up.sql
+		migration.Down = scripts[version+"/down"].sql
+		// A NUL separates the scripts, which can't contain one
+		sum := sha256.Sum256([]byte(migration.Up + "\x00" + migration.Down))
+		migration.Checksum = hex.EncodeToString(sum[:])
+		upSum := sha256.Sum256([]byte(migration.Up))
+		migration.upChecksum = hex.EncodeToString(upSum[:])
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Number < migrations[j].Number
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Number == migrations[i-1].Number {
+			return nil, fmt.Errorf("migration versions %s and %s are the same number", migrations[i-1].Version, migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// Placeholder for the n-th (1-based) bind parameter in the server's dialect
+func (s *Server) bindVar(n int) string {
+	if s.dbType == "postgres" {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+func (s *Server) ensureMigrationsTable() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS ` + migrationsTable + ` (
+		version TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`)
+	return err
+}
+
+func (s *Server) appliedMigrations() (map[string]AppliedMigration, error) {
+	rows, err := s.db.Query(`SELECT version, name, checksum, applied_at FROM ` + migrationsTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[string]AppliedMigration)
+	for rows.Next() {
+		var a AppliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[a.Version] = a
+	}
+	return applied, rows.Err()
+}
+
+// Verify that no applied migration has been edited since it ran
+func verifyChecksums(migrations []Migration, applied map[string]AppliedMigration) error {
+	for _, m := range migrations {
+		if a, ok := applied[m.Version]; ok && !m.matches(a.Checksum) {
+			return fmt.Errorf("migration %s_%s has been modified since it was applied (checksum %s, recorded %s)",
+				m.Version, m.Name, m.Checksum[:12], a.Checksum[:min(12, len(a.Checksum))])
+		}
+	}
+	return nil
+}
+
+// Run a migration script and record (or remove) its version in one transaction
+func (s *Server) runMigration(m Migration, up bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script := m.Up
+	if !up {
+		script = m.Down
+	}
+	if _, err := tx.Exec(script); err != nil {
+		return err
+	}
+
+	if up {
+		_, err = tx.Exec(
+			fmt.Sprintf(`INSERT INTO %s (version, name, checksum, applied_at) VALUES (%s, %s, %s, %s)`,
+				migrationsTable, s.bindVar(1), s.bindVar(2), s.bindVar(3), s.bindVar(4)),
+			m.Version, m.Name, m.Checksum, time.Now().UTC().Format(time.RFC3339))
+	} else {
+		_, err = tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE version = %s`, migrationsTable, s.bindVar(1)), m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Apply all pending migrations in order, returning how many were applied
+func (s *Server) migrateUp(dir string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	migrations, err := loadMigrations(dir, s.dbType)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.ensureMigrationsTable(); err != nil {
+		return 0, fmt.Errorf("failed to create %s table: %w", migrationsTable, err)
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyChecksums(migrations, applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		log.Printf("Applying migration %s_%s", m.Version, m.Name)
+		if err := s.runMigration(m, true); err != nil {
+			return count, fmt.Errorf("migration %s_%s failed: %w", m.Version, m.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Roll back the most recently applied migrations
+func (s *Server) migrateDown(dir string, steps int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	migrations, err := loadMigrations(dir, s.dbType)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.ensureMigrationsTable(); err != nil {
+		return 0, fmt.Errorf("failed to create %s table: %w", migrationsTable, err)
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyChecksums(migrations, applied); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return count, fmt.Errorf("migration %s_%s has no down script", m.Version, m.Name)
+		}
+		log.Printf("Reverting migration %s_%s", m.Version, m.Name)
+		if err := s.runMigration(m, false); err != nil {
+			return count, fmt.Errorf("reverting migration %s_%s failed: %w", m.Version, m.Name, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Print the state of every migration
+func (s *Server) migrationStatus(dir string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	migrations, err := loadMigrations(dir, s.dbType)
+	if err != nil {
+		return err
+	}
+	if err := s.ensureMigrationsTable(); err != nil {
+		return err
+	}
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		state := "pending"
+		if a, ok := applied[m.Version]; ok {
+			state = "applied " + a.AppliedAt
+			if !m.matches(a.Checksum) {
+				state += " (MODIFIED)"
+			}
+		}
+		fmt.Printf("%s_%s: %s\n", m.Version, m.Name, state)
+	}
+	return nil
+}
+
+// Handle the "migrate" subcommand: migrate [up | down [n] | status]
+func runMigrateCommand(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dbPath := flags.String("db", "data.db", "Path to SQLite database file")
+	pgConnStr := flags.String("pg-conn", "", "PostgreSQL connection string (if provided, use PostgreSQL instead of SQLite)")
+	pgPort := flags.String("pg-port", "", "PostgreSQL port (optional, overrides port in --pg-conn if provided)")
+	extension := flags.String("extension", "", "Comma-separated SQLite extensions to load, each a path optionally followed by :entry_point")
+	requireExtensions := flags.Bool("require-extensions", false, "Fail when an extension fails to load instead of logging a warning")
+	dir := flags.String("migrations", "migrations", "Path to the migrations directory")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of %s migrate [up | down [n] | status]:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	// The flag package stops at the first argument that isn't a flag, so parse what follows
+	// each one again: flags may come after the command, as in "migrate up --migrations db"
+	var commandArgs []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		commandArgs = append(commandArgs, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	allowed := 1 // The command, and for "down" a step count
+	if len(commandArgs) > 0 && commandArgs[0] == "down" {
+		allowed = 2
+	}
+	if len(commandArgs) > allowed {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(commandArgs[allowed:], " "))
+	}
+
+	pg := defaultPostgresConfig()
+	pg.ConnStr, pg.Port = *pgConnStr, *pgPort
+	server, err := NewServer(*dbPath, pg, ExtensionConfig{Extensions: parseExtensions(*extension), Required: *requireExtensions}, "", false)
+	if err != nil {
+		return err
+	}
+	defer server.db.Close()
+
+	command := ""
+	if len(commandArgs) > 0 {
+		command = commandArgs[0]
+	}
+	switch command {
+	case "", "up":
+		count, err := server.migrateUp(*dir)
+		if err != nil {
+			return err
+		}
+		log.Printf("Applied %d migration(s)", count)
+	case "down":
+		steps := 1
+		if len(commandArgs) > 1 {
+			if steps, err = strconv.Atoi(commandArgs[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count: %s", commandArgs[1])
+			}
+		}
+		count, err := server.migrateDown(*dir, steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("Reverted %d migration(s)", count)
+	case "status":
+		return server.migrationStatus(*dir)
+	default:
+		return fmt.Errorf("unknown migrate command: %s", command)
+	}
+	return nil
+}
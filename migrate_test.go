@@ -0,0 +1,178 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"10_tenth.up.sql":               "CREATE TABLE tenth (a);",
+		"9_ninth.up.sql":                "CREATE TABLE ninth (a);",
+		"0002_second.up.sql":            "generic up",
+		"0002_second.sqlite.up.sql":     "sqlite up",
+		"0002_second.postgres.up.sql":   "postgres up",
+		"0002_second.down.sql":          "generic down",
+		"0002_second.postgres.down.sql": "postgres down",
+		"0001_first.up.sql":             "first up",
+		"0001_first.down.sql":           "first down",
+		"notes.txt":                     "not a migration",
+		"0003_third.postgres.up.sql":    "postgres only",
+		"0003_third.postgres.down.sql":  "postgres only down",
+	})
+
+	tests := []struct {
+		dialect      string
+		wantVersions []string
+		wantUp       string // Up script of 0002
+		wantDown     string // Down script of 0002
+	}{
+		{"sqlite", []string{"0001", "0002", "9", "10"}, "sqlite up", "generic down"},
+		{"postgres", []string{"0001", "0002", "0003", "9", "10"}, "postgres up", "postgres down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dialect, func(t *testing.T) {
+			migrations, err := loadMigrations(dir, tt.dialect)
+			if err != nil {
+				t.Fatalf("loadMigrations: %v", err)
+			}
+			var versions []string
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+			}
+			if strings.Join(versions, ",") != strings.Join(tt.wantVersions, ",") {
+				t.Errorf("versions = %v, want %v", versions, tt.wantVersions)
+			}
+			second := migrations[1]
+			if second.Up != tt.wantUp || second.Down != tt.wantDown {
+				t.Errorf("0002 scripts = %q / %q, want %q / %q", second.Up, second.Down, tt.wantUp, tt.wantDown)
+			}
+			if second.Number != 2 {
+				t.Errorf("0002 number = %d, want 2", second.Number)
+			}
+		})
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"missing up script", map[string]string{"0001_a.down.sql": "x"}, "has no up script"},
+		{"version used twice", map[string]string{"0001_a.up.sql": "x", "0001_b.up.sql": "y"}, "is used by both"},
+		{"same number", map[string]string{"1_a.up.sql": "x", "001_b.up.sql": "y"}, "are the same number"},
+		{"huge version", map[string]string{"99999999999999999999_a.up.sql": "x"}, "too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			_, err := loadMigrations(dir, "sqlite")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadMigrations error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrationChecksums(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"0001_clients.up.sql":   "CREATE TABLE clients (id INTEGER PRIMARY KEY);",
+		"0001_clients.down.sql": "DROP TABLE clients;",
+	})
+	s := newTestServer(t, "")
+	if n, err := s.migrateUp(dir); err != nil || n != 1 {
+		t.Fatalf("migrateUp = %d, %v; want 1 applied", n, err)
+	}
+	if n, err := s.migrateUp(dir); err != nil || n != 0 {
+		t.Fatalf("second migrateUp = %d, %v; want nothing to apply", n, err)
+	}
+
+	// Editing either script of an applied migration is refused
+	for _, file := range []string{"0001_clients.down.sql", "0001_clients.up.sql"} {
+		original, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, dir, map[string]string{file: string(original) + "\n-- edited"})
+		if _, err := s.migrateUp(dir); err == nil || !strings.Contains(err.Error(), "has been modified") {
+			t.Errorf("migrateUp after editing %s: error %v, want a modified migration", file, err)
+		}
+		writeFiles(t, dir, map[string]string{file: string(original)})
+	}
+
+	// A checksum recorded from the up script alone, as earlier versions did, still matches
+	migrations, err := loadMigrations(dir, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec("UPDATE "+migrationsTable+" SET checksum = ?", migrations[0].upChecksum); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.migrateUp(dir); err != nil {
+		t.Errorf("migrateUp with an up-only checksum: %v", err)
+	}
+
+	if n, err := s.migrateDown(dir, 1); err != nil || n != 1 {
+		t.Fatalf("migrateDown = %d, %v; want 1 reverted", n, err)
+	}
+	if n := queryInt(t, s, "SELECT count(*) FROM sqlite_master WHERE name = 'clients'"); n != 0 {
+		t.Error("the down script didn't run")
+	}
+}
+
+func TestRunMigrateCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"0001_a.up.sql":   "CREATE TABLE a (id INTEGER);",
+		"0001_a.down.sql": "DROP TABLE a;",
+		"0002_b.up.sql":   "CREATE TABLE b (id INTEGER);",
+		"0002_b.down.sql": "DROP TABLE b;",
+	})
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	tables := func() int {
+		db, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE name IN ('a', 'b')").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	steps := []struct {
+		args       []string
+		wantTables int
+		wantErr    string
+	}{
+		{[]string{"--db", dbPath, "--migrations", dir, "up"}, 2, ""},
+		{[]string{"down", "--db", dbPath, "--migrations", dir}, 1, ""},
+		{[]string{"--db", dbPath, "down", "1", "--migrations", dir}, 0, ""},
+		{[]string{"up", "--migrations", dir, "--db", dbPath}, 2, ""},
+		{[]string{"down", "0", "--db", dbPath, "--migrations", dir}, 2, "invalid step count"},
+		{[]string{"up", "extra", "--db", dbPath, "--migrations", dir}, 2, "unexpected arguments: extra"},
+		{[]string{"sideways", "--db", dbPath, "--migrations", dir}, 2, "unknown migrate command"},
+	}
+	for _, step := range steps {
+		err := runMigrateCommand(step.args)
+		switch {
+		case step.wantErr == "" && err != nil:
+			t.Fatalf("migrate %v: %v", step.args, err)
+		case step.wantErr != "" && (err == nil || !strings.Contains(err.Error(), step.wantErr)):
+			t.Fatalf("migrate %v: error %v, want one containing %q", step.args, err, step.wantErr)
+		}
+		if n := tables(); n != step.wantTables {
+			t.Fatalf("after migrate %v: %d tables, want %d", step.args, n, step.wantTables)
+		}
+	}
+}
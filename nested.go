@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ===== Nested Queries =====
+
+// Run a method's nested queries and store each one's shaped result in every row under its name.
+//
+// A nested query with a "join" runs once, restricted to the parents' join keys; its rows are
+// matched to each parent row on the join columns. Without one it runs for every parent row,
+// and its params are taken from the parent row's columns first, then from the parent's params.
+// Either way, each parent row gets at most the child's row limit.
+func (s *Server) nestResults(ctx context.Context, rows []map[string]interface{}, nested map[string]MethodDefinition, paramValue func(string) interface{}, types TypeMapping) error {
+	if len(rows) == 0 || len(nested) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(nested))
+	for name := range nested {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := nested[name]
+		sqlQuery, err := s.methodSQL(child)
+		if err != nil {
+			return fmt.Errorf("nested query %s: %v", name, err)
+		}
+		childTypes := types.Merge(child.Types)
+
+		limit := s.rowLimit(child.MaxRows)
+
+		if len(child.Join) > 0 {
+			filtered, keyValues := joinFilter(sqlQuery, child.Join, rows)
+			if filtered == "" {
+				// No parent row has a key to match, so no child row can match either
+				for _, row := range rows {
+					if row[name], err = shapeNested(&queryResult{}, nil, child); err != nil {
+						return fmt.Errorf("nested query %s: %v", name, err)
+					}
+				}
+				continue
+			}
+			keyNames := make([]string, 0, len(keyValues))
+			for key := range keyValues {
+				keyNames = append(keyNames, key)
+			}
+			childValue := func(param string) interface{} {
+				if value, ok := keyValues[param]; ok {
+					return value
+				}
+				return paramValue(param)
+			}
+			childQuery, childParams := bindNamed(filtered, s.dbType, append(append([]string{}, child.Params...), keyNames...), childValue)
+			result, err := s.runQuery(ctx, childQuery, childParams, childTypes, 0)
+			if err != nil {
+				return fmt.Errorf("nested query %s: %v", name, err)
+			}
+			childRows := result.maps()
+			if err := s.nestResults(ctx, childRows, child.Nested, paramValue, childTypes); err != nil {
+				return err
+			}
+
+			// The row limit applies to each parent's children, as it does without a join
+			for _, row := range rows {
+				matched := &queryResult{Columns: result.Columns}
+				var matchedRows []map[string]interface{}
+				for i, childRow := range childRows {
+					if limit > 0 && len(matchedRows) == limit {
+						break
+					}
+					if joinMatches(child.Join, row, childRow) {
+						matched.Rows = append(matched.Rows, result.Rows[i])
+						matchedRows = append(matchedRows, childRow)
+					}
+				}
+				if row[name], err = shapeNested(matched, matchedRows, child); err != nil {
+					return fmt.Errorf("nested query %s: %v", name, err)
+				}
+			}
+			continue
+		}
+
+		for _, row := range rows {
+			rowValue := func(param string) interface{} {
+				if value, ok := row[param]; ok {
+					return value
+				}
+				return paramValue(param)
+			}
+			childQuery, childParams := bindNamed(sqlQuery, s.dbType, child.Params, rowValue)
+			result, err := s.runQuery(ctx, childQuery, childParams, childTypes, limit)
+			if err != nil {
+				return fmt.Errorf("nested query %s: %v", name, err)
+			}
+			childRows := result.maps()
+			if err := s.nestResults(ctx, childRows, child.Nested, rowValue, childTypes); err != nil {
+				return err
+			}
+			if row[name], err = shapeNested(result, childRows, child); err != nil {
+				return fmt.Errorf("nested query %s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Shape a nested result: no rows gives [] rather than null, and a missing "single" row gives null
+func shapeNested(result *queryResult, rows []map[string]interface{}, child MethodDefinition) (interface{}, error) {
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	data, _, err := shapeResult(result, rows, child.Result, child.Column)
+	return data, err
+}
+
+// Check whether a child row matches a parent row on every join column
+func joinMatches(join map[string]string, parent, child map[string]interface{}) bool {
+	for childColumn, parentColumn := range join {
+		parentValue, childValue := parent[parentColumn], child[childColumn]
+		if parentValue == nil || childValue == nil {
+			return false
+		}
+		// Compare as text so an integer key matches the same key read as a string
+		if fmt.Sprint(parentValue) != fmt.Sprint(childValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// Restrict a nested query to the rows whose join columns hold one of the parent rows' keys.
+// Returns the wrapped query, with a named param per key value, and the values of those params;
+// the query is "" when no parent row has a complete key.
+func joinFilter(sqlQuery string, join map[string]string, parents []map[string]interface{}) (string, map[string]interface{}) {
+	childColumns := make([]string, 0, len(join))
+	for childColumn := range join {
+		childColumns = append(childColumns, childColumn)
+	}
+	sort.Strings(childColumns)
+
+	values := make(map[string]interface{})
+	seen := make(map[string]bool)
+	var conditions []string
+	for _, parent := range parents {
+		key := make([]interface{}, len(childColumns))
+		complete := true
+		for i, childColumn := range childColumns {
+			if key[i] = parent[join[childColumn]]; key[i] == nil {
+				complete = false
+				break
+			}
+		}
+		if !complete {
+			continue
+		}
+		// Keys are compared as text, as joinMatches does
+		text := make([]string, len(key))
+		for i, value := range key {
+			text[i] = fmt.Sprint(value)
+		}
+		if seen[strings.Join(text, "\x00")] {
+			continue
+		}
+		seen[strings.Join(text, "\x00")] = true
+
+		terms := make([]string, len(childColumns))
+		for i, childColumn := range childColumns {
+			param := fmt.Sprintf("join_key_%d", len(values)+1)
+			values[param] = key[i]
+			terms[i] = "nested." + quoteIdent(childColumn) + " = :" + param
+		}
+		conditions = append(conditions, "("+strings.Join(terms, " AND ")+")")
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	// The newline ends a trailing line comment in the child query
+	inner := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(sqlQuery), ";"))
+	return "SELECT * FROM (" + inner + "\n) AS nested WHERE " + strings.Join(conditions, " OR "), values
+}
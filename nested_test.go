@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestJoinMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		join   map[string]string
+		parent map[string]interface{}
+		child  map[string]interface{}
+		want   bool
+	}{
+		{"same key", map[string]string{"client_id": "id"}, map[string]interface{}{"id": int64(1)}, map[string]interface{}{"client_id": int64(1)}, true},
+		{"different key", map[string]string{"client_id": "id"}, map[string]interface{}{"id": int64(1)}, map[string]interface{}{"client_id": int64(2)}, false},
+		{"integer and text", map[string]string{"client_id": "id"}, map[string]interface{}{"id": int64(7)}, map[string]interface{}{"client_id": "7"}, true},
+		{"null parent", map[string]string{"client_id": "id"}, map[string]interface{}{"id": nil}, map[string]interface{}{"client_id": nil}, false},
+		{"missing child column", map[string]string{"client_id": "id"}, map[string]interface{}{"id": int64(1)}, map[string]interface{}{}, false},
+		{"composite", map[string]string{"a": "x", "b": "y"},
+			map[string]interface{}{"x": "k", "y": int64(2)}, map[string]interface{}{"a": "k", "b": int64(2)}, true},
+		{"composite, one differs", map[string]string{"a": "x", "b": "y"},
+			map[string]interface{}{"x": "k", "y": int64(2)}, map[string]interface{}{"a": "k", "b": int64(3)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := joinMatches(tt.join, tt.parent, tt.child); got != tt.want {
+				t.Errorf("joinMatches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinFilter(t *testing.T) {
+	parents := []map[string]interface{}{
+		{"id": int64(1), "region": "eu"},
+		{"id": int64(2), "region": "us"},
+		{"id": int64(1), "region": "eu"}, // Duplicate key
+		{"id": nil, "region": "eu"},      // Incomplete key
+	}
+	query, values := joinFilter("SELECT * FROM orders -- all of them;\n;", map[string]string{"client_id": "id", "region": "region"}, parents)
+	want := `SELECT * FROM (SELECT * FROM orders -- all of them;` + "\n" + `) AS nested WHERE ` +
+		`(nested."client_id" = :join_key_1 AND nested."region" = :join_key_2) OR (nested."client_id" = :join_key_3 AND nested."region" = :join_key_4)`
+	if query != want {
+		t.Errorf("query\n got: %q\nwant: %q", query, want)
+	}
+	if len(values) != 4 || values["join_key_3"] != int64(2) || values["join_key_4"] != "us" {
+		t.Errorf("values = %v", values)
+	}
+
+	if query, _ := joinFilter("SELECT 1", map[string]string{"client_id": "id"}, parents[3:]); query != "" {
+		t.Errorf("query without any key = %q, want none", query)
+	}
+}
+
+func TestNestResults(t *testing.T) {
+	s := newTestServer(t, `
+		CREATE TABLE clients (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE orders (id INTEGER PRIMARY KEY, client_id INTEGER, total REAL);
+		INSERT INTO clients VALUES (1, 'Acme'), (2, 'Globex'), (3, 'Initech');
+		INSERT INTO orders VALUES (1, 1, 10), (2, 1, 20), (3, 1, 30), (4, 2, 40), (5, 4, 50);
+		CREATE TABLE queries (n INTEGER);
+		INSERT INTO queries VALUES (0);`)
+
+	parents := func() []map[string]interface{} {
+		return []map[string]interface{}{
+			{"id": int64(1), "name": "Acme"},
+			{"id": int64(2), "name": "Globex"},
+			{"id": int64(3), "name": "Initech"},
+		}
+	}
+	encode := func(rows []map[string]interface{}, name string) string {
+		var values []interface{}
+		for _, row := range rows {
+			values = append(values, row[name])
+		}
+		data, _ := json.Marshal(values)
+		return string(data)
+	}
+
+	tests := []struct {
+		name    string
+		maxRows int // Server row limit
+		child   MethodDefinition
+		want    string
+	}{
+		{"join", 0, MethodDefinition{SQL: "SELECT id, client_id FROM orders ORDER BY id", Join: map[string]string{"client_id": "id"}},
+			`[[{"client_id":1,"id":1},{"client_id":1,"id":2},{"client_id":1,"id":3}],[{"client_id":2,"id":4}],[]]`},
+		{"join column not selected", 0, MethodDefinition{SQL: "SELECT id FROM orders", Join: map[string]string{"client_id": "id"}}, ""},
+		{"join within limit", 2, MethodDefinition{SQL: "SELECT id, client_id FROM orders ORDER BY id", Join: map[string]string{"client_id": "id"}, Result: "column", Column: "id"},
+			`[[1,2],[4],[]]`},
+		{"join scalar", 0, MethodDefinition{SQL: "SELECT client_id, sum(total) AS total FROM orders GROUP BY client_id", Join: map[string]string{"client_id": "id"}, Result: "scalar", Column: "total"},
+			`[60,40,null]`},
+		{"per row", 0, MethodDefinition{SQL: "SELECT id FROM orders WHERE client_id = :id ORDER BY id", Params: []string{"id"}, Result: "column"},
+			`[[1,2,3],[4],[]]`},
+		{"per row with limit", 2, MethodDefinition{SQL: "SELECT id FROM orders WHERE client_id = :id ORDER BY id", Params: []string{"id"}, Result: "column"},
+			`[[1,2],[4],[]]`},
+		{"per row single", 0, MethodDefinition{SQL: "SELECT total FROM orders WHERE client_id = :id ORDER BY total DESC LIMIT 1", Params: []string{"id"}, Result: "single"},
+			`[{"total":30},{"total":40},null]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.maxRows = tt.maxRows
+			rows := parents()
+			err := s.nestResults(context.Background(), rows, map[string]MethodDefinition{"orders": tt.child},
+				func(string) interface{} { return nil }, TypeMapping{})
+			if tt.want == "" {
+				if err == nil {
+					t.Fatal("nestResults succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("nestResults: %v", err)
+			}
+			if got := encode(rows, "orders"); got != tt.want {
+				t.Errorf("orders = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ===== PostgreSQL Connections =====
+
+// How often the connection to PostgreSQL is checked once the server runs
+const pgHealthInterval = 15 * time.Second
+
+// Longest wait between two connection attempts at startup
+const pgMaxRetryDelay = 10 * time.Second
+
+// Connection and pool settings for PostgreSQL
+type PostgresConfig struct {
+	ConnStr         string        // URL or key=value DSN; empty to use SQLite
+	Port            string        // Overrides the port in ConnStr
+	MaxOpenConns    int           // 0 for no limit
+	MaxIdleConns    int           // Connections kept open while unused
+	ConnMaxLifetime time.Duration // Connections are replaced after this long (0 keeps them)
+	ConnMaxIdleTime time.Duration // Unused connections are closed after this long (0 keeps them)
+	ConnectTimeout  time.Duration // How long to keep retrying the first connection at startup
+}
+
+func defaultPostgresConfig() PostgresConfig {
+	return PostgresConfig{
+		MaxOpenConns:    10,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+		ConnectTimeout:  30 * time.Second,
+	}
+}
+
+// Parse a connection string, a postgres:// URL or key=value pairs, into its parameters
+func parsePgConnStr(connStr string) (map[string]string, error) {
+	if strings.HasPrefix(connStr, "postgres://") || strings.HasPrefix(connStr, "postgresql://") {
+		converted, err := pq.ParseURL(connStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PostgreSQL URL: %w", err)
+		}
+		connStr = converted
+	}
+	return parsePgKeyValues(connStr)
+}
+
+// Parse key=value pairs the way libpq does: values may be single-quoted, and a backslash
+// escapes the next character
+func parsePgKeyValues(connStr string) (map[string]string, error) {
+	params := make(map[string]string)
+	s := []rune(connStr)
+	i := 0
+	skipSpace := func() {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n' || s[i] == '\r') {
+			i++
+		}
+	}
+	for {
+		skipSpace()
+		if i >= len(s) {
+			return params, nil
+		}
+		start := i
+		for i < len(s) && s[i] != '=' && s[i] != ' ' && s[i] != '\t' {
+			i++
+		}
+		key := string(s[start:i])
+		skipSpace()
+		if i >= len(s) || s[i] != '=' || key == "" {
+			return nil, fmt.Errorf("invalid PostgreSQL connection string: expected key=value near %q", key)
+		}
+		i++
+		skipSpace()
+
+		var value strings.Builder
+		quoted := i < len(s) && s[i] == '\''
+		if quoted {
+			i++
+		}
+		for ; i < len(s); i++ {
+			c := s[i]
+			if c == '\\' && i+1 < len(s) {
+				i++
+				value.WriteRune(s[i])
+				continue
+			}
+			if quoted && c == '\'' {
+				break
+			}
+			if !quoted && (c == ' ' || c == '\t' || c == '\n' || c == '\r') {
+				break
+			}
+			value.WriteRune(c)
+		}
+		if quoted {
+			if i >= len(s) {
+				return nil, fmt.Errorf("invalid PostgreSQL connection string: unterminated quote in %s", key)
+			}
+			i++
+		}
+		params[key] = value.String()
+	}
+}
+
+// Format parameters as a key=value connection string, quoting every value
+func formatPgConnStr(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	escaper := strings.NewReplacer(`'`, `\'`, `\`, `\\`)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "='" + escaper.Replace(params[key]) + "'"
+	}
+	return strings.Join(pairs, " ")
+}
+
+// The connection string to open, with the port override applied
+func (c PostgresConfig) dsn() (string, error) {
+	params, err := parsePgConnStr(c.ConnStr)
+	if err != nil {
+		return "", err
+	}
+	if c.Port != "" {
+		params["port"] = c.Port
+	}
+	return formatPgConnStr(params), nil
+}
+
+// Where the connection string points, without the password, e.g. "steampipe@localhost:9193/steampipe"
+func (c PostgresConfig) describe() string {
+	params, err := parsePgConnStr(c.ConnStr)
+	if err != nil {
+		return "invalid connection string"
+	}
+	if c.Port != "" {
+		params["port"] = c.Port
+	}
+	host, port := params["host"], params["port"]
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "5432"
+	}
+	target := host + ":" + port + "/" + params["dbname"]
+	if params["user"] != "" {
+		target = params["user"] + "@" + target
+	}
+	return target
+}
+
+// Open the PostgreSQL pool and wait for the database to accept connections
+func openPostgres(config PostgresConfig) (*sql.DB, error) {
+	dsn, err := config.dsn()
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+
+	if err := pingWithBackoff(db, config.ConnectTimeout); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Ping until the database answers, waiting twice as long after each failure, and give up
+// once the next attempt would start after limit
+func pingWithBackoff(db *sql.DB, limit time.Duration) error {
+	deadline := time.Now().Add(limit)
+	delay := 250 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("Connected to PostgreSQL after %d attempts", attempt)
+			}
+			return nil
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("PostgreSQL is not reachable after %d attempt(s): %w", attempt, err)
+		}
+		log.Printf("Warning: PostgreSQL is not reachable (attempt %d), retrying in %s: %v", attempt, delay, err)
+		time.Sleep(delay)
+		delay = min(delay*2, pgMaxRetryDelay)
+	}
+}
+
+// Check the database periodically and log when it goes away and comes back. The pool
+// replaces broken connections on its own; the ping also gets it to do so before a
+// request would.
+func (s *Server) watchDatabase() {
+	var lost time.Time
+	for range time.Tick(pgHealthInterval) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := s.db.PingContext(ctx)
+		cancel()
+		switch {
+		case err != nil && lost.IsZero():
+			lost = time.Now()
+			log.Printf("Warning: lost the connection to PostgreSQL: %v", err)
+		case err == nil && !lost.IsZero():
+			log.Printf("Reconnected to PostgreSQL after %s", time.Since(lost).Round(time.Second))
+			lost = time.Time{}
+		}
+	}
+}
+
+// Connection pool statistics
+type PoolStats struct {
+	Database           string  `json:"database"` // "sqlite" or "postgres"
+	Target             string  `json:"target,omitempty"`
+	Healthy            bool    `json:"healthy"`
+	Error              string  `json:"error,omitempty"`
+	MaxOpenConnections int     `json:"maxOpenConnections"`
+	OpenConnections    int     `json:"openConnections"`
+	InUse              int     `json:"inUse"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"waitCount"`
+	WaitDurationMs     float64 `json:"waitDurationMs"`
+	MaxIdleClosed      int64   `json:"maxIdleClosed"`
+	MaxIdleTimeClosed  int64   `json:"maxIdleTimeClosed"`
+	MaxLifetimeClosed  int64   `json:"maxLifetimeClosed"`
+}
+
+// GET /admin/pool reports whether the database answers and how the connection pool is used
+func (s *Server) handlePool(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendErrorResponse(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	err := s.db.PingContext(ctx)
+
+	stats := s.db.Stats()
+	result := PoolStats{
+		Database:           s.dbType,
+		Target:             s.dbTarget,
+		Healthy:            err == nil,
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     float64(stats.WaitDuration.Microseconds()) / 1000,
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	s.sendJSONResponse(w, result, http.StatusOK)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Rate and Concurrency Limits =====
+
+// RateLimitConfig is a token bucket per client: each client may make Burst requests at once,
+// refilled at Rate requests per second.
+type RateLimitConfig struct {
+	Rate  float64 `json:"rate"`            // Requests per second (0 disables the limit)
+	Burst int     `json:"burst,omitempty"` // Bucket size (default: Rate rounded up, at least 1)
+	Key   string  `json:"key,omitempty"`   // "ip" (default), "apiKey" (X-API-Key header) or "header:<Name>"
+
+	APIKeys []string `json:"apiKeys,omitempty"` // Keys a client can be identified by with the "apiKey" key
+}
+
+// ConcurrencyConfig caps how many requests an endpoint executes at once
+type ConcurrencyConfig struct {
+	Max            int `json:"max"`                      // Concurrent executions allowed
+	QueueTimeoutMs int `json:"queueTimeoutMs,omitempty"` // How long to wait for a slot (0 rejects at once)
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per client key
+type rateLimiter struct {
+	config  RateLimitConfig
+	burst   float64
+	apiKeys map[string]bool
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	pruned  time.Time
+}
+
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	burst := float64(config.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(config.Rate))
+	}
+	apiKeys := make(map[string]bool)
+	for _, key := range config.APIKeys {
+		apiKeys[key] = true
+	}
+	return &rateLimiter{config: config, burst: burst, apiKeys: apiKeys, buckets: make(map[string]*tokenBucket)}
+}
+
+// Take a token for a client, or report how long until one is available
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.config.Rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - bucket.tokens) / l.config.Rate * float64(time.Second))
+	return false, wait
+}
+
+// Forget clients whose buckets have refilled, at most once a minute
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < time.Minute {
+		return
+	}
+	l.pruned = now
+	refill := time.Duration(l.burst / l.config.Rate * float64(time.Second))
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) > refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Find the key identifying a request's client. A client could dodge its limit by sending a
+// new value each time, so only configured API keys count, and headers only when a trusted
+// proxy set them; everyone else is limited by IP.
+func (l *rateLimiter) clientKey(r *http.Request) string {
+	switch {
+	case l.config.Key == "apiKey":
+		if key := r.Header.Get("X-API-Key"); key != "" && l.apiKeys[key] {
+			return "apiKey:" + apiKeyFingerprint(key)
+		}
+	case strings.HasPrefix(l.config.Key, "header:"):
+		if value := r.Header.Get(strings.TrimPrefix(l.config.Key, "header:")); value != "" && fromTrustedProxy(r) {
+			return "header:" + value
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+// A short, stable stand-in for an API key in logs and records
+func apiKeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// The address a request came from, as resolved by the log middleware when it ran
+func clientIP(r *http.Request) string {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.clientIP
+	}
+	return remoteIP(r)
+}
+
+// Whether a request reached the server through a trusted proxy, whose headers about the client are believed
+func fromTrustedProxy(r *http.Request) bool {
+	info := requestInfoFrom(r.Context())
+	return info != nil && info.proxied
+}
+
+// Check a request against a limiter, answering 429 with Retry-After when it is over the limit
+func (l *rateLimiter) check(w http.ResponseWriter, r *http.Request) bool {
+	ok, retryAfter := l.take(r)
+	if ok {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	sendErrorResponse(w, "Too many requests", http.StatusTooManyRequests)
+	return false
+}
+
+// Take a token for the request's client. When none is left, returns false and the seconds
+// until one is.
+func (l *rateLimiter) take(r *http.Request) (bool, int) {
+	key := l.clientKey(r)
+	ok, wait := l.allow(key, time.Now())
+	if ok {
+		return true, 0
+	}
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	logger(r.Context()).Warn("rate limit exceeded", "key", key, "path", r.URL.Path, "retry_after", retryAfter)
+	return false, retryAfter
+}
+
+// concurrencyLimiter hands out a fixed number of execution slots
+type concurrencyLimiter struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+}
+
+func newConcurrencyLimiter(config ConcurrencyConfig) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		slots:        make(chan struct{}, config.Max),
+		queueTimeout: time.Duration(config.QueueTimeoutMs) * time.Millisecond,
+	}
+}
+
+// Take a slot, waiting up to the queue timeout; the caller must release it
+func (c *concurrencyLimiter) acquire(ctx context.Context) bool {
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if c.queueTimeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(c.queueTimeout)
+	defer timer.Stop()
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *concurrencyLimiter) release() {
+	<-c.slots
+}
+
+// Build the global limiter and the per-endpoint limiters
+func (s *Server) setupLimits(global RateLimitConfig) error {
+	if global.Rate > 0 {
+		if err := validateRateLimit(global); err != nil {
+			return err
+		}
+		s.rateLimit = newRateLimiter(global)
+	}
+
+	s.endpointRateLimits = make(map[string]*rateLimiter)
+	s.endpointSlots = make(map[string]*concurrencyLimiter)
+	if s.apiDesc == nil {
+		return nil
+	}
+	for _, endpoint := range s.apiDesc.Endpoints {
+		if endpoint.RateLimit != nil && endpoint.RateLimit.Rate > 0 {
+			config := *endpoint.RateLimit
+			if config.APIKeys == nil {
+				config.APIKeys = global.APIKeys
+			}
+			if err := validateRateLimit(config); err != nil {
+				return fmt.Errorf("%s: %v", endpoint.Path, err)
+			}
+			s.endpointRateLimits[endpoint.Path] = newRateLimiter(config)
+		}
+		if endpoint.Concurrency != nil && endpoint.Concurrency.Max > 0 {
+			s.endpointSlots[endpoint.Path] = newConcurrencyLimiter(*endpoint.Concurrency)
+		}
+	}
+	return nil
+}
+
+func validateRateLimit(config RateLimitConfig) error {
+	if config.Key != "" && config.Key != "ip" && config.Key != "apiKey" &&
+		!(strings.HasPrefix(config.Key, "header:") && len(config.Key) > len("header:")) {
+		return fmt.Errorf("unknown rate limit key %q", config.Key)
+	}
+	if config.Key == "apiKey" && len(config.APIKeys) == 0 {
+		return fmt.Errorf("rate limits by apiKey need the list of valid apiKeys")
+	}
+	return nil
+}
+
+// Apply the global rate limit to everything but static files
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.rateLimit != nil && s.isDynamicPath(r.URL.Path) && !s.rateLimit.check(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Check whether a request path is served from the database or the proxy rather than from files
+func (s *Server) isDynamicPath(requestPath string) bool {
+	switch {
+	case requestPath == "/query", requestPath == "/schema", requestPath == "/graphql", strings.HasPrefix(requestPath, "/proxy/"):
+		return true
+	}
+	return s.apiDesc != nil && s.isAPIPath(requestPath)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter(RateLimitConfig{Rate: 2, Burst: 3})
+
+	// (offset from start, want allowed, want wait)
+	steps := []struct {
+		at      time.Duration
+		allowed bool
+		wait    time.Duration
+	}{
+		{0, true, 0}, // The burst is available at once
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, 500 * time.Millisecond}, // Empty: one token takes 1/rate
+		{250 * time.Millisecond, false, 250 * time.Millisecond},
+		{500 * time.Millisecond, true, 0}, // Refilled one token
+		{500 * time.Millisecond, false, 500 * time.Millisecond},
+		{time.Hour, true, 0}, // Refills up to the burst, no further
+		{time.Hour, true, 0},
+		{time.Hour, true, 0},
+		{time.Hour, false, 500 * time.Millisecond},
+	}
+	for i, step := range steps {
+		allowed, wait := l.allow("client", start.Add(step.at))
+		if allowed != step.allowed || wait != step.wait {
+			t.Errorf("step %d at %v: allow = %v, %v; want %v, %v", i, step.at, allowed, wait, step.allowed, step.wait)
+		}
+	}
+
+	// Every client has a bucket of its own
+	if allowed, _ := l.allow("other", start.Add(time.Hour)); !allowed {
+		t.Error("another client was limited by the first one's bucket")
+	}
+}
+
+func TestRateLimiterDefaults(t *testing.T) {
+	tests := []struct {
+		config RateLimitConfig
+		burst  float64
+	}{
+		{RateLimitConfig{Rate: 0.5}, 1},
+		{RateLimitConfig{Rate: 2.5}, 3},
+		{RateLimitConfig{Rate: 10, Burst: 4}, 4},
+	}
+	for _, tt := range tests {
+		if l := newRateLimiter(tt.config); l.burst != tt.burst {
+			t.Errorf("newRateLimiter(%+v).burst = %v, want %v", tt.config, l.burst, tt.burst)
+		}
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter(RateLimitConfig{Rate: 1, Burst: 2})
+	l.allow("a", start)
+	l.allow("b", start.Add(60*time.Second))
+	l.allow("c", start.Add(61*time.Second)) // Prunes a, whose bucket has long refilled, but not b
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("a refilled bucket was kept")
+	}
+	if len(l.buckets) != 2 {
+		t.Errorf("%d buckets, want b and c", len(l.buckets))
+	}
+}
+
+func TestRateLimitClientKey(t *testing.T) {
+	proxies, err := parseTrustedProxies("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{trustedProxies: proxies}
+
+	tests := []struct {
+		name       string
+		key        string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"ip", "", "192.0.2.1:5000", nil, "ip:192.0.2.1"},
+		{"ip behind proxy", "ip", "127.0.0.1:5000", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "ip:198.51.100.7"},
+		{"known api key", "apiKey", "192.0.2.1:5000", map[string]string{"X-API-Key": "k1"}, "apiKey:" + apiKeyFingerprint("k1")},
+		{"unknown api key", "apiKey", "192.0.2.1:5000", map[string]string{"X-API-Key": "made-up"}, "ip:192.0.2.1"},
+		{"header from proxy", "header:X-User", "127.0.0.1:5000", map[string]string{"X-User": "alice"}, "header:alice"},
+		{"header from client", "header:X-User", "192.0.2.1:5000", map[string]string{"X-User": "alice"}, "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(RateLimitConfig{Rate: 1, Key: tt.key, APIKeys: []string{"k1"}})
+			r := httptest.NewRequest("GET", "/query", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			var got string
+			s.logMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = l.clientKey(r)
+			})).ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("clientKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	s := &Server{rateLimit: newRateLimiter(RateLimitConfig{Rate: 0.5, Burst: 1})}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.rateLimitMiddleware(next).ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	if w := get("/schema"); w.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", w.Code)
+	}
+	w := get("/schema")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("second request: status %d, Retry-After %q; want 429 after 2 seconds", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := get("/app.js"); w.Code != http.StatusOK {
+		t.Errorf("static file: status %d, want it unlimited", w.Code)
+	}
+}
+
+func TestValidateRateLimit(t *testing.T) {
+	tests := []struct {
+		config  RateLimitConfig
+		wantErr bool
+	}{
+		{RateLimitConfig{Rate: 1}, false},
+		{RateLimitConfig{Rate: 1, Key: "header:X-User"}, false},
+		{RateLimitConfig{Rate: 1, Key: "header:"}, true},
+		{RateLimitConfig{Rate: 1, Key: "cookie"}, true},
+		{RateLimitConfig{Rate: 1, Key: "apiKey"}, true},
+		{RateLimitConfig{Rate: 1, Key: "apiKey", APIKeys: []string{"k"}}, false},
+	}
+	for _, tt := range tests {
+		if err := validateRateLimit(tt.config); (err != nil) != tt.wantErr {
+			t.Errorf("validateRateLimit(%+v) error = %v, want error %v", tt.config, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	c := newConcurrencyLimiter(ConcurrencyConfig{Max: 1, QueueTimeoutMs: 20})
+	if !c.acquire(context.Background()) {
+		t.Fatal("the free slot wasn't granted")
+	}
+	if c.acquire(context.Background()) {
+		t.Fatal("a second slot was granted")
+	}
+
+	// A waiting request gets the slot when it is released within the queue timeout
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		c.release()
+	}()
+	if !c.acquire(context.Background()) {
+		t.Error("the released slot wasn't granted to the waiting request")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if c.acquire(ctx) {
+		t.Error("a canceled request got a slot")
+	}
+	noQueue := newConcurrencyLimiter(ConcurrencyConfig{Max: 1})
+	noQueue.acquire(context.Background())
+	if noQueue.acquire(context.Background()) {
+		t.Error("a request got a slot without a queue")
+	}
+}
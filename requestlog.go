@@ -0,0 +1,240 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ===== Request Log =====
+
+// Name the request log database is attached under, so it can be queried as request_log.requests
+const requestLogSchema = "request_log"
+
+// Param names containing any of these are recorded as "[REDACTED]"
+var defaultRedactedParams = []string{"password", "passwd", "secret", "token", "apikey", "api_key", "auth", "credential",
+	"access_key", "private_key", "*key"}
+
+const requestLogSQL = `
+CREATE TABLE IF NOT EXISTS requests (
+	id          INTEGER PRIMARY KEY,
+	time        TEXT NOT NULL,
+	request_id  TEXT NOT NULL,
+	method      TEXT NOT NULL,
+	path        TEXT NOT NULL,
+	template    TEXT,
+	params      TEXT,
+	status      INTEGER NOT NULL,
+	rows        INTEGER,
+	duration_ms REAL NOT NULL,
+	error       TEXT,
+	client_ip   TEXT
+);
+CREATE INDEX IF NOT EXISTS requests_time ON requests(time);
+CREATE INDEX IF NOT EXISTS requests_template ON requests(template);`
+
+// One completed request
+type requestLogEntry struct {
+	Time       time.Time   `json:"time"`
+	RequestID  string      `json:"requestId"`
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	Template   string      `json:"template,omitempty"` // Endpoint path the request matched, e.g. /clients/:id
+	Params     interface{} `json:"params,omitempty"`   // Already redacted
+	Status     int         `json:"status"`
+	Rows       *int64      `json:"rows"` // Rows returned or affected, when the handler knows
+	DurationMs float64     `json:"durationMs"`
+	Error      string      `json:"error,omitempty"`
+	ClientIP   string      `json:"clientIp"`
+}
+
+// Writes entries to a SQLite database of its own in the background, so requests never wait on it
+type requestLog struct {
+	db        *sql.DB
+	path      string
+	retention time.Duration // Entries older than this are deleted; 0 keeps them all
+	entries   chan requestLogEntry
+}
+
+func openRequestLog(path string, retention time.Duration) (*requestLog, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(requestLogSQL); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create request log table: %w", err)
+	}
+
+	l := &requestLog{
+		db:        db,
+		path:      path,
+		retention: retention,
+		entries:   make(chan requestLogEntry, 1000),
+	}
+	l.prune()
+	go l.run()
+	return l, nil
+}
+
+// Queue an entry; when the writer can't keep up, entries are dropped rather than slowing requests
+func (l *requestLog) record(entry requestLogEntry) {
+	select {
+	case l.entries <- entry:
+	default:
+		slog.Warn("request log is full, dropping entry", "request_id", entry.RequestID)
+	}
+}
+
+// Write queued entries in batches and prune old ones once an hour
+func (l *requestLog) run() {
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+	for {
+		select {
+		case entry := <-l.entries:
+			batch := []requestLogEntry{entry}
+			for len(batch) < 100 && len(l.entries) > 0 {
+				batch = append(batch, <-l.entries)
+			}
+			if err := l.write(batch); err != nil {
+				slog.Error("writing request log failed", "error", err, "entries", len(batch))
+			}
+		case <-prune.C:
+			l.prune()
+		}
+	}
+}
+
+func (l *requestLog) write(batch []requestLogEntry) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO requests
+		(time, request_id, method, path, template, params, status, rows, duration_ms, error, client_ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, entry := range batch {
+		var params sql.NullString
+		if entry.Params != nil {
+			data, err := json.Marshal(entry.Params)
+			if err != nil {
+				return err
+			}
+			params = sql.NullString{String: string(data), Valid: true}
+		}
+		if _, err := stmt.Exec(
+			entry.Time.UTC().Format(time.RFC3339Nano), entry.RequestID, entry.Method, entry.Path,
+			nullString(entry.Template), params, entry.Status, entry.Rows, entry.DurationMs,
+			nullString(entry.Error), nullString(entry.ClientIP),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete entries older than the retention period
+func (l *requestLog) prune() {
+	if l.retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-l.retention).UTC().Format(time.RFC3339Nano)
+	res, err := l.db.Exec(`DELETE FROM requests WHERE time < ?`, cutoff)
+	if err != nil {
+		slog.Error("pruning request log failed", "error", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("Pruned %d request log entries", n)
+	}
+}
+
+// Whether a param's value must not be stored: its name contains a pattern, or ends with
+// one that starts with "*"
+func isSecret(name string, patterns []string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(name, suffix) {
+				return true
+			}
+		} else if strings.Contains(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy a value with secret params redacted and uploaded files replaced by their size
+func redactValue(value interface{}, patterns []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for name, item := range v {
+			if isSecret(name, patterns) {
+				redacted[name] = "[REDACTED]"
+			} else {
+				redacted[name] = redactValue(item, patterns)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactValue(item, patterns)
+		}
+		return redacted
+	case []byte:
+		return fmt.Sprintf("<%d bytes>", len(v))
+	}
+	return value
+}
+
+// The path and query of a request URL, with the values of secret-looking query params redacted
+func redactedRequestURI(u *url.URL, patterns []string) string {
+	if u.RawQuery == "" {
+		return u.RequestURI()
+	}
+	pairs := strings.Split(u.RawQuery, "&")
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(key); err == nil && isSecret(name, patterns) {
+			pairs[i] = key + "=%5BREDACTED%5D"
+		}
+	}
+	return u.EscapedPath() + "?" + strings.Join(pairs, "&")
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// Note what a request matched and which params it used, for the request log and audit trail
+func (info *requestInfo) note(template string, params interface{}) {
+	if info != nil {
+		info.template = template
+		info.params = params
+	}
+}
+
+// Note how many rows a request returned or affected, for the request log
+func (info *requestInfo) noteRows(n int64) {
+	if info != nil {
+		info.rows = &n
+	}
+}
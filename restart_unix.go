@@ -0,0 +1,25 @@
+//go:build !windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"syscall"
+)
+
+// The server can restart itself to apply a changed API description
+const canRestart = true
+
+// Replace the running server with a fresh copy of itself, started with the same arguments
+func restartServer() {
+	executable, err := os.Executable()
+	if err != nil {
+		log.Printf("Warning: failed to restart: %v", err)
+		return
+	}
+	log.Printf("Dev: restarting to apply the API description")
+	if err := syscall.Exec(executable, os.Args, os.Environ()); err != nil {
+		log.Printf("Warning: failed to restart: %v", err)
+	}
+}
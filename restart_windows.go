@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+// Windows can't replace a running process, so a changed API description waits for a manual restart
+const canRestart = false
+
+func restartServer() {}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ===== Schema Introspection =====
+
+type SchemaInfo struct {
+	DBType string      `json:"dbType"`
+	Tables []TableInfo `json:"tables"` // Ordinary and virtual tables
+	Views  []TableInfo `json:"views"`
+}
+
+type TableInfo struct {
+	Schema      string           `json:"schema,omitempty"`
+	Name        string           `json:"name"`
+	Type        string           `json:"type"`             // "table", "view" or "virtual"
+	Module      string           `json:"module,omitempty"` // Virtual table module (SQLite) or foreign server (Postgres)
+	Columns     []ColumnInfo     `json:"columns"`
+	PrimaryKey  []string         `json:"primaryKey"`
+	ForeignKeys []ForeignKeyInfo `json:"foreignKeys"`
+	Indexes     []IndexInfo      `json:"indexes"`
+	Triggers    []TriggerInfo    `json:"triggers"`
+}
+
+type ColumnInfo struct {
+	Name       string  `json:"name"`
+	Type       string  `json:"type"`
+	NotNull    bool    `json:"notNull"`
+	Default    *string `json:"default"`
+	PrimaryKey bool    `json:"primaryKey"`
+}
+
+type ForeignKeyInfo struct {
+	Name              string   `json:"name,omitempty"`
+	Columns           []string `json:"columns"`
+	ReferencedTable   string   `json:"referencedTable"`
+	ReferencedColumns []string `json:"referencedColumns"`
+	OnUpdate          string   `json:"onUpdate"`
+	OnDelete          string   `json:"onDelete"`
+}
+
+type IndexInfo struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"` // Expression columns are reported as ""
+	Unique  bool     `json:"unique"`
+	Primary bool     `json:"primary"`
+}
+
+type TriggerInfo struct {
+	Name   string   `json:"name"`
+	Timing string   `json:"timing,omitempty"`
+	Events []string `json:"events,omitempty"`
+	SQL    string   `json:"sql"`
+}
+
+func (t TableInfo) hasColumn(name string) bool {
+	for _, column := range t.Columns {
+		if column.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Read every user table and view with its columns, keys, indexes and triggers
+func (s *Server) introspectTables() ([]TableInfo, error) {
+	defer s.lockDB()()
+
+	if s.dbType == "postgres" {
+		return introspectPostgresTables(s.db)
+	}
+	return introspectSQLiteTables(s.db)
+}
+
+// Read the whole schema, split into tables and views
+func (s *Server) introspectSchema() (SchemaInfo, error) {
+	tables, err := s.introspectTables()
+	if err != nil {
+		return SchemaInfo{}, err
+	}
+	schema := SchemaInfo{DBType: s.dbType, Tables: []TableInfo{}, Views: []TableInfo{}}
+	for _, table := range tables {
+		if table.Type == "view" {
+			schema.Views = append(schema.Views, table)
+		} else {
+			schema.Tables = append(schema.Tables, table)
+		}
+	}
+	return schema, nil
+}
+
+// Handle GET /schema
+func (s *Server) handleSchema(w http.ResponseWriter, r *http.Request) {
+	logger(r.Context()).Debug("Schema", "path", r.URL.Path)
+
+	if r.Method != "GET" {
+		sendErrorResponse(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	schema, err := s.introspectSchema()
+	if err != nil {
+		sendErrorResponse(w, fmt.Sprintf("Failed to read schema: %v", err), http.StatusInternalServerError)
+		return
+	}
+	s.sendJSONResponse(w, schema, http.StatusOK)
+}
+
+// Collect all rows of a query as strings (NULL becomes nil). Rows are read completely
+// before returning, which matters on SQLite where only one connection is open.
+func queryStrings(db *sql.DB, query string, args ...interface{}) ([][]*string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var result [][]*string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make([]*string, len(columns))
+		for i, v := range values {
+			if v.Valid {
+				str := v.String
+				row[i] = &str
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+func str(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+// ===== SQLite =====
+
+func introspectSQLiteTables(db *sql.DB) ([]TableInfo, error) {
+	objectRows, err := queryStrings(db, `SELECT type, name, tbl_name, sql FROM sqlite_master
+		WHERE name NOT LIKE 'sqlite\_%' ESCAPE '\' ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	var tables []TableInfo
+	triggers := make(map[string][]TriggerInfo)
+	for _, row := range objectRows {
+		objectType, name, tableName, createSQL := str(row[0]), str(row[1]), str(row[2]), str(row[3])
+		switch objectType {
+		case "table", "view":
+			table := TableInfo{Name: name, Type: objectType}
+			if upper := strings.ToUpper(createSQL); strings.HasPrefix(upper, "CREATE VIRTUAL TABLE") {
+				table.Type = "virtual"
+				if i := strings.Index(upper, " USING "); i >= 0 {
+					module := strings.TrimSpace(createSQL[i+len(" USING "):])
+					table.Module = strings.ToLower(strings.FieldsFunc(module, func(r rune) bool { return r == '(' || r == ' ' })[0])
+				}
+			}
+			tables = append(tables, table)
+		case "trigger":
+			timing, events := parseSQLiteTrigger(createSQL)
+			triggers[tableName] = append(triggers[tableName], TriggerInfo{Name: name, Timing: timing, Events: events, SQL: createSQL})
+		}
+	}
+
+	// Drop the shadow tables virtual tables keep their data in, as SQLite reports them. A
+	// table that merely shares a virtual table's name prefix is kept.
+	shadowRows, err := queryStrings(db, `SELECT name FROM pragma_table_list WHERE schema = 'main' AND type = 'shadow'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shadow tables: %w", err)
+	}
+	shadows := make(map[string]bool)
+	for _, row := range shadowRows {
+		shadows[str(row[0])] = true
+	}
+	filtered := tables[:0]
+	for _, table := range tables {
+		if !shadows[table.Name] {
+			filtered = append(filtered, table)
+		}
+	}
+	tables = filtered
+
+	// Eponymous virtual tables registered by loaded extensions (such as Steampipe's) have no
+	// sqlite_master entry; find them by comparing the module list with a bare connection's
+	modules, err := extensionModules(db)
+	if err != nil {
+		log.Printf("Warning: failed to list extension modules: %v", err)
+	}
+	eponymous := make(map[string]bool)
+	for _, module := range modules {
+		if !containsTable(tables, module) {
+			eponymous[module] = true
+			tables = append(tables, TableInfo{Name: module, Type: "virtual", Module: module})
+		}
+	}
+
+	for i := range tables {
+		if err := describeSQLiteTable(db, &tables[i]); err != nil {
+			return nil, err
+		}
+		tables[i].Triggers = append([]TriggerInfo{}, triggers[tables[i].Name]...)
+	}
+
+	// Extension modules that can't be queried without arguments have no columns
+	result := tables[:0]
+	for _, table := range tables {
+		if !eponymous[table.Name] || len(table.Columns) > 0 {
+			result = append(result, table)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func containsTable(tables []TableInfo, name string) bool {
+	for _, table := range tables {
+		if table.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Modules available on db that a fresh connection without extensions doesn't have
+func extensionModules(db *sql.DB) ([]string, error) {
+	bare, err := openMemoryDatabase()
+	if err != nil {
+		return nil, err
+	}
+	defer bare.Close()
+
+	builtinRows, err := queryStrings(bare, `SELECT name FROM pragma_module_list`)
+	if err != nil {
+		return nil, err
+	}
+	builtin := make(map[string]bool)
+	for _, row := range builtinRows {
+		builtin[str(row[0])] = true
+	}
+
+	moduleRows, err := queryStrings(db, `SELECT name FROM pragma_module_list ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	var modules []string
+	for _, row := range moduleRows {
+		// Pragma table-valued functions register as modules when first used on a connection
+		if name := str(row[0]); !builtin[name] && !strings.HasPrefix(name, "pragma_") {
+			modules = append(modules, name)
+		}
+	}
+	return modules, nil
+}
+
+// Fill in columns, primary key, foreign keys and indexes of a SQLite table
+func describeSQLiteTable(db *sql.DB, table *TableInfo) error {
+	table.PrimaryKey = []string{}
+	table.ForeignKeys = []ForeignKeyInfo{}
+	table.Indexes = []IndexInfo{}
+
+	columnRows, err := queryStrings(db, `SELECT name, type, "notnull", dflt_value, pk FROM pragma_table_info(?) ORDER BY cid`, table.Name)
+	if err != nil {
+		if table.Type == "virtual" {
+			// The module needs arguments, so it isn't an eponymous table
+			return nil
+		}
+		return fmt.Errorf("failed to read columns of %s: %w", table.Name, err)
+	}
+	pkColumns := make(map[string]string)
+	for _, columnRow := range columnRows {
+		column := ColumnInfo{
+			Name:       str(columnRow[0]),
+			Type:       str(columnRow[1]),
+			NotNull:    str(columnRow[2]) == "1",
+			Default:    columnRow[3],
+			PrimaryKey: str(columnRow[4]) != "0",
+		}
+		if column.PrimaryKey {
+			pkColumns[str(columnRow[4])] = column.Name
+		}
+		table.Columns = append(table.Columns, column)
+	}
+	// pk holds the 1-based position of the column within the primary key
+	for i := 1; i <= len(pkColumns); i++ {
+		table.PrimaryKey = append(table.PrimaryKey, pkColumns[fmt.Sprint(i)])
+	}
+
+	if table.Type != "table" {
+		return nil
+	}
+
+	fkRows, err := queryStrings(db, `SELECT id, "table", "from", "to", on_update, on_delete
+		FROM pragma_foreign_key_list(?) ORDER BY id, seq`, table.Name)
+	if err != nil {
+		return fmt.Errorf("failed to read foreign keys of %s: %w", table.Name, err)
+	}
+	lastID := ""
+	for _, fkRow := range fkRows {
+		if id := str(fkRow[0]); id != lastID || len(table.ForeignKeys) == 0 {
+			lastID = id
+			table.ForeignKeys = append(table.ForeignKeys, ForeignKeyInfo{
+				ReferencedTable: str(fkRow[1]),
+				OnUpdate:        str(fkRow[4]),
+				OnDelete:        str(fkRow[5]),
+			})
+		}
+		fk := &table.ForeignKeys[len(table.ForeignKeys)-1]
+		fk.Columns = append(fk.Columns, str(fkRow[2]))
+		// "to" is NULL when the key references the parent's primary key implicitly
+		fk.ReferencedColumns = append(fk.ReferencedColumns, str(fkRow[3]))
+	}
+
+	indexRows, err := queryStrings(db, `SELECT name, "unique", origin FROM pragma_index_list(?) ORDER BY name`, table.Name)
+	if err != nil {
+		return fmt.Errorf("failed to read indexes of %s: %w", table.Name, err)
+	}
+	for _, indexRow := range indexRows {
+		index := IndexInfo{Name: str(indexRow[0]), Unique: str(indexRow[1]) == "1", Primary: str(indexRow[2]) == "pk", Columns: []string{}}
+		infoRows, err := queryStrings(db, `SELECT name FROM pragma_index_info(?) ORDER BY seqno`, index.Name)
+		if err != nil {
+			return fmt.Errorf("failed to read index %s: %w", index.Name, err)
+		}
+		for _, infoRow := range infoRows {
+			index.Columns = append(index.Columns, str(infoRow[0]))
+		}
+		table.Indexes = append(table.Indexes, index)
+	}
+	return nil
+}
+
+// ===== Postgres =====
+
+// Referential action codes used in pg_constraint
+var pgReferentialActions = map[string]string{
+	"a": "NO ACTION", "r": "RESTRICT", "c": "CASCADE", "n": "SET NULL", "d": "SET DEFAULT",
+}
+
+func introspectPostgresTables(db *sql.DB) ([]TableInfo, error) {
+	// Every schema on the search path, which includes Steampipe's plugin schemas
+	tableRows, err := queryStrings(db, `SELECT t.table_schema, t.table_name, t.table_type, ft.foreign_server_name
+		FROM information_schema.tables t
+		LEFT JOIN information_schema.foreign_tables ft
+			ON ft.foreign_table_schema = t.table_schema AND ft.foreign_table_name = t.table_name
+		WHERE t.table_schema = ANY(current_schemas(false))
+		ORDER BY array_position(current_schemas(false), t.table_schema::name), t.table_name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	var tables []TableInfo
+	seen := make(map[string]bool)
+	for _, tableRow := range tableRows {
+		table := TableInfo{Schema: str(tableRow[0]), Name: str(tableRow[1]), Type: "table", Module: str(tableRow[3])}
+		if seen[table.Name] {
+			// Shadowed by a table earlier on the search path
+			continue
+		}
+		seen[table.Name] = true
+		switch strings.ToUpper(str(tableRow[2])) {
+		case "VIEW":
+			table.Type = "view"
+		case "FOREIGN", "FOREIGN TABLE":
+			table.Type = "virtual"
+		}
+
+		if err := describePostgresTable(db, &table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// Read the timing and event of a SQLite trigger from its CREATE TRIGGER statement, named as
+// Postgres names them: "BEFORE" (SQLite's default), "AFTER" or "INSTEAD OF", and one of
+// "INSERT", "UPDATE" or "DELETE"
+func parseSQLiteTrigger(createSQL string) (string, []string) {
+	timing, event := "BEFORE", ""
+	done := false
+	scanSQL(createSQL, "sqlite", func(word string, quoted bool) {
+		if done || quoted {
+			return
+		}
+		switch word = strings.ToUpper(word); word {
+		case "BEFORE", "AFTER":
+			timing = word
+		case "INSTEAD":
+			timing = "INSTEAD OF"
+		case "INSERT", "UPDATE", "DELETE":
+			event = word
+		case "ON":
+			done = event != ""
+		}
+	})
+	if event == "" {
+		return "", nil
+	}
+	return timing, []string{event}
+}
+
+// Fill in columns, primary key, foreign keys, indexes and triggers of a Postgres table
+func describePostgresTable(db *sql.DB, table *TableInfo) error {
+	table.PrimaryKey = []string{}
+	table.ForeignKeys = []ForeignKeyInfo{}
+	table.Indexes = []IndexInfo{}
+	table.Triggers = []TriggerInfo{}
+
+	columnRows, err := queryStrings(db, `SELECT column_name, data_type, is_nullable, column_default
+		FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2
+		ORDER BY ordinal_position`, table.Schema, table.Name)
+	if err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table.Name, err)
+	}
+
+	pkRows, err := queryStrings(db, `SELECT kcu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+			ON tc.constraint_name = kcu.constraint_name
+			AND tc.table_schema = kcu.table_schema
+			AND tc.table_name = kcu.table_name
+		WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = $1 AND tc.table_name = $2
+		ORDER BY kcu.ordinal_position`, table.Schema, table.Name)
+	if err != nil {
+		return fmt.Errorf("failed to read primary key of %s: %w", table.Name, err)
+	}
+	for _, pkRow := range pkRows {
+		table.PrimaryKey = append(table.PrimaryKey, str(pkRow[0]))
+	}
+
+	for _, columnRow := range columnRows {
+		column := ColumnInfo{
+			Name:    str(columnRow[0]),
+			Type:    str(columnRow[1]),
+			NotNull: str(columnRow[2]) == "NO",
+			Default: columnRow[3],
+		}
+		column.PrimaryKey = containsString(table.PrimaryKey, column.Name)
+		table.Columns = append(table.Columns, column)
+	}
+
+	if table.Type != "table" {
+		return nil
+	}
+
+	fkRows, err := queryStrings(db, `SELECT c.conname, a.attname, rt.relname, ra.attname, c.confupdtype::text, c.confdeltype::text
+		FROM pg_constraint c
+		JOIN pg_class t ON t.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN pg_class rt ON rt.oid = c.confrelid
+		CROSS JOIN LATERAL unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(col, refcol, ord)
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.col
+		JOIN pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = k.refcol
+		WHERE c.contype = 'f' AND n.nspname = $1 AND t.relname = $2
+		ORDER BY c.conname, k.ord`, table.Schema, table.Name)
+	if err != nil {
+		return fmt.Errorf("failed to read foreign keys of %s: %w", table.Name, err)
+	}
+	for _, fkRow := range fkRows {
+		name := str(fkRow[0])
+		if len(table.ForeignKeys) == 0 || table.ForeignKeys[len(table.ForeignKeys)-1].Name != name {
+			table.ForeignKeys = append(table.ForeignKeys, ForeignKeyInfo{
+				Name:            name,
+				ReferencedTable: str(fkRow[2]),
+				OnUpdate:        pgReferentialActions[str(fkRow[4])],
+				OnDelete:        pgReferentialActions[str(fkRow[5])],
+			})
+		}
+		fk := &table.ForeignKeys[len(table.ForeignKeys)-1]
+		fk.Columns = append(fk.Columns, str(fkRow[1]))
+		fk.ReferencedColumns = append(fk.ReferencedColumns, str(fkRow[3]))
+	}
+
+	indexRows, err := queryStrings(db, `SELECT i.relname, ix.indisunique::text, ix.indisprimary::text, a.attname
+		FROM pg_index ix
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		CROSS JOIN LATERAL unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+		LEFT JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE n.nspname = $1 AND t.relname = $2
+		ORDER BY i.relname, k.ord`, table.Schema, table.Name)
+	if err != nil {
+		return fmt.Errorf("failed to read indexes of %s: %w", table.Name, err)
+	}
+	for _, indexRow := range indexRows {
+		name := str(indexRow[0])
+		if len(table.Indexes) == 0 || table.Indexes[len(table.Indexes)-1].Name != name {
+			table.Indexes = append(table.Indexes, IndexInfo{
+				Name:    name,
+				Unique:  str(indexRow[1]) == "true",
+				Primary: str(indexRow[2]) == "true",
+				Columns: []string{},
+			})
+		}
+		index := &table.Indexes[len(table.Indexes)-1]
+		index.Columns = append(index.Columns, str(indexRow[3]))
+	}
+
+	triggerRows, err := queryStrings(db, `SELECT trigger_name, action_timing, event_manipulation, action_statement
+		FROM information_schema.triggers
+		WHERE event_object_schema = $1 AND event_object_table = $2
+		ORDER BY trigger_name, event_manipulation`, table.Schema, table.Name)
+	if err != nil {
+		return fmt.Errorf("failed to read triggers of %s: %w", table.Name, err)
+	}
+	for _, triggerRow := range triggerRows {
+		name := str(triggerRow[0])
+		if len(table.Triggers) == 0 || table.Triggers[len(table.Triggers)-1].Name != name {
+			table.Triggers = append(table.Triggers, TriggerInfo{Name: name, Timing: str(triggerRow[1]), SQL: str(triggerRow[3])})
+		}
+		trigger := &table.Triggers[len(table.Triggers)-1]
+		trigger.Events = append(trigger.Events, str(triggerRow[2]))
+	}
+	return nil
+}
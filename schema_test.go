@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSQLiteTrigger(t *testing.T) {
+	tests := []struct {
+		sql        string
+		wantTiming string
+		wantEvents []string
+	}{
+		{"CREATE TRIGGER t AFTER INSERT ON orders BEGIN SELECT 1; END", "AFTER", []string{"INSERT"}},
+		{"create trigger t before delete on orders begin select 1; end", "BEFORE", []string{"DELETE"}},
+		{"CREATE TRIGGER t UPDATE OF total, status ON orders BEGIN SELECT 1; END", "BEFORE", []string{"UPDATE"}},
+		{"CREATE TEMP TRIGGER IF NOT EXISTS t INSTEAD OF UPDATE ON order_view BEGIN SELECT 1; END", "INSTEAD OF", []string{"UPDATE"}},
+		{`CREATE TRIGGER "after insert" AFTER DELETE ON "on" BEGIN INSERT INTO log VALUES ('before update'); END`, "AFTER", []string{"DELETE"}},
+		{"CREATE TRIGGER before_insert AFTER UPDATE ON t FOR EACH ROW WHEN new.a > 1 BEGIN DELETE FROM u; END", "AFTER", []string{"UPDATE"}},
+		{"CREATE TRIGGER t /* before */ AFTER -- delete\n INSERT ON t BEGIN SELECT 1; END", "AFTER", []string{"INSERT"}},
+	}
+	for _, tt := range tests {
+		timing, events := parseSQLiteTrigger(tt.sql)
+		if timing != tt.wantTiming || !reflect.DeepEqual(events, tt.wantEvents) {
+			t.Errorf("parseSQLiteTrigger(%q) = %q %v, want %q %v", tt.sql, timing, events, tt.wantTiming, tt.wantEvents)
+		}
+	}
+}
+
+func TestIntrospectSQLiteTriggers(t *testing.T) {
+	s := newTestServer(t, `
+		CREATE TABLE orders (id INTEGER PRIMARY KEY, total REAL);
+		CREATE TABLE log (note TEXT);
+		CREATE TRIGGER orders_audit AFTER UPDATE OF total ON orders BEGIN INSERT INTO log VALUES ('changed'); END;
+		CREATE TRIGGER orders_check BEFORE INSERT ON orders BEGIN SELECT 1; END;`)
+	tables, err := s.introspectTables()
+	if err != nil {
+		t.Fatalf("introspectTables: %v", err)
+	}
+	for _, table := range tables {
+		if table.Name != "orders" {
+			continue
+		}
+		var got []TriggerInfo
+		for _, trigger := range table.Triggers {
+			got = append(got, TriggerInfo{Name: trigger.Name, Timing: trigger.Timing, Events: trigger.Events})
+		}
+		want := []TriggerInfo{
+			{Name: "orders_audit", Timing: "AFTER", Events: []string{"UPDATE"}},
+			{Name: "orders_check", Timing: "BEFORE", Events: []string{"INSERT"}},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("triggers = %+v, want %+v", got, want)
+		}
+		return
+	}
+	t.Fatal("orders table not found")
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// A server on a fresh SQLite database in a temporary directory, with setupSQL run on it
+func newTestServer(t *testing.T, setupSQL string) *Server {
+	t.Helper()
+	server, err := NewServer(filepath.Join(t.TempDir(), "test.db"), PostgresConfig{}, ExtensionConfig{}, "", false)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	t.Cleanup(func() { server.db.Close() })
+	if setupSQL != "" {
+		if _, err := server.db.Exec(setupSQL); err != nil {
+			t.Fatalf("setup SQL: %v", err)
+		}
+	}
+	return server
+}
+
+// Send a request to a handler through the log middleware, as the server would
+func serveTest(s *Server, handler http.Handler, method string, target string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	s.logMiddleware(handler).ServeHTTP(w, r)
+	return w
+}
+
+// Run a query that returns one integer
+func queryInt(t *testing.T, s *Server, query string) int {
+	t.Helper()
+	var n int
+	if err := s.db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+// Serve the given endpoints under /api, as a loaded API description would
+func useEndpoints(s *Server, endpoints ...EndpointDefinition) {
+	s.apiDesc = &APIDescription{BasePath: "/api", Endpoints: endpoints}
+	for _, endpoint := range endpoints {
+		s.pathRegexps[endpoint.Path] = regexp.MustCompile(pathToRegexp(endpoint.Path))
+	}
+}
+
+func TestExtractBodyParams(t *testing.T) {
+	multipartBody := func() (string, string) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.WriteField("title", "Report")
+		part, _ := mw.CreateFormFile("file", "report.txt")
+		part.Write([]byte("file contents"))
+		mw.Close()
+		return buf.String(), mw.FormDataContentType()
+	}
+	uploadBody, uploadType := multipartBody()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		maxBytes    int64
+		want        map[string]interface{}
+		wantStatus  int // Status of the body error; 0 for none
+	}{
+		{"json", "application/json", `{"name": "Acme", "n": 2}`, 0, map[string]interface{}{"name": "Acme", "n": float64(2)}, 0},
+		{"json without content type", "", `{"name": "Acme"}`, 0, map[string]interface{}{"name": "Acme"}, 0},
+		{"empty body", "application/json", "  ", 0, map[string]interface{}{}, 0},
+		{"invalid json", "application/json", `{"name": `, 0, nil, http.StatusBadRequest},
+		{"json array", "application/json", `[1, 2]`, 0, nil, http.StatusBadRequest},
+		{"form", "application/x-www-form-urlencoded", "name=Acme+Inc&tag=a&tag=b", 0, map[string]interface{}{"name": "Acme Inc", "tag": "a"}, 0},
+		{"form with charset", "application/x-www-form-urlencoded; charset=utf-8", "name=Acme", 0, map[string]interface{}{"name": "Acme"}, 0},
+		{"invalid form", "application/x-www-form-urlencoded", "name=%zz", 0, nil, http.StatusBadRequest},
+		{"multipart", uploadType, uploadBody, 0, map[string]interface{}{
+			"title": "Report", "file": []byte("file contents"), "file_filename": "report.txt",
+			"file_mimetype": "application/octet-stream", "file_size": int64(13),
+		}, 0},
+		{"json at the limit", "application/json", `{"a":1}`, 7, map[string]interface{}{"a": float64(1)}, 0},
+		{"json over the limit", "application/json", `{"a":12}`, 7, nil, http.StatusRequestEntityTooLarge},
+		{"form over the limit", "application/x-www-form-urlencoded", "name=" + strings.Repeat("x", 100), 10, nil, http.StatusRequestEntityTooLarge},
+		{"multipart over the limit", uploadType, uploadBody, 50, nil, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/things", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			got, err := extractBodyParams(httptest.NewRecorder(), r, tt.maxBytes)
+			if tt.wantStatus != 0 {
+				var be *bodyError
+				if !errors.As(err, &be) || be.status != tt.wantStatus {
+					t.Fatalf("error = %v, want a body error with status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractBodyParams: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("params = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestBodyLimits(t *testing.T) {
+	s := newTestServer(t, "CREATE TABLE notes (text TEXT);")
+	s.maxBodyBytes = 64
+	useEndpoints(s,
+		EndpointDefinition{Path: "/notes", Methods: map[string]MethodDefinition{
+			"POST": {SQL: "INSERT INTO notes (text) VALUES (:text)", Params: []string{"text"}},
+		}},
+		EndpointDefinition{Path: "/long-notes", Methods: map[string]MethodDefinition{
+			"POST": {SQL: "INSERT INTO notes (text) VALUES (:text)", Params: []string{"text"}, MaxBodyBytes: 1024},
+		}},
+	)
+	long := `{"text": "` + strings.Repeat("x", 100) + `"}`
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		body    string
+		want    int
+	}{
+		{"endpoint", s.handleAPI, "/api/notes", `{"text": "hi"}`, http.StatusCreated},
+		{"endpoint over the limit", s.handleAPI, "/api/notes", long, http.StatusRequestEntityTooLarge},
+		{"endpoint with its own limit", s.handleAPI, "/api/long-notes", long, http.StatusCreated},
+		{"endpoint with invalid JSON", s.handleAPI, "/api/notes", `{"text": `, http.StatusBadRequest},
+		{"query over the limit", s.handleQuery, "/query", `{"sql": "SELECT '` + strings.Repeat("x", 100) + `'"}`, http.StatusRequestEntityTooLarge},
+		{"query with invalid JSON", s.handleQuery, "/query", `{"sql": `, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := serveTest(s, tt.handler, "POST", tt.target, tt.body); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+	if n := queryInt(t, s, "SELECT count(*) FROM notes"); n != 2 {
+		t.Errorf("%d notes inserted, want 2", n)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import "fmt"
+
+// ===== Result Shapes =====
+
+// Shapes a method can give its result
+const (
+	shapeRows   = "rows"   // An array of row objects
+	shapeSingle = "single" // The first row as an object; 404 when there are no rows
+	shapeScalar = "scalar" // One value from the first row; null when there are no rows
+	shapeColumn = "column" // An array of one column's values
+)
+
+var resultShapes = []string{shapeRows, shapeSingle, shapeScalar, shapeColumn}
+
+// Shape a query result. rows holds the result as maps, which may carry nested results.
+// found is false when a "single" lookup has no rows.
+func shapeResult(result *queryResult, rows []map[string]interface{}, shape string, column string) (data interface{}, found bool, err error) {
+	switch shape {
+	case "", shapeRows:
+		return rows, true, nil
+
+	case shapeSingle:
+		if len(rows) == 0 {
+			return nil, false, nil
+		}
+		return rows[0], true, nil
+
+	case shapeScalar:
+		index, err := result.columnIndex(column)
+		if err != nil {
+			return nil, true, err
+		}
+		if len(result.Rows) == 0 {
+			return nil, true, nil
+		}
+		return result.Rows[0][index], true, nil
+
+	case shapeColumn:
+		index, err := result.columnIndex(column)
+		if err != nil {
+			return nil, true, err
+		}
+		values := make([]interface{}, 0, len(result.Rows))
+		for _, row := range result.Rows {
+			values = append(values, row[index])
+		}
+		return values, true, nil
+	}
+	return nil, true, fmt.Errorf("unknown result shape %q", shape)
+}
+
+// Find a column by name, or the first column when name is empty
+func (q *queryResult) columnIndex(name string) (int, error) {
+	if name == "" {
+		if len(q.Columns) == 0 {
+			return 0, fmt.Errorf("query returned no columns")
+		}
+		return 0, nil
+	}
+	for i, col := range q.Columns {
+		if col == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("column %q not in result", name)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestShapeResult(t *testing.T) {
+	result := &queryResult{
+		Columns: []string{"id", "name"},
+		Rows:    [][]interface{}{{int64(1), "Acme"}, {int64(2), "Globex"}},
+	}
+	empty := &queryResult{Columns: []string{"id", "name"}}
+
+	tests := []struct {
+		name      string
+		result    *queryResult
+		shape     string
+		column    string
+		want      string
+		wantFound bool
+		wantErr   bool
+	}{
+		{"rows", result, "", "", `[{"id":1,"name":"Acme"},{"id":2,"name":"Globex"}]`, true, false},
+		{"rows, empty", empty, shapeRows, "", `[]`, true, false},
+		{"single", result, shapeSingle, "", `{"id":1,"name":"Acme"}`, true, false},
+		{"single, empty", empty, shapeSingle, "", `null`, false, false},
+		{"scalar", result, shapeScalar, "", `1`, true, false},
+		{"scalar by column", result, shapeScalar, "name", `"Acme"`, true, false},
+		{"scalar, empty", empty, shapeScalar, "", `null`, true, false},
+		{"scalar, unknown column", result, shapeScalar, "email", ``, true, true},
+		{"column", result, shapeColumn, "name", `["Acme","Globex"]`, true, false},
+		{"column, empty", empty, shapeColumn, "", `[]`, true, false},
+		{"no columns", &queryResult{}, shapeColumn, "", ``, true, true},
+		{"unknown shape", result, "table", "", ``, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := tt.result.maps()
+			if rows == nil {
+				rows = []map[string]interface{}{}
+			}
+			data, found, err := shapeResult(tt.result, rows, tt.shape, tt.column)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if found != tt.wantFound {
+				t.Errorf("found = %v, want %v", found, tt.wantFound)
+			}
+			if encoded, _ := json.Marshal(data); string(encoded) != tt.want {
+				t.Errorf("data = %s, want %s", encoded, tt.want)
+			}
+		})
+	}
+}
+
+func TestShapedEndpoints(t *testing.T) {
+	s := newTestServer(t, `
+		CREATE TABLE clients (id INTEGER PRIMARY KEY, name TEXT);
+		INSERT INTO clients VALUES (1, 'Acme'), (2, 'Globex');`)
+	useEndpoints(s,
+		EndpointDefinition{Path: "/clients/:id", Methods: map[string]MethodDefinition{
+			"GET": {SQL: "SELECT * FROM clients WHERE id = :id", Params: []string{"id"}, Result: shapeSingle},
+		}},
+		EndpointDefinition{Path: "/clients-count", Methods: map[string]MethodDefinition{
+			"GET": {SQL: "SELECT count(*) FROM clients", Result: shapeScalar},
+		}},
+		EndpointDefinition{Path: "/client-names", Methods: map[string]MethodDefinition{
+			"GET": {SQL: "SELECT name FROM clients ORDER BY id", Result: shapeColumn},
+		}},
+	)
+
+	tests := []struct {
+		target string
+		status int
+		want   string
+	}{
+		{"/api/clients/2", http.StatusOK, `{"id":2,"name":"Globex"}`},
+		{"/api/clients/3", http.StatusNotFound, ""},
+		{"/api/clients-count", http.StatusOK, `2`},
+		{"/api/client-names", http.StatusOK, `["Acme","Globex"]`},
+	}
+	for _, tt := range tests {
+		w := serveTest(s, http.HandlerFunc(s.handleAPI), "GET", tt.target, "")
+		if w.Code != tt.status {
+			t.Errorf("GET %s: status %d, want %d: %s", tt.target, w.Code, tt.status, w.Body)
+			continue
+		}
+		if tt.want == "" {
+			continue
+		}
+		var got interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("GET %s: %v", tt.target, err)
+		}
+		if encoded, _ := json.Marshal(got); string(encoded) != tt.want {
+			t.Errorf("GET %s = %s, want %s", tt.target, encoded, tt.want)
+		}
+	}
+}
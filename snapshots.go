@@ -0,0 +1,210 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ===== Named Snapshots =====
+
+var snapshotNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+type SnapshotInfo struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Created string `json:"created"`
+}
+
+func (s *Server) snapshotPath(name string) (string, error) {
+	if !snapshotNameRegexp.MatchString(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid snapshot name: %q", name)
+	}
+	return filepath.Join(s.snapshotDir, name+".db"), nil
+}
+
+// Open a snapshot file as a single-connection SQLite database
+func openSnapshot(filePath string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", filePath)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// Save the current database under a name, replacing any snapshot with that name
+func (s *Server) createSnapshot(name string) (SnapshotInfo, error) {
+	filePath, err := s.snapshotPath(name)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	if err := os.MkdirAll(s.snapshotDir, 0755); err != nil {
+		return SnapshotInfo{}, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Back up into a temporary file, then rename it into place
+	tmpPath := filePath + ".tmp"
+	os.Remove(tmpPath)
+	snapshot, err := openSnapshot(tmpPath)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	err = copySQLiteDatabase(snapshot, s.db)
+	snapshot.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return SnapshotInfo{}, err
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	return SnapshotInfo{Name: name, Size: info.Size(), Created: info.ModTime().UTC().Format(time.RFC3339)}, nil
+}
+
+// Replace the contents of the database with a snapshot in a single backup step
+func (s *Server) restoreSnapshot(name string) error {
+	filePath, err := s.snapshotPath(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filePath); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// mode=ro only takes effect in a file: URI
+	snapshot, err := openSnapshot("file:" + filePath + "?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+	return s.keepingAuditLog(func() error {
+		return copySQLiteDatabase(s.db, snapshot)
+	})
+}
+
+func (s *Server) deleteSnapshot(name string) error {
+	filePath, err := s.snapshotPath(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(filePath)
+}
+
+func (s *Server) listSnapshots() ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(s.snapshotDir)
+	if os.IsNotExist(err) {
+		return []SnapshotInfo{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	snapshots := []SnapshotInfo{}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".db")
+		if entry.IsDir() || name == entry.Name() || !snapshotNameRegexp.MatchString(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, SnapshotInfo{Name: name, Size: info.Size(), Created: info.ModTime().UTC().Format(time.RFC3339)})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Created < snapshots[j].Created })
+	return snapshots, nil
+}
+
+// Handle the snapshot endpoints:
+//
+//	GET    /admin/snapshots                 list snapshots
+//	POST   /admin/snapshots                 create {"name": "..."}
+//	POST   /admin/snapshots/{name}/restore  restore a snapshot
+//	DELETE /admin/snapshots/{name}          delete a snapshot
+func (s *Server) handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	if s.dbType != "sqlite" {
+		sendErrorResponse(w, "Snapshots are only supported for SQLite", http.StatusNotImplemented)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/snapshots"), "/")
+	parts := strings.Split(rest, "/")
+
+	switch {
+	case rest == "" && r.Method == "GET":
+		snapshots, err := s.listSnapshots()
+		if err != nil {
+			sendErrorResponse(w, fmt.Sprintf("Failed to list snapshots: %v", err), http.StatusInternalServerError)
+			return
+		}
+		s.sendJSONResponse(w, snapshots, http.StatusOK)
+
+	case rest == "" && r.Method == "POST":
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendErrorResponse(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := s.snapshotPath(req.Name); err != nil {
+			sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		info, err := s.createSnapshot(req.Name)
+		if err != nil {
+			sendErrorResponse(w, fmt.Sprintf("Failed to create snapshot: %v", err), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Created snapshot: %s", req.Name)
+		s.sendJSONResponse(w, info, http.StatusCreated)
+
+	case len(parts) == 2 && parts[1] == "restore" && r.Method == "POST":
+		if _, err := s.snapshotPath(parts[0]); err != nil {
+			sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.restoreSnapshot(parts[0]); os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			sendErrorResponse(w, fmt.Sprintf("Failed to restore snapshot: %v", err), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Restored snapshot: %s", parts[0])
+		s.sendJSONResponse(w, map[string]string{"status": "restored", "name": parts[0]}, http.StatusOK)
+
+	case len(parts) == 1 && r.Method == "DELETE":
+		if err := s.deleteSnapshot(parts[0]); os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			sendErrorResponse(w, fmt.Sprintf("Failed to delete snapshot: %v", err), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Deleted snapshot: %s", parts[0])
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		sendErrorResponse(w, "Not found", http.StatusNotFound)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotPath(t *testing.T) {
+	s := &Server{snapshotDir: "snapshots"}
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"before-checkout", true},
+		{"v1.2_final", true},
+		{strings.Repeat("a", 64), true},
+		{strings.Repeat("a", 65), false},
+		{"", false},
+		{".hidden", false},
+		{"..", false},
+		{"../data", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"with space", false},
+		{"naïve", false},
+	}
+	for _, tt := range tests {
+		_, err := s.snapshotPath(tt.name)
+		if (err == nil) != tt.valid {
+			t.Errorf("snapshotPath(%q) error = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	s := newTestServer(t, "CREATE TABLE t (a); INSERT INTO t VALUES (1);")
+	s.snapshotDir = t.TempDir()
+	handler := http.HandlerFunc(s.handleSnapshots)
+
+	if w := serveTest(s, handler, "POST", "/admin/snapshots", `{"name": "one"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", w.Code, w.Body)
+	}
+	if _, err := s.db.Exec("INSERT INTO t VALUES (2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serveTest(s, handler, "GET", "/admin/snapshots", "")
+	var list []SnapshotInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list) != 1 || list[0].Name != "one" || list[0].Size == 0 {
+		t.Errorf("list = %s (%v), want the one snapshot", w.Body, err)
+	}
+
+	if w := serveTest(s, handler, "POST", "/admin/snapshots/one/restore", ""); w.Code != http.StatusOK {
+		t.Fatalf("restore: status %d: %s", w.Code, w.Body)
+	}
+	if n := queryInt(t, s, "SELECT count(*) FROM t"); n != 1 {
+		t.Errorf("%d rows after restore, want 1", n)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"create with invalid name", "POST", "/admin/snapshots", `{"name": "../escape"}`, http.StatusBadRequest},
+		{"create without a name", "POST", "/admin/snapshots", `{}`, http.StatusBadRequest},
+		{"create with bad body", "POST", "/admin/snapshots", `{`, http.StatusBadRequest},
+		{"restore missing", "POST", "/admin/snapshots/two/restore", "", http.StatusNotFound},
+		{"restore invalid name", "POST", "/admin/snapshots/.hidden/restore", "", http.StatusBadRequest},
+		{"delete invalid name", "DELETE", "/admin/snapshots/.hidden", "", http.StatusBadRequest},
+		{"delete", "DELETE", "/admin/snapshots/one", "", http.StatusNoContent},
+		{"delete again", "DELETE", "/admin/snapshots/one", "", http.StatusNotFound},
+		{"unknown action", "POST", "/admin/snapshots/one/rename", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := serveTest(s, handler, tt.method, tt.target, tt.body); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+}
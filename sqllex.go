@@ -0,0 +1,416 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ===== SQL Placeholder Lexing =====
+
+// A placeholder found in SQL text: "?" (Name is empty) or ":name"
+type sqlPlaceholder struct {
+	Start int // Byte offset of the placeholder
+	End   int // Byte offset just past it
+	Name  string
+}
+
+// Keywords after which a Postgres "?" is a placeholder rather than the jsonb key-exists operator
+var placeholderKeywords = map[string]bool{
+	"SELECT": true, "WHERE": true, "AND": true, "OR": true, "NOT": true, "ON": true,
+	"SET": true, "VALUES": true, "LIMIT": true, "OFFSET": true, "FETCH": true,
+	"IN": true, "IS": true, "LIKE": true, "ILIKE": true, "BETWEEN": true, "ESCAPE": true,
+	"CASE": true, "WHEN": true, "THEN": true, "ELSE": true, "RETURNING": true,
+	"BY": true, "AS": true, "DISTINCT": true, "ALL": true, "ANY": true, "SOME": true,
+	"HAVING": true, "EXISTS": true, "TO": true, "FROM": true, "INTO": true, "USING": true,
+	"ARRAY": true, "INTERVAL": true, "DEFAULT": true,
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9' || c == '$'
+}
+
+// Find the placeholders in a query, skipping string literals, quoted identifiers, comments,
+// Postgres dollar-quoted strings, "::" casts and Postgres jsonb operators (?, ?| and ?&).
+func findPlaceholders(query string, dialect string) []sqlPlaceholder {
+	return scanSQL(query, dialect, nil)
+}
+
+// Scan a query for placeholders, calling word (if not nil) for every identifier or keyword and
+// for each ";" between statements. Quoted identifiers are passed without their quotes, with
+// quoted set.
+func scanSQL(query string, dialect string, word func(text string, quoted bool)) []sqlPlaceholder {
+	var placeholders []sqlPlaceholder
+	postgres := dialect == "postgres"
+
+	// What the previous significant token was, to tell a Postgres "?" operator from a placeholder
+	operand := false // The previous token ends an operand (identifier, literal, ")" or "]")
+
+	n := len(query)
+	for i := 0; i < n; {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+
+		// -- line comment
+		case c == '-' && i+1 < n && query[i+1] == '-':
+			for i < n && query[i] != '\n' {
+				i++
+			}
+
+		// /* block comment */ (nested in Postgres)
+		case c == '/' && i+1 < n && query[i+1] == '*':
+			depth := 0
+			for i < n {
+				if i+1 < n && query[i] == '/' && query[i+1] == '*' {
+					depth++
+					i += 2
+					if !postgres && depth > 1 {
+						depth = 1
+					}
+				} else if i+1 < n && query[i] == '*' && query[i+1] == '/' {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+
+		// 'string', with E'...' backslash escapes in Postgres
+		case c == '\'':
+			escapes := postgres && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') &&
+				(i < 2 || !isIdentChar(query[i-2]))
+			i = skipQuoted(query, i, '\'', escapes)
+			operand = true
+
+		// "identifier", plus `identifier` and [identifier] in SQLite
+		case c == '"', !postgres && c == '`':
+			end := skipQuoted(query, i, c, false)
+			if word != nil {
+				word(unquoteIdent(query[i:end], c), true)
+			}
+			i = end
+			operand = true
+		case !postgres && c == '[':
+			start := i
+			for i++; i < n && query[i] != ']'; i++ {
+			}
+			if word != nil {
+				word(query[start+1:i], true)
+			}
+			i++
+			operand = true
+
+		case c == ';':
+			if word != nil {
+				word(";", false)
+			}
+			i++
+			operand = false
+
+		// $tag$ dollar-quoted string $tag$, or $1 positional parameter (Postgres)
+		case postgres && c == '$':
+			j := i + 1
+			for j < n && (isIdentChar(query[j]) && query[j] != '$') {
+				j++
+			}
+			if j < n && query[j] == '$' && (j == i+1 || !(query[i+1] >= '0' && query[i+1] <= '9')) {
+				tag := query[i : j+1]
+				end := strings.Index(query[j+1:], tag)
+				if end < 0 {
+					i = n
+				} else {
+					i = j + 1 + end + len(tag)
+				}
+			} else {
+				i = j
+			}
+			operand = true
+
+		case c == ':':
+			switch {
+			case i+1 < n && query[i+1] == ':':
+				// :: cast; the type name that follows is skipped as an identifier
+				i += 2
+				operand = false
+			case i+1 < n && isIdentStart(query[i+1]):
+				j := i + 1
+				for j < n && isIdentChar(query[j]) && query[j] != '$' {
+					j++
+				}
+				placeholders = append(placeholders, sqlPlaceholder{Start: i, End: j, Name: query[i+1 : j]})
+				i = j
+				operand = true
+			default:
+				i++
+				operand = false
+			}
+
+		case c == '?':
+			if postgres {
+				// ?| and ?& are always jsonb operators; a bare ? after an operand is the key-exists operator
+				if i+1 < n && (query[i+1] == '|' || query[i+1] == '&') {
+					i += 2
+					operand = false
+					continue
+				}
+				if operand {
+					i++
+					operand = false
+					continue
+				}
+			} else if i+1 < n && query[i+1] >= '0' && query[i+1] <= '9' {
+				// ?NNN numbered parameter in SQLite: leave it alone
+				for i++; i < n && query[i] >= '0' && query[i] <= '9'; i++ {
+				}
+				operand = true
+				continue
+			}
+			placeholders = append(placeholders, sqlPlaceholder{Start: i, End: i + 1})
+			i++
+			operand = true
+
+		case isIdentStart(c):
+			j := i
+			for j < n && isIdentChar(query[j]) {
+				j++
+			}
+			operand = !placeholderKeywords[strings.ToUpper(query[i:j])]
+			if word != nil {
+				word(query[i:j], false)
+			}
+			i = j
+
+		case c >= '0' && c <= '9' || c == '.' && i+1 < n && query[i+1] >= '0' && query[i+1] <= '9':
+			for i < n && (isIdentChar(query[i]) || query[i] == '.') {
+				i++
+			}
+			operand = true
+
+		case c == ')' || c == ']':
+			i++
+			operand = true
+
+		default:
+			i++
+			operand = false
+		}
+	}
+	return placeholders
+}
+
+// Strip the quotes from a quoted identifier, undoing doubled quotes
+func unquoteIdent(quoted string, quote byte) string {
+	if len(quoted) >= 2 && quoted[len(quoted)-1] == quote {
+		quoted = quoted[1 : len(quoted)-1]
+	} else {
+		quoted = quoted[1:]
+	}
+	return strings.ReplaceAll(quoted, string(quote)+string(quote), string(quote))
+}
+
+// Skip a quoted string or identifier starting at i, returning the offset just past it.
+// A doubled quote is an escaped quote; with backslashEscapes, so is \'.
+func skipQuoted(query string, i int, quote byte, backslashEscapes bool) int {
+	n := len(query)
+	for i++; i < n; i++ {
+		switch query[i] {
+		case '\\':
+			if backslashEscapes {
+				i++
+			}
+		case quote:
+			if i+1 < n && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return n
+}
+
+// Replace placeholders using a callback that returns the replacement text
+func rewritePlaceholders(query string, placeholders []sqlPlaceholder, replace func(sqlPlaceholder) string) string {
+	if len(placeholders) == 0 {
+		return query
+	}
+	var b strings.Builder
+	last := 0
+	for _, p := range placeholders {
+		b.WriteString(query[last:p.Start])
+		b.WriteString(replace(p))
+		last = p.End
+	}
+	b.WriteString(query[last:])
+	return b.String()
+}
+
+// Convert "?" placeholders to the dialect's positional form ($1, $2, ... for Postgres).
+// Named placeholders are left alone.
+func bindPositional(query string, dialect string) string {
+	if dialect != "postgres" {
+		return query
+	}
+	var positional []sqlPlaceholder
+	for _, p := range findPlaceholders(query, dialect) {
+		if p.Name == "" {
+			positional = append(positional, p)
+		}
+	}
+	count := 0
+	return rewritePlaceholders(query, positional, func(sqlPlaceholder) string {
+		count++
+		return fmt.Sprintf("$%d", count)
+	})
+}
+
+// Bind named placeholders by name, however often each one occurs. With SQLite the query is
+// unchanged and each declared name it references is bound once with sql.Named; with Postgres
+// each :name becomes $n, reusing n for repeated names. Undeclared names are left alone.
+func bindNamed(query string, dialect string, names []string, value func(name string) interface{}) (string, []interface{}) {
+	var params []interface{}
+	index := make(map[string]int)
+	var named []sqlPlaceholder
+	for _, p := range findPlaceholders(query, dialect) {
+		if p.Name == "" || !containsString(names, p.Name) {
+			continue
+		}
+		named = append(named, p)
+		if _, ok := index[p.Name]; ok {
+			continue
+		}
+		index[p.Name] = len(params) + 1
+		if dialect == "postgres" {
+			params = append(params, value(p.Name))
+		} else {
+			params = append(params, sql.Named(p.Name, value(p.Name)))
+		}
+	}
+
+	if dialect != "postgres" {
+		return query, params
+	}
+	return rewritePlaceholders(query, named, func(p sqlPlaceholder) string {
+		return fmt.Sprintf("$%d", index[p.Name])
+	}), params
+}
+
+// Names of the :name placeholders in a query that aren't in names, in order of first use
+func undeclaredParams(query string, dialect string, names []string) []string {
+	var undeclared []string
+	for _, p := range findPlaceholders(query, dialect) {
+		if p.Name != "" && !containsString(names, p.Name) && !containsString(undeclared, p.Name) {
+			undeclared = append(undeclared, p.Name)
+		}
+	}
+	return undeclared
+}
+
+// Statements that change data or schema; run with Exec unless they have a RETURNING clause
+var writeKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "REPLACE": true, "UPSERT": true, "MERGE": true,
+	"CREATE": true, "DROP": true, "ALTER": true, "TRUNCATE": true,
+}
+
+// The unquoted words of each statement in a query, upper-cased, skipping comments.
+// Statements without any words, such as a trailing ";", are left out. The semicolons in
+// the BEGIN ... END body of a CREATE TRIGGER don't end it.
+func statementWords(query string, dialect string) [][]string {
+	var statements [][]string
+	var words []string
+	body, cases := false, 0 // Inside a trigger body, and how many CASE expressions are open there
+	scanSQL(query, dialect, func(word string, quoted bool) {
+		if quoted {
+			return
+		}
+		word = strings.ToUpper(word)
+		switch {
+		case word == ";" && body:
+		case word == ";":
+			if len(words) > 0 {
+				statements = append(statements, words)
+			}
+			words = nil
+			return
+		case word == "BEGIN" && !body && len(words) > 0 && words[0] == "CREATE" && containsString(words, "TRIGGER"):
+			body = true
+		case word == "CASE" && body:
+			cases++
+		case word == "END" && body && cases > 0:
+			cases--
+		case word == "END" && body:
+			body = false
+		}
+		if word != ";" {
+			words = append(words, word)
+		}
+	})
+	if len(words) > 0 {
+		statements = append(statements, words)
+	}
+	return statements
+}
+
+// How many statements a query holds
+func countStatements(query string, dialect string) int {
+	return len(statementWords(query, dialect))
+}
+
+// The leading keyword of a statement, upper-cased, skipping comments
+func statementKeyword(query string, dialect string) string {
+	if statements := statementWords(query, dialect); len(statements) > 0 {
+		return statements[0][0]
+	}
+	return ""
+}
+
+// Check whether a statement modifies data without returning rows
+func isWriteStatement(query string, dialect string) bool {
+	statements := statementWords(query, dialect)
+	if len(statements) == 0 {
+		return false
+	}
+	return writeKeywords[statements[0][0]] && !containsString(statements[0], "RETURNING")
+}
+
+// Check whether a query changes data or schema, whether or not it returns rows. Every statement
+// counts, so "SELECT 1; DELETE FROM t" does. A WITH statement counts when one of its parts
+// inserts, updates or deletes.
+func modifiesData(query string, dialect string) bool {
+	for _, words := range statementWords(query, dialect) {
+		if words[0] != "WITH" {
+			if writeKeywords[words[0]] {
+				return true
+			}
+			continue
+		}
+		for _, word := range words {
+			switch word {
+			case "INSERT", "UPDATE", "DELETE", "MERGE":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check whether a query names an identifier, bare or quoted, in any statement.
+// Names are compared without regard to case.
+func mentionsIdentifier(query string, dialect string, name string) bool {
+	found := false
+	scanSQL(query, dialect, func(word string, quoted bool) {
+		if strings.EqualFold(word, name) {
+			found = true
+		}
+	})
+	return found
+}
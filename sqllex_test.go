@@ -0,0 +1,235 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestBindPositionalPostgres(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"simple", "SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{"string literal", "SELECT 'what?' AS q, ? AS p", "SELECT 'what?' AS q, $1 AS p"},
+		{"escaped quote", "SELECT 'it''s ?' WHERE a = ?", "SELECT 'it''s ?' WHERE a = $1"},
+		{"backslash string", `SELECT E'\' ?' WHERE a = ?`, `SELECT E'\' ?' WHERE a = $1`},
+		{"quoted identifier", `SELECT "col?" FROM t WHERE a = ?`, `SELECT "col?" FROM t WHERE a = $1`},
+		{"line comment", "SELECT 1 -- why?\nWHERE a = ?", "SELECT 1 -- why?\nWHERE a = $1"},
+		{"block comment", "SELECT /* a ? /* nested ? */ b ? */ ? AS x", "SELECT /* a ? /* nested ? */ b ? */ $1 AS x"},
+		{"dollar quoting", "SELECT $$ ? $$, $tag$ ? $tag$, ?", "SELECT $$ ? $$, $tag$ ? $tag$, $1"},
+		{"jsonb exists", "SELECT * FROM t WHERE data ? 'key' AND id = ?", "SELECT * FROM t WHERE data ? 'key' AND id = $1"},
+		{"jsonb exists any", "SELECT * FROM t WHERE data ?| array['a'] AND id = ?", "SELECT * FROM t WHERE data ?| array['a'] AND id = $1"},
+		{"jsonb exists all", "SELECT * FROM t WHERE data ?& array['a'] AND id = ?", "SELECT * FROM t WHERE data ?& array['a'] AND id = $1"},
+		{"jsonb after cast", "SELECT * FROM t WHERE data::jsonb ? 'k' AND id = ?", "SELECT * FROM t WHERE data::jsonb ? 'k' AND id = $1"},
+		{"jsonb after paren", "SELECT * FROM t WHERE (data->'a') ? 'k' LIMIT ?", "SELECT * FROM t WHERE (data->'a') ? 'k' LIMIT $1"},
+		{"in list", "SELECT * FROM t WHERE id IN (?, ?, ?)", "SELECT * FROM t WHERE id IN ($1, $2, $3)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bindPositional(tt.query, "postgres"); got != tt.want {
+				t.Errorf("bindPositional(%q)\n got: %q\nwant: %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindPositionalSQLite(t *testing.T) {
+	// SQLite understands ? natively
+	query := "SELECT '?' WHERE a = ?"
+	if got := bindPositional(query, "sqlite"); got != query {
+		t.Errorf("bindPositional changed SQLite query: %q", got)
+	}
+}
+
+func TestFindPlaceholdersSQLite(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string // "?" for positional, otherwise the name
+	}{
+		{"positional", "SELECT ? , ?", []string{"?", "?"}},
+		{"numbered", "SELECT ?1, ?2, ?", []string{"?"}},
+		{"named", "SELECT :a, :b", []string{"a", "b"}},
+		{"prefix names", "SELECT :id, :idx", []string{"id", "idx"}},
+		{"string literal", "SELECT ':a ?', :b", []string{"b"}},
+		{"backtick identifier", "SELECT `:a?` FROM t WHERE x = :b", []string{"b"}},
+		{"bracket identifier", "SELECT [:a?] FROM t WHERE x = :b", []string{"b"}},
+		{"comments", "SELECT 1 -- :a ?\n/* :b ? */ WHERE x = :c", []string{"c"}},
+		{"no backslash escapes", `SELECT 'a\', :b`, []string{"b"}},
+		{"json path", "SELECT json_extract(data, '$.a:b') WHERE id = ?", []string{"?"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := placeholderNames(findPlaceholders(tt.query, "sqlite")); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findPlaceholders(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindPlaceholdersPostgres(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"cast", "SELECT :a::text, x::int", []string{"a"}},
+		{"cast of literal", "SELECT '1'::int WHERE id = :id", []string{"id"}},
+		{"prefix names", "SELECT :id, :idx", []string{"id", "idx"}},
+		{"dollar quoted", "SELECT $body$ :a $body$, :b", []string{"b"}},
+		{"backslash string", `SELECT e'\' :a', :b`, []string{"b"}},
+		{"jsonb operator", "SELECT data ? :key", []string{"key"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := placeholderNames(findPlaceholders(tt.query, "postgres")); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findPlaceholders(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindNamedPostgres(t *testing.T) {
+	values := map[string]interface{}{"q": "x", "id": 1, "idx": 2}
+	query, params := bindNamed(
+		"SELECT * FROM t WHERE a = :q OR b = :q OR id = :id OR idx = :idx OR note = ':id' AND x = :other::text",
+		"postgres", []string{"q", "id", "idx"}, func(name string) interface{} { return values[name] })
+
+	wantQuery := "SELECT * FROM t WHERE a = $1 OR b = $1 OR id = $2 OR idx = $3 OR note = ':id' AND x = :other::text"
+	if query != wantQuery {
+		t.Errorf("query\n got: %q\nwant: %q", query, wantQuery)
+	}
+	if want := []interface{}{"x", 1, 2}; !reflect.DeepEqual(params, want) {
+		t.Errorf("params = %v, want %v", params, want)
+	}
+}
+
+func TestBindNamedSQLite(t *testing.T) {
+	values := map[string]interface{}{"q": "x", "unused": 3}
+	original := "SELECT * FROM t WHERE a = :q OR b = :q OR c = ':unused'"
+	query, params := bindNamed(original, "sqlite", []string{"q", "unused"},
+		func(name string) interface{} { return values[name] })
+
+	if query != original {
+		t.Errorf("query changed: %q", query)
+	}
+	if want := []interface{}{sql.Named("q", "x")}; !reflect.DeepEqual(params, want) {
+		t.Errorf("params = %v, want %v", params, want)
+	}
+}
+
+func TestUndeclaredParams(t *testing.T) {
+	got := undeclaredParams("SELECT :a, :b, ':c', :a, :d::text", "postgres", []string{"a"})
+	if want := []string{"b", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("undeclaredParams = %v, want %v", got, want)
+	}
+}
+
+func TestIsWriteStatement(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"INSERT INTO t (a) VALUES (?)", true},
+		{"  -- comment\n update t set a = 1", true},
+		{"/* x */ DELETE FROM t", true},
+		{"CREATE TABLE t (a int)", true},
+		{"INSERT INTO t (a) VALUES (1) RETURNING id", false},
+		{"SELECT 'insert'", false},
+		{"select * from t where note = 'returning'", false},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", false},
+	}
+	for _, tt := range tests {
+		for _, dialect := range []string{"sqlite", "postgres"} {
+			if got := isWriteStatement(tt.query, dialect); got != tt.want {
+				t.Errorf("isWriteStatement(%q, %s) = %v, want %v", tt.query, dialect, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestModifiesData(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"INSERT INTO t (a) VALUES (?)", true},
+		{"INSERT INTO t (a) VALUES (1) RETURNING id", true},
+		{"DELETE FROM t WHERE id = 1 RETURNING *", true},
+		{"WITH gone AS (DELETE FROM t RETURNING id) SELECT count(*) FROM gone", true},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", false},
+		{"SELECT 'delete'", false},
+		{"SELECT 1; DELETE FROM t", true},
+		{"SELECT 1; WITH gone AS (DELETE FROM t RETURNING id) SELECT * FROM gone", true},
+		{"SELECT 1; SELECT 'drop'; -- delete", false},
+	}
+	for _, tt := range tests {
+		for _, dialect := range []string{"sqlite", "postgres"} {
+			if got := modifiesData(tt.query, dialect); got != tt.want {
+				t.Errorf("modifiesData(%q, %s) = %v, want %v", tt.query, dialect, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestCountStatements(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"SELECT 1", 1},
+		{"SELECT 1;", 1},
+		{"SELECT 1; DELETE FROM t", 2},
+		{"SELECT ';' AS semi, \"a;b\" FROM t", 1},
+		{"SELECT 1 -- ; DELETE FROM t", 1},
+		{"SELECT 1 /* ; DELETE */", 1},
+		{";;", 0},
+		{"CREATE TRIGGER tr AFTER INSERT ON t BEGIN UPDATE t SET a = CASE WHEN a > 1 THEN 1 END; DELETE FROM u; END", 1},
+		{"CREATE TRIGGER tr AFTER INSERT ON t BEGIN DELETE FROM u; END; DELETE FROM t", 2},
+	}
+	for _, tt := range tests {
+		if got := countStatements(tt.query, "sqlite"); got != tt.want {
+			t.Errorf("countStatements(%q) = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+	// Dollar quoting hides the semicolons of a Postgres function body
+	if got := countStatements("CREATE FUNCTION f() RETURNS void AS $$ DELETE FROM t; $$ LANGUAGE sql", "postgres"); got != 1 {
+		t.Errorf("countStatements(dollar-quoted body) = %d, want 1", got)
+	}
+}
+
+func TestMentionsIdentifier(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"DELETE FROM audit_log", true},
+		{"drop table AUDIT_LOG", true},
+		{`DELETE FROM "audit_log"`, true},
+		{"DELETE FROM main.`audit_log`", true},
+		{"DELETE FROM [audit_log] WHERE 1", true},
+		{"DELETE FROM audit_logs", false},
+		{"DELETE FROM t WHERE note = 'audit_log'", false},
+		{"DELETE FROM t -- audit_log", false},
+	}
+	for _, tt := range tests {
+		if got := mentionsIdentifier(tt.query, "sqlite", "audit_log"); got != tt.want {
+			t.Errorf("mentionsIdentifier(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func placeholderNames(placeholders []sqlPlaceholder) []string {
+	var names []string
+	for _, p := range placeholders {
+		if p.Name == "" {
+			names = append(names, "?")
+		} else {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
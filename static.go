@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Static File Serving =====
+
+// Default site, used when --embedded-site is set
+//
+//go:embed site
+var embeddedSite embed.FS
+
+// Files that are never served, matched against each path segment and the full relative path
+var defaultStaticDeny = []string{
+	".*",
+	"*.db", "*.db-journal", "*.db-wal", "*.db-shm",
+	"*.sqlite", "*.sqlite3", "*.sqlite-*",
+	"*.sql",
+	"*.so", "*.dylib", "*.dll", "*.exe",
+	"*.go", "go.mod", "go.sum",
+	"*.sh",
+	"*.spc",
+	"*.jsonl",
+	"migrations",
+}
+
+// Filenames carrying a content hash (app.3f2a9c1b.js, chunk-5f3e2a1d.css) are cached forever
+var hashedNameRegexp = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[A-Za-z0-9]+$`)
+
+type StaticConfig struct {
+	Root         string   // Directory to serve
+	Deny         []string // Glob patterns that are never served
+	DenyFiles    []string // Specific files and directories that are never served (database, API description, ...)
+	SPAFallback  bool     // Serve index.html for unknown extensionless paths
+	EmbeddedSite bool     // Fall back to the embedded default site
+	DevReload    bool     // Add the live reload script to HTML pages and never cache
+}
+
+type staticHandler struct {
+	fsys      fs.FS
+	root      string
+	deny      []string
+	denyFiles map[string]bool
+	spa       bool
+	dev       bool
+
+	mu    sync.Mutex
+	etags map[string]etagEntry // By file name, for the version last served
+}
+
+// A file's ETag and the version of the file it was computed for
+type etagEntry struct {
+	size    int64
+	modTime time.Time
+	tag     string
+}
+
+// Layered file system: the first layer that has a file wins
+type layeredFS []fs.FS
+
+func (l layeredFS) Open(name string) (fs.File, error) {
+	for _, layer := range l {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func newStaticHandler(config StaticConfig) (*staticHandler, error) {
+	root, err := filepath.Abs(config.Root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve static root: %w", err)
+	}
+
+	layers := layeredFS{os.DirFS(root)}
+	if config.EmbeddedSite {
+		site, err := fs.Sub(embeddedSite, "site")
+		if err != nil {
+			return nil, fmt.Errorf("failed to open embedded site: %w", err)
+		}
+		layers = append(layers, site)
+	}
+
+	h := &staticHandler{
+		fsys:      layers,
+		root:      root,
+		deny:      append(append([]string{}, defaultStaticDeny...), config.Deny...),
+		denyFiles: make(map[string]bool),
+		spa:       config.SPAFallback,
+		dev:       config.DevReload,
+		etags:     make(map[string]etagEntry),
+	}
+
+	// Deny specific files that live under the root, by their path relative to it
+	for _, file := range config.DenyFiles {
+		if file == "" {
+			continue
+		}
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(root, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			h.denyFiles[filepath.ToSlash(rel)] = true
+		}
+	}
+
+	return h, nil
+}
+
+// Check whether a relative path matches a deny pattern, or is or lies in a denied file
+func (h *staticHandler) denied(name string) bool {
+	segments := strings.Split(name, "/")
+	for i := range segments {
+		if h.denyFiles[strings.Join(segments[:i+1], "/")] {
+			return true
+		}
+	}
+	for _, pattern := range h.deny {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		for _, segment := range segments {
+			if ok, _ := path.Match(pattern, segment); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logger(r.Context()).Debug("Static", "path", r.URL.Path)
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Clean the path; fs.FS rejects anything that escapes the root
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+
+	if h.denied(name) {
+		logger(r.Context()).Info("denied static file", "file", name)
+		http.NotFound(w, r)
+		return
+	}
+
+	info, err := fs.Stat(h.fsys, name)
+	if err == nil && info.IsDir() {
+		name = path.Join(name, "index.html")
+		info, err = fs.Stat(h.fsys, name)
+	}
+
+	// Executables without an extension are most likely the server itself or a tool next to it
+	if err == nil && path.Ext(name) == "" && info.Mode()&0o111 != 0 {
+		logger(r.Context()).Info("denied static file", "file", name)
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		// History-mode routes have no extension and come from a browser navigation
+		if h.spa && path.Ext(name) == "" && acceptsHTML(r) {
+			logger(r.Context()).Debug("SPA fallback to index.html", "path", r.URL.Path)
+			h.serveFile(w, r, "index.html", false)
+			return
+		}
+		logger(r.Context()).Debug("file not found", "file", name)
+		http.NotFound(w, r)
+		return
+	}
+
+	h.serveFile(w, r, name, true)
+}
+
+func acceptsHTML(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return accept == "" || strings.Contains(accept, "text/html") || strings.Contains(accept, "*/*")
+}
+
+// Serve a file, preferring a precompressed .br or .gz sibling when the client accepts it
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string, cacheable bool) {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	servedName := name
+	encoding := ""
+	acceptEncoding := r.Header.Get("Accept-Encoding")
+	html := strings.HasPrefix(contentType, "text/html")
+	if h.dev && html {
+		acceptEncoding = "" // The reload script can't be added to a compressed page
+	}
+	for _, variant := range []struct{ ext, encoding string }{{".br", "br"}, {".gz", "gzip"}} {
+		if !strings.Contains(acceptEncoding, variant.encoding) {
+			continue
+		}
+		if info, err := fs.Stat(h.fsys, name+variant.ext); err == nil && !info.IsDir() {
+			servedName = name + variant.ext
+			encoding = variant.encoding
+			break
+		}
+	}
+
+	f, err := h.fsys.Open(servedName)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		sendErrorResponse(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	// Serve straight from the file; only HTML pages that get the reload script, or files
+	// that can't seek, are read into memory
+	content, ok := f.(io.ReadSeeker)
+	if !ok || h.dev && html {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			sendErrorResponse(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		if h.dev && html {
+			data = injectReloadScript(data)
+		}
+		content = bytes.NewReader(data)
+	}
+	tag, err := h.etag(servedName, info, content)
+	if err != nil {
+		sendErrorResponse(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept-Encoding")
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	w.Header().Set("ETag", tag)
+	switch {
+	case h.dev:
+		w.Header().Set("Cache-Control", "no-store")
+	case cacheable && hashedNameRegexp.MatchString(name):
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		// Revalidate with the ETag on every use
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	logger(r.Context()).Debug("serving static file", "file", servedName)
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// Compute (or reuse) a content-hash ETag for a file. The hash is only computed when the
+// file's size or modtime changed since the last time; content is left at its start.
+func (h *staticHandler) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	h.mu.Lock()
+	entry, ok := h.etags[name]
+	h.mu.Unlock()
+	if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.tag, nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	entry = etagEntry{size: info.Size(), modTime: info.ModTime(), tag: `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`}
+
+	h.mu.Lock()
+	h.etags[name] = entry
+	h.mu.Unlock()
+	return entry.tag, nil
+}
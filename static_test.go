@@ -0,0 +1,242 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Write files under a directory, creating their parent directories
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newTestStaticHandler(t *testing.T, config StaticConfig, files map[string]string) *staticHandler {
+	t.Helper()
+	if config.Root == "" {
+		config.Root = t.TempDir()
+	}
+	writeFiles(t, config.Root, files)
+	h, err := newStaticHandler(config)
+	if err != nil {
+		t.Fatalf("newStaticHandler: %v", err)
+	}
+	return h
+}
+
+func getStatic(h http.Handler, target string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", target, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestStaticDeny(t *testing.T) {
+	root := t.TempDir()
+	h := newTestStaticHandler(t, StaticConfig{
+		Root:      root,
+		Deny:      []string{"private-*"},
+		DenyFiles: []string{filepath.Join(root, "api.json"), filepath.Join(root, "seed"), "/elsewhere/data.db"},
+	}, map[string]string{
+		"index.html":               "<html></html>",
+		"app.js":                   "js",
+		"api.json":                 "{}",
+		"other.json":               "{}",
+		"data.db":                  "db",
+		"aws.spc":                  "secret_key = \"s\"",
+		"requests.jsonl":           "{}",
+		".env":                     "SECRET=1",
+		"assets/.git/config":       "x",
+		"private-notes.txt":        "x",
+		"assets/private-a.png":     "x",
+		"seed/clients.csv":         "id\n1",
+		"migrations/0001_a.up.sql": "x",
+		"migrations/README.txt":    "x",
+		"scripts/build.sh":         "x",
+		"main.go":                  "package main",
+	})
+	if err := os.WriteFile(filepath.Join(root, "srv"), []byte("\x7fELF"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "run.js"), []byte("js"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/", http.StatusOK},
+		{"/app.js", http.StatusOK},
+		{"/other.json", http.StatusOK},
+		{"/run.js", http.StatusOK}, // Executable, but has an extension
+		{"/api.json", http.StatusNotFound},
+		{"/data.db", http.StatusNotFound},
+		{"/aws.spc", http.StatusNotFound},
+		{"/requests.jsonl", http.StatusNotFound},
+		{"/.env", http.StatusNotFound},
+		{"/assets/.git/config", http.StatusNotFound},
+		{"/private-notes.txt", http.StatusNotFound},
+		{"/assets/private-a.png", http.StatusNotFound},
+		{"/seed/clients.csv", http.StatusNotFound},
+		{"/migrations/0001_a.up.sql", http.StatusNotFound},
+		{"/migrations/README.txt", http.StatusNotFound},
+		{"/scripts/build.sh", http.StatusNotFound},
+		{"/main.go", http.StatusNotFound},
+		{"/srv", http.StatusNotFound},
+		{"/../data.db", http.StatusNotFound},
+		{"/assets/../data.db", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := getStatic(h, tt.path); w.Code != tt.want {
+			t.Errorf("GET %s: status %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+}
+
+func TestStaticSPAFallback(t *testing.T) {
+	files := map[string]string{"index.html": "<html>app</html>", "app.js": "js"}
+	tests := []struct {
+		name   string
+		spa    bool
+		path   string
+		accept string
+		want   int
+	}{
+		{"route", true, "/clients/42", "text/html,application/xhtml+xml", http.StatusOK},
+		{"no accept header", true, "/clients", "", http.StatusOK},
+		{"wildcard accept", true, "/clients", "*/*", http.StatusOK},
+		{"json request", true, "/clients", "application/json", http.StatusNotFound},
+		{"missing asset", true, "/missing.js", "text/html", http.StatusNotFound},
+		{"existing asset", true, "/app.js", "text/html", http.StatusOK},
+		{"off", false, "/clients", "text/html", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestStaticHandler(t, StaticConfig{SPAFallback: tt.spa}, files)
+			w := getStatic(h, tt.path, "Accept", tt.accept)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && tt.path != "/app.js" && w.Body.String() != files["index.html"] {
+				t.Errorf("body = %q, want index.html", w.Body)
+			}
+		})
+	}
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	h := newTestStaticHandler(t, StaticConfig{}, map[string]string{
+		"app.js":     "plain",
+		"app.js.gz":  "gzipped",
+		"app.js.br":  "brotli",
+		"style.css":  "plain css",
+		"only.js":    "plain only",
+		"only.js.gz": "gzipped only",
+	})
+	tests := []struct {
+		path, accept         string
+		wantBody, wantCoding string
+	}{
+		{"/app.js", "gzip, deflate, br", "brotli", "br"},
+		{"/app.js", "gzip", "gzipped", "gzip"},
+		{"/app.js", "", "plain", ""},
+		{"/only.js", "br", "plain only", ""},
+		{"/only.js", "br, gzip", "gzipped only", "gzip"},
+		{"/style.css", "br, gzip", "plain css", ""},
+	}
+	for _, tt := range tests {
+		w := getStatic(h, tt.path, "Accept-Encoding", tt.accept)
+		if w.Body.String() != tt.wantBody || w.Header().Get("Content-Encoding") != tt.wantCoding {
+			t.Errorf("GET %s (Accept-Encoding %q) = %q encoded %q, want %q encoded %q",
+				tt.path, tt.accept, w.Body, w.Header().Get("Content-Encoding"), tt.wantBody, tt.wantCoding)
+		}
+		if ct := w.Header().Get("Content-Type"); tt.path == "/app.js" && ct != "text/javascript; charset=utf-8" {
+			t.Errorf("GET %s: Content-Type %q, want the uncompressed file's", tt.path, ct)
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("GET %s: Vary = %q, want Accept-Encoding", tt.path, w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestStaticETag(t *testing.T) {
+	root := t.TempDir()
+	h := newTestStaticHandler(t, StaticConfig{Root: root}, map[string]string{"app.js": "version 1"})
+
+	first := getStatic(h, "/app.js")
+	tag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || tag == "" {
+		t.Fatalf("first GET: status %d, ETag %q", first.Code, tag)
+	}
+	if again := getStatic(h, "/app.js"); again.Header().Get("ETag") != tag {
+		t.Errorf("ETag changed without a change to the file: %q, then %q", tag, again.Header().Get("ETag"))
+	}
+	if w := getStatic(h, "/app.js", "If-None-Match", tag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("revalidation: status %d with %d bytes, want 304 and no body", w.Code, w.Body.Len())
+	}
+
+	// A changed file gets a new ETag, and the old one no longer matches
+	file := filepath.Join(root, "app.js")
+	if err := os.WriteFile(file, []byte("version 2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	w := getStatic(h, "/app.js", "If-None-Match", tag)
+	if w.Code != http.StatusOK || w.Body.String() != "version 2" {
+		t.Fatalf("after the change: status %d, body %q; want 200 with the new content", w.Code, w.Body)
+	}
+	newTag := w.Header().Get("ETag")
+	if newTag == tag {
+		t.Errorf("ETag %q didn't change with the file", tag)
+	}
+	if w := getStatic(h, "/app.js", "If-None-Match", newTag); w.Code != http.StatusNotModified {
+		t.Errorf("revalidation with the new ETag: status %d, want 304", w.Code)
+	}
+	if len(h.etags) != 1 {
+		t.Errorf("%d cached ETags, want 1 per file", len(h.etags))
+	}
+
+	// Range requests are served from the file
+	if w := getStatic(h, "/app.js", "Range", "bytes=0-6"); w.Code != http.StatusPartialContent || w.Body.String() != "version" {
+		t.Errorf("range request: status %d, body %q", w.Code, w.Body)
+	}
+}
+
+func TestStaticCacheControl(t *testing.T) {
+	files := map[string]string{"app.3f2a9c1b.js": "x", "app.js": "x", "index.html": "<html><body></body></html>"}
+	h := newTestStaticHandler(t, StaticConfig{}, files)
+	for path, want := range map[string]string{
+		"/app.3f2a9c1b.js": "public, max-age=31536000, immutable",
+		"/app.js":          "no-cache",
+		"/":                "no-cache",
+	} {
+		if got := getStatic(h, path).Header().Get("Cache-Control"); got != want {
+			t.Errorf("GET %s: Cache-Control %q, want %q", path, got, want)
+		}
+	}
+
+	dev := newTestStaticHandler(t, StaticConfig{DevReload: true}, files)
+	w := getStatic(dev, "/", "Accept-Encoding", "gzip")
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("dev mode: Cache-Control %q, want no-store", got)
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ===== Steampipe Extensions =====
+
+// Requests with this header set to "bypass" get fresh results instead of cached ones, when
+// they carry the admin token or bypassing is allowed
+const steampipeCacheHeader = "X-Steampipe-Cache"
+
+// Seconds Steampipe caches results for when no TTL is set
+const steampipeDefaultCacheTTL = 300
+
+// The plugin name in a Steampipe extension's file name, e.g. "aws" in steampipe_sqlite_aws.so
+var steampipeExtensionPattern = regexp.MustCompile(`^steampipe[_-]sqlite[_-]([a-z0-9_]+)`)
+
+// An HCL attribute on a line of its own, e.g. `secret_key = "..."`
+var hclAttributePattern = regexp.MustCompile(`^(\s*)([A-Za-z0-9_]+)(\s*=\s*)(\S.*)$`)
+
+// The start of a heredoc value, e.g. `<<EOT` or `<<-EOT`
+var hclHeredocPattern = regexp.MustCompile(`^<<-?([A-Za-z0-9_]+)\s*$`)
+
+// Settings for the Steampipe plugins loaded as SQLite extensions
+type SteampipeConfig struct {
+	Plugins  map[string]SteampipePluginConfig `json:"plugins,omitempty"`  // Connection config by plugin name, e.g. "aws"
+	Cache    *bool                            `json:"cache,omitempty"`    // Cache query results (default false)
+	CacheTTL *int                             `json:"cacheTTL,omitempty"` // Seconds results stay cached (default 300)
+
+	AllowBypass *bool `json:"allowBypass,omitempty"` // Let any client bypass the cache, not only admins
+}
+
+type SteampipePluginConfig struct {
+	Config     string `json:"config,omitempty"`     // HCL connection config, e.g. `regions = ["us-east-1"]`
+	ConfigFile string `json:"configFile,omitempty"` // File holding the config, relative to the API description
+}
+
+// Merge returns a copy of c with every field that is set in override replacing its counterpart
+func (c SteampipeConfig) Merge(override *SteampipeConfig) SteampipeConfig {
+	if override == nil {
+		return c
+	}
+	if override.Plugins != nil {
+		plugins := make(map[string]SteampipePluginConfig)
+		for name, plugin := range c.Plugins {
+			plugins[name] = plugin
+		}
+		for name, plugin := range override.Plugins {
+			plugins[name] = plugin
+		}
+		c.Plugins = plugins
+	}
+	if override.Cache != nil {
+		c.Cache = override.Cache
+	}
+	if override.CacheTTL != nil {
+		c.CacheTTL = override.CacheTTL
+	}
+	if override.AllowBypass != nil {
+		c.AllowBypass = override.AllowBypass
+	}
+	return c
+}
+
+// The Steampipe settings in effect: the API description's, overridden by the command line,
+// and the directory their config files are relative to
+func steampipeSettings(apiDesc *APIDescription, apiDescPath string, override *SteampipeConfig) (SteampipeConfig, string) {
+	config, configDir := SteampipeConfig{}, "."
+	if apiDesc != nil && apiDesc.Steampipe != nil {
+		config, configDir = *apiDesc.Steampipe, filepath.Dir(apiDescPath)
+	}
+	return config.Merge(override), configDir
+}
+
+// The config files of the plugins, which hold credentials
+func (c SteampipeConfig) configFiles(configDir string) []string {
+	var files []string
+	for _, plugin := range c.Plugins {
+		if path := plugin.ConfigFile; path != "" {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(configDir, path)
+			}
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Parse --steampipe-config: comma-separated plugin=file pairs
+func parseSteampipePlugins(value string) (map[string]SteampipePluginConfig, error) {
+	plugins := make(map[string]SteampipePluginConfig)
+	for _, item := range splitList(value) {
+		name, file, ok := strings.Cut(item, "=")
+		if !ok || name == "" || file == "" {
+			return nil, fmt.Errorf("invalid Steampipe config %q: use plugin=file", item)
+		}
+		if absPath, err := filepath.Abs(file); err == nil {
+			file = absPath
+		}
+		plugins[name] = SteampipePluginConfig{ConfigFile: file}
+	}
+	return plugins, nil
+}
+
+// A Steampipe plugin among the loaded extensions
+type steampipePlugin struct {
+	Name         string `json:"name"`
+	Extension    string `json:"extension"`
+	ConfigSource string `json:"configSource,omitempty"` // "inline" or the config file; empty for the plugin's defaults
+	Config       string `json:"config,omitempty"`       // With secret-looking values redacted
+	config       string
+}
+
+// Plugins configure their connection with a function named after them
+func (p *steampipePlugin) configureSQL() string {
+	return fmt.Sprintf("SELECT steampipe_configure_%s(?)", p.Name)
+}
+
+// The Steampipe plugins among the extensions and the config each one gets
+type steampipeSetup struct {
+	plugins     []*steampipePlugin
+	byExtension map[string]*steampipePlugin
+	allowBypass bool // Clients without the admin token may bypass the cache too
+}
+
+// Resolve the Steampipe settings for the extensions. Returns nil when none is a Steampipe plugin.
+func newSteampipeSetup(config SteampipeConfig, extensions []SQLiteExtension, configDir string) (*steampipeSetup, error) {
+	// Plugins read their cache settings from the environment as they load. The cache
+	// stays off unless the config turns it on, so results are always current.
+	cache := config.Cache != nil && *config.Cache
+	os.Setenv("STEAMPIPE_CACHE", strconv.FormatBool(cache))
+	if config.CacheTTL != nil {
+		os.Setenv("STEAMPIPE_CACHE_MAX_TTL", strconv.Itoa(*config.CacheTTL))
+	}
+
+	setup := &steampipeSetup{byExtension: make(map[string]*steampipePlugin), allowBypass: config.AllowBypass != nil && *config.AllowBypass}
+	for _, extension := range extensions {
+		match := steampipeExtensionPattern.FindStringSubmatch(strings.ToLower(filepath.Base(extension.Path)))
+		if match == nil {
+			continue
+		}
+		plugin := &steampipePlugin{Name: match[1], Extension: extension.Path}
+		pluginConfig := config.Plugins[plugin.Name]
+		switch {
+		case pluginConfig.Config != "" && pluginConfig.ConfigFile != "":
+			return nil, fmt.Errorf("Steampipe plugin %s: use either config or configFile, not both", plugin.Name)
+		case pluginConfig.ConfigFile != "":
+			path := SteampipeConfig{Plugins: map[string]SteampipePluginConfig{plugin.Name: pluginConfig}}.configFiles(configDir)[0]
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Steampipe config for %s: %w", plugin.Name, err)
+			}
+			plugin.config, plugin.ConfigSource = string(data), path
+		case pluginConfig.Config != "":
+			plugin.config, plugin.ConfigSource = pluginConfig.Config, "inline"
+		}
+		setup.plugins = append(setup.plugins, plugin)
+		setup.byExtension[extension.Path] = plugin
+	}
+
+	for name := range config.Plugins {
+		if !setup.has(name) {
+			log.Printf("Warning: Steampipe config for %s, but no steampipe_sqlite_%s extension is loaded", name, name)
+		}
+	}
+	if len(setup.plugins) == 0 {
+		return nil, nil
+	}
+	return setup, nil
+}
+
+func (s *steampipeSetup) has(name string) bool {
+	for _, plugin := range s.plugins {
+		if plugin.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply a freshly loaded plugin's connection config
+func (s *steampipeSetup) configure(conn *sqlite3.SQLiteConn, extension SQLiteExtension) error {
+	if s == nil {
+		return nil
+	}
+	plugin := s.byExtension[extension.Path]
+	if plugin == nil || plugin.ConfigSource == "" {
+		return nil
+	}
+	if _, err := conn.Exec(plugin.configureSQL(), []driver.Value{plugin.config}); err != nil {
+		return fmt.Errorf("failed to configure Steampipe plugin %s: %w", plugin.Name, err)
+	}
+	return nil
+}
+
+// Make every plugin drop its cached results by applying its config again. The appended
+// comment makes the config differ from the current one, so Steampipe treats it as a
+// changed connection and starts its cache afresh.
+func (s *steampipeSetup) bypassCache(ctx context.Context, db *sql.DB) error {
+	marker := fmt.Sprintf("\n# cache bypass %d\n", time.Now().UnixNano())
+	for _, plugin := range s.plugins {
+		if _, err := db.ExecContext(ctx, plugin.configureSQL(), plugin.config+marker); err != nil {
+			return fmt.Errorf("failed to reconfigure Steampipe plugin %s: %w", plugin.Name, err)
+		}
+	}
+	return nil
+}
+
+// Honor the cache bypass header on requests served from the database. A bypass clears the
+// cache for every client, so it takes the admin token unless bypassing is allowed.
+func (s *Server) steampipeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.steampipe != nil && strings.EqualFold(r.Header.Get(steampipeCacheHeader), "bypass") && s.isDynamicPath(r.URL.Path) {
+			if !s.steampipe.allowBypass && !s.hasAdminToken(r) {
+				logger(r.Context()).Warn("Steampipe cache bypass refused: no admin token")
+			} else if err := s.steampipe.bypassCache(r.Context(), s.db); err != nil {
+				logger(r.Context()).Warn("Steampipe cache bypass failed", "error", err)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Replace the values of secret-looking attributes in an HCL config. A value that spans
+// several lines, a heredoc or a list or object, is replaced as a whole.
+func redactHCL(config string, patterns []string) string {
+	lines := strings.Split(config, "\n")
+	var redacted []string
+	for i := 0; i < len(lines); i++ {
+		match := hclAttributePattern.FindStringSubmatch(lines[i])
+		if match == nil || !isSecret(match[2], patterns) {
+			redacted = append(redacted, lines[i])
+			continue
+		}
+		redacted = append(redacted, match[1]+match[2]+match[3]+`"[REDACTED]"`)
+
+		// Skip the rest of the value
+		value := strings.TrimSpace(match[4])
+		if heredoc := hclHeredocPattern.FindStringSubmatch(value); heredoc != nil {
+			for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != heredoc[1] {
+				i++
+			}
+			i++ // The closing marker
+			continue
+		}
+		for depth := hclBracketDepth(value); depth > 0 && i+1 < len(lines); {
+			i++
+			depth += hclBracketDepth(lines[i])
+		}
+	}
+	return strings.Join(redacted, "\n")
+}
+
+// How many more brackets a line opens than it closes, outside quoted strings and comments
+func hclBracketDepth(line string) int {
+	depth := 0
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '#', c == '/' && i+1 < len(line) && line[i+1] == '/':
+			return depth
+		case c == '[', c == '{', c == '(':
+			depth++
+		case c == ']', c == '}', c == ')':
+			depth--
+		}
+	}
+	return depth
+}
+
+// The cache settings plugins loaded with, from the environment
+func steampipeCacheSettings() (enabled bool, ttl int) {
+	ttl, err := strconv.Atoi(os.Getenv("STEAMPIPE_CACHE_MAX_TTL"))
+	if err != nil {
+		ttl = steampipeDefaultCacheTTL
+	}
+	return os.Getenv("STEAMPIPE_CACHE") != "false", ttl
+}
+
+// The Steampipe settings in effect
+type SteampipeStatus struct {
+	Plugins      []steampipePlugin `json:"plugins"`
+	Cache        bool              `json:"cache"`
+	CacheTTL     int               `json:"cacheTTL"` // Seconds
+	BypassHeader string            `json:"bypassHeader"`
+	AllowBypass  bool              `json:"allowBypass"` // Clients without the admin token may send the header
+}
+
+// GET /admin/steampipe shows the loaded Steampipe plugins, their config and the cache settings
+func (s *Server) handleSteampipe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		sendErrorResponse(w, "Only GET method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status := SteampipeStatus{Plugins: []steampipePlugin{}, BypassHeader: steampipeCacheHeader + ": bypass"}
+	status.Cache, status.CacheTTL = steampipeCacheSettings()
+	patterns := s.redactParams
+	if patterns == nil {
+		patterns = defaultRedactedParams
+	}
+	if s.steampipe != nil {
+		status.AllowBypass = s.steampipe.allowBypass
+		for _, plugin := range s.steampipe.plugins {
+			shown := *plugin
+			shown.Config = redactHCL(plugin.config, patterns)
+			status.Plugins = append(status.Plugins, shown)
+		}
+	}
+	sort.Slice(status.Plugins, func(i, j int) bool { return status.Plugins[i].Name < status.Plugins[j].Name })
+	s.sendJSONResponse(w, status, http.StatusOK)
+}
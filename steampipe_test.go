@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestRedactHCL(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"plain attributes kept", `regions = ["us-east-1"]
+profile = "dev"`, `regions = ["us-east-1"]
+profile = "dev"`},
+		{"secret names", `access_key = "AKIA123"
+secret_key = "abc"
+token = "ghp_x"
+  private_key = "k"
+key = "k2"
+password="p"`, `access_key = "[REDACTED]"
+secret_key = "[REDACTED]"
+token = "[REDACTED]"
+  private_key = "[REDACTED]"
+key = "[REDACTED]"
+password="[REDACTED]"`},
+		{"heredoc", `private_key = <<EOT
+-----BEGIN KEY-----
+abc
+-----END KEY-----
+EOT
+region = "x"`, `private_key = "[REDACTED]"
+region = "x"`},
+		{"indented heredoc", `  credentials = <<-JSON
+    {"secret": "s"}
+    JSON
+  project = "p"`, `  credentials = "[REDACTED]"
+  project = "p"`},
+		{"multi-line list", `api_keys = [
+  "a",
+  "b]",
+]
+regions = ["*"]`, `api_keys = "[REDACTED]"
+regions = ["*"]`},
+		{"multi-line object", `auth = {
+  user = "u" # }
+  pass = "p"
+}
+x = 1`, `auth = "[REDACTED]"
+x = 1`},
+		{"blocks around attributes", `connection "aws" {
+  secret_key = "s"
+}`, `connection "aws" {
+  secret_key = "[REDACTED]"
+}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactHCL(tt.config, defaultRedactedParams); got != tt.want {
+				t.Errorf("redactHCL:\n got: %q\nwant: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSteampipeCacheEnvironment(t *testing.T) {
+	on, ttl := true, 60
+	tests := []struct {
+		name      string
+		config    SteampipeConfig
+		wantCache bool
+		wantTTL   int
+	}{
+		{"default is off", SteampipeConfig{}, false, steampipeDefaultCacheTTL},
+		{"turned on", SteampipeConfig{Cache: &on}, true, steampipeDefaultCacheTTL},
+		{"ttl", SteampipeConfig{Cache: &on, CacheTTL: &ttl}, true, 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A cache turned on in the environment doesn't turn it on
+			t.Setenv("STEAMPIPE_CACHE", "true")
+			t.Setenv("STEAMPIPE_CACHE_MAX_TTL", "")
+
+			if _, err := newSteampipeSetup(tt.config, nil, "."); err != nil {
+				t.Fatalf("newSteampipeSetup: %v", err)
+			}
+			if cache, ttl := steampipeCacheSettings(); cache != tt.wantCache || ttl != tt.wantTTL {
+				t.Errorf("cache settings = %v, %d; want %v, %d", cache, ttl, tt.wantCache, tt.wantTTL)
+			}
+		})
+	}
+}
+
+// A stand-in for a Steampipe plugin: fake_value() returns a cached result until the
+// plugin is configured with a different config, as Steampipe's cache does
+type fakePlugin struct {
+	mu      sync.Mutex
+	config  string
+	fetches int
+	cached  int
+}
+
+func (p *fakePlugin) configure(config string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if config != p.config {
+		p.config, p.cached = config, 0
+	}
+	return "ok"
+}
+
+func (p *fakePlugin) value() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cached == 0 {
+		p.fetches++
+		p.cached = p.fetches
+	}
+	return p.cached
+}
+
+var (
+	fakeSteampipe         = &fakePlugin{}
+	registerFakeSteampipe sync.Once
+)
+
+// A database whose connections have the fake plugin's functions
+func openFakeSteampipe(t *testing.T) *sql.DB {
+	registerFakeSteampipe.Do(func() {
+		sql.Register("sqlite3_fake_steampipe", &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				if err := conn.RegisterFunc("steampipe_configure_fake", fakeSteampipe.configure, false); err != nil {
+					return err
+				}
+				return conn.RegisterFunc("fake_value", fakeSteampipe.value, false)
+			},
+		})
+	})
+	db, err := sql.Open("sqlite3_fake_steampipe", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSteampipeCacheBypass(t *testing.T) {
+	db := openFakeSteampipe(t)
+	plugin := &steampipePlugin{Name: "fake", ConfigSource: "inline", config: `region = "x"`}
+	s := &Server{
+		db:         db,
+		dbType:     "sqlite",
+		adminToken: "admin",
+		steampipe:  &steampipeSetup{plugins: []*steampipePlugin{plugin}},
+	}
+	if _, err := db.Exec(plugin.configureSQL(), plugin.config); err != nil {
+		t.Fatal(err)
+	}
+
+	var value int
+	handler := s.steampipeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.db.QueryRow("SELECT fake_value()").Scan(&value); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	get := func(headers ...string) int {
+		r := httptest.NewRequest("GET", "/query", nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		s.logMiddleware(handler).ServeHTTP(httptest.NewRecorder(), r)
+		return value
+	}
+
+	first := get()
+	if again := get(); again != first {
+		t.Fatalf("cached value changed without a bypass: %d, then %d", first, again)
+	}
+	if refused := get(steampipeCacheHeader, "bypass"); refused != first {
+		t.Errorf("bypass without the admin token got fresh data: %d, want the cached %d", refused, first)
+	}
+	fresh := get(steampipeCacheHeader, "bypass", "X-Admin-Token", "admin")
+	if fresh == first {
+		t.Errorf("bypass with the admin token got the cached %d", fresh)
+	}
+	if after := get(); after != fresh {
+		t.Errorf("value after the bypass = %d, want the refreshed %d to be cached", after, fresh)
+	}
+	if !strings.Contains(fakeSteampipe.config, "cache bypass") || !strings.HasPrefix(fakeSteampipe.config, plugin.config) {
+		t.Errorf("config after the bypass = %q, want the plugin's config with a marker", fakeSteampipe.config)
+	}
+
+	// With bypassing allowed, anyone may
+	s.steampipe.allowBypass = true
+	if got := get(steampipeCacheHeader, "bypass"); got == fresh {
+		t.Errorf("allowed bypass got the cached %d", got)
+	}
+}
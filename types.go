@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// ===== Result Type Mapping =====
+
+// TypeMapping controls how column values are encoded in JSON results. It can be set for the
+// whole API description, per method, or per /query request; unset fields keep the defaults.
+type TypeMapping struct {
+	Blob      string `json:"blob,omitempty"`      // "base64" (default), "hex" or "text"
+	JSON      string `json:"json,omitempty"`      // "embed" (default) to nest JSON/jsonb values, or "text"
+	Numeric   string `json:"numeric,omitempty"`   // "string" (default) keeps decimals exact; "number" emits JSON numbers
+	Timestamp string `json:"timestamp,omitempty"` // "rfc3339" (default), "unix" (seconds) or "unixms"
+}
+
+func defaultTypeMapping() TypeMapping {
+	return TypeMapping{Blob: "base64", JSON: "embed", Numeric: "string", Timestamp: "rfc3339"}
+}
+
+// Merge returns a copy of m with every field that is set in override replacing its counterpart
+func (m TypeMapping) Merge(override *TypeMapping) TypeMapping {
+	if override == nil {
+		return m
+	}
+	if override.Blob != "" {
+		m.Blob = override.Blob
+	}
+	if override.JSON != "" {
+		m.JSON = override.JSON
+	}
+	if override.Numeric != "" {
+		m.Numeric = override.Numeric
+	}
+	if override.Timestamp != "" {
+		m.Timestamp = override.Timestamp
+	}
+	return m
+}
+
+// Broad category of a column from its database type name
+func columnCategory(columnType *sql.ColumnType) string {
+	name := strings.ToUpper(columnType.DatabaseTypeName())
+	switch {
+	case name == "JSON" || name == "JSONB":
+		return "json"
+	case name == "BYTEA" || name == "BLOB":
+		return "blob"
+	case name == "NUMERIC" || strings.HasPrefix(name, "DECIMAL"):
+		return "numeric"
+	}
+	return ""
+}
+
+// Encode one column value for JSON according to the mapping
+func (m TypeMapping) mapValue(value interface{}, category string, dbType string) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		switch {
+		case category == "json":
+			return m.mapJSON(v)
+		case category == "numeric":
+			return m.mapNumeric(string(v))
+		case category == "blob" || dbType == "sqlite":
+			// go-sqlite3 only returns []byte for values stored as BLOBs
+			return m.mapBlob(v)
+		}
+		// Other Postgres types (uuid, inet, ...) arrive as their text form
+		return string(v)
+	case string:
+		if category == "json" {
+			return m.mapJSON([]byte(v))
+		}
+		if category == "numeric" {
+			return m.mapNumeric(v)
+		}
+		return v
+	case time.Time:
+		switch m.Timestamp {
+		case "unix":
+			return v.Unix()
+		case "unixms":
+			return v.UnixMilli()
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+func (m TypeMapping) mapJSON(b []byte) interface{} {
+	if m.JSON == "text" || !json.Valid(b) {
+		return string(b)
+	}
+	return json.RawMessage(b)
+}
+
+func (m TypeMapping) mapNumeric(s string) interface{} {
+	if m.Numeric != "number" {
+		return s
+	}
+	// json.Number is written without quotes; NaN and Infinity have no JSON form
+	if _, err := json.Marshal(json.Number(s)); err != nil {
+		return s
+	}
+	return json.Number(s)
+}
+
+func (m TypeMapping) mapBlob(b []byte) interface{} {
+	switch m.Blob {
+	case "text":
+		return string(b)
+	case "hex":
+		return hex.EncodeToString(b)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTypeMappingMerge(t *testing.T) {
+	got := defaultTypeMapping().Merge(&TypeMapping{Blob: "hex", Timestamp: "unix"})
+	want := TypeMapping{Blob: "hex", JSON: "embed", Numeric: "string", Timestamp: "unix"}
+	if got != want {
+		t.Errorf("Merge = %+v, want %+v", got, want)
+	}
+	if got := defaultTypeMapping().Merge(nil); got != defaultTypeMapping() {
+		t.Errorf("Merge(nil) = %+v, want the defaults", got)
+	}
+}
+
+func TestMapValue(t *testing.T) {
+	stamp := time.Date(2024, 5, 1, 12, 30, 0, 500000000, time.UTC)
+	tests := []struct {
+		name     string
+		mapping  TypeMapping
+		value    interface{}
+		category string
+		dbType   string
+		want     string // JSON encoding of the mapped value
+	}{
+		{"sqlite blob", TypeMapping{}, []byte{0xde, 0xad}, "", "sqlite", `"3q0="`},
+		{"blob as hex", TypeMapping{Blob: "hex"}, []byte{0xde, 0xad}, "blob", "postgres", `"dead"`},
+		{"blob as text", TypeMapping{Blob: "text"}, []byte("abc"), "blob", "postgres", `"abc"`},
+		{"postgres uuid", TypeMapping{}, []byte("0f8e2a1d-5c3b-4e6f-9a7d-2b1c0d9e8f7a"), "", "postgres", `"0f8e2a1d-5c3b-4e6f-9a7d-2b1c0d9e8f7a"`},
+		{"json embedded", TypeMapping{JSON: "embed"}, []byte(`{"a":1}`), "json", "postgres", `{"a":1}`},
+		{"json from string", TypeMapping{JSON: "embed"}, `[1,2]`, "json", "sqlite", `[1,2]`},
+		{"json as text", TypeMapping{JSON: "text"}, []byte(`{"a":1}`), "json", "postgres", `"{\"a\":1}"`},
+		{"invalid json", TypeMapping{JSON: "embed"}, "{oops", "json", "sqlite", `"{oops"`},
+		{"numeric as string", TypeMapping{Numeric: "string"}, []byte("12345678901234567890.01"), "numeric", "postgres", `"12345678901234567890.01"`},
+		{"numeric as number", TypeMapping{Numeric: "number"}, []byte("12345678901234567890.01"), "numeric", "postgres", `12345678901234567890.01`},
+		{"numeric NaN", TypeMapping{Numeric: "number"}, "NaN", "numeric", "postgres", `"NaN"`},
+		{"timestamp", TypeMapping{}, stamp, "", "postgres", `"2024-05-01T12:30:00.5Z"`},
+		{"timestamp unix", TypeMapping{Timestamp: "unix"}, stamp, "", "postgres", `1714566600`},
+		{"timestamp unixms", TypeMapping{Timestamp: "unixms"}, stamp, "", "postgres", `1714566600500`},
+		{"integer", TypeMapping{}, int64(42), "", "sqlite", `42`},
+		{"null", TypeMapping{}, nil, "json", "sqlite", `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := json.Marshal(tt.mapping.mapValue(tt.value, tt.category, tt.dbType))
+			if err != nil {
+				t.Fatalf("json.Marshal: %v", err)
+			}
+			if string(encoded) != tt.want {
+				t.Errorf("mapped to %s, want %s", encoded, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryTypes(t *testing.T) {
+	s := newTestServer(t, `
+		CREATE TABLE files (id INTEGER PRIMARY KEY, data BLOB, meta JSON, price NUMERIC);
+		INSERT INTO files VALUES (1, x'0102', '{"tags":["a"]}', 9.5);`)
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"defaults", `{"sql": "SELECT data, meta FROM files"}`, `[{"data":"AQI=","meta":{"tags":["a"]}}]`},
+		{"request types", `{"sql": "SELECT data, meta FROM files", "types": {"blob": "hex", "json": "text"}}`,
+			`[{"data":"0102","meta":"{\"tags\":[\"a\"]}"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveTest(s, http.HandlerFunc(s.handleQuery), "POST", "/query", tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var got interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if gotJSON, _ := json.Marshal(got); string(gotJSON) != tt.want {
+				t.Errorf("response %s, want %s", gotJSON, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,18 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -18,6 +24,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	_ "github.com/lib/pq"           // PostgreSQL driver
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
@@ -26,8 +33,11 @@ import (
 // ===== Data Structures =====
 
 type QueryRequest struct {
-	SQL    string        `json:"sql"`
-	Params []interface{} `json:"params"`
+	SQL     string        `json:"sql"`
+	Params  []interface{} `json:"params"`
+	Types   *TypeMapping  `json:"types,omitempty"`   // Overrides the result type mapping
+	Format  string        `json:"format,omitempty"`  // "objects" (default), "envelope" or "arrays"
+	MaxRows int           `json:"maxRows,omitempty"` // Overrides --max-rows
 }
 
 // API Description structures
@@ -36,19 +46,58 @@ type APIDescription struct {
 	Name        string               `json:"name"`
 	Description string               `json:"description"`
 	BasePath    string               `json:"basePath"`
+	CORS        *CORSConfig          `json:"cors,omitempty"`
+	CRUD        *CRUDConfig          `json:"crud,omitempty"`      // Generated REST resources for tables and views
+	Types       *TypeMapping         `json:"types,omitempty"`     // Result type mapping for every endpoint
+	RateLimit   *RateLimitConfig     `json:"rateLimit,omitempty"` // Per-client limit on all dynamic requests
+	GraphQL     *GraphQLConfig       `json:"graphql,omitempty"`   // Tables exposed through /graphql
+	Audit       *AuditConfig         `json:"audit,omitempty"`     // Record every data-modifying statement
+	Steampipe   *SteampipeConfig     `json:"steampipe,omitempty"` // Plugin connection config and caching for Steampipe extensions
 	Endpoints   []EndpointDefinition `json:"endpoints"`
 }
 
 type EndpointDefinition struct {
 	Path    string                      `json:"path"`
 	Methods map[string]MethodDefinition `json:"methods"`
+	CORS    *CORSConfig                 `json:"cors,omitempty"` // Overrides the global CORS policy
+
+	RateLimit   *RateLimitConfig   `json:"rateLimit,omitempty"`   // Per-client limit for this endpoint, on top of the global one
+	Concurrency *ConcurrencyConfig `json:"concurrency,omitempty"` // Cap on concurrent executions
 }
 
 type MethodDefinition struct {
-	Description string   `json:"description"`
-	SQL         string   `json:"sql,omitempty"`
-	SQLFile     string   `json:"sqlFile,omitempty"`
-	Params      []string `json:"params,omitempty"`
+	Description  string       `json:"description"`
+	SQL          string       `json:"sql,omitempty"`
+	SQLFile      string       `json:"sqlFile,omitempty"`
+	Params       []string     `json:"params,omitempty"`
+	Types        *TypeMapping `json:"types,omitempty"`        // Overrides the API-wide result type mapping
+	Exec         *bool        `json:"exec,omitempty"`         // Run with Exec (default: detected from the SQL)
+	IDColumn     string       `json:"idColumn,omitempty"`     // Postgres: column returned as lastInsertId via RETURNING
+	Location     string       `json:"location,omitempty"`     // POST: Location header template, e.g. "/api/clients/{lastInsertId}"
+	Result       string       `json:"result,omitempty"`       // Result shape: "rows" (default), "single", "scalar" or "column"
+	Column       string       `json:"column,omitempty"`       // Column used by "scalar" and "column" (default: the first)
+	Format       string       `json:"format,omitempty"`       // "objects" (default), "envelope" or "arrays"
+	MaxRows      int          `json:"maxRows,omitempty"`      // Overrides --max-rows
+	MaxBodyBytes int64        `json:"maxBodyBytes,omitempty"` // Overrides --max-body-bytes
+	GraphQL      string       `json:"graphql,omitempty"`      // GET: name of the /graphql query field (default: from the path)
+
+	// Named queries whose results are nested into each row
+	Nested map[string]MethodDefinition `json:"nested,omitempty"`
+	Join   map[string]string           `json:"join,omitempty"` // Nested query: child column -> parent column
+}
+
+// ExecResult is the response for statements that don't return rows
+type ExecResult struct {
+	RowsAffected int64       `json:"rowsAffected"`
+	LastInsertID interface{} `json:"lastInsertId"` // null when the database can't report it
+}
+
+// Check whether a method's SQL should run with Exec
+func (m MethodDefinition) isExec(sqlQuery string, dbType string) bool {
+	if m.Exec != nil {
+		return *m.Exec
+	}
+	return isWriteStatement(sqlQuery, dbType)
 }
 
 type Server struct {
@@ -58,76 +107,98 @@ type Server struct {
 	pathRegexps   map[string]*regexp.Regexp // Cache for compiled path regexps
 	showResponses bool                      // Flag to enable/disable response logging
 	dbType        string                    // Type of database: "sqlite" or "postgres"
-	mu            sync.Mutex                // Mutex to serialize DB access
+	dbTarget      string                    // Database file, or PostgreSQL user@host:port/dbname
+	cors          CORSConfig                // Global CORS policy
+	adminToken    string                    // Token required by /admin/ endpoints (none if empty)
+	fixtures      *fixtureState             // Fixture files loaded at startup
+	pristine      *sql.DB                   // In-memory copy of the fixture state (SQLite only)
+	snapshotDir   string                    // Directory holding named snapshots (SQLite only)
+	crud          map[string]*crudResource  // Generated resources by collection path
+	types         TypeMapping               // Default result type mapping
+	maxRows       int                       // Row limit for queries (0 for none)
+	maxBodyBytes  int64                     // Request body size limit (0 for none)
+
+	rateLimit          *rateLimiter                   // Global per-client rate limit (nil for none)
+	endpointRateLimits map[string]*rateLimiter        // Per-endpoint rate limits by endpoint path
+	endpointSlots      map[string]*concurrencyLimiter // Per-endpoint concurrency caps by endpoint path
+	graphql            *gqlSchema                     // Schema served at /graphql (nil when disabled)
+	trustedProxies     []*net.IPNet                   // Peers whose X-Forwarded-For header is believed
+	audit              *AuditConfig                   // Audit trail of data-modifying statements (nil when off)
+	requestLog         *requestLog                    // Where completed requests are recorded (nil for none)
+	redactParams       []string                       // Param names whose values are never recorded
+	recent             *recentRequests                // Recent requests shown by the console (nil when it is off)
+	consolePath        string                         // Path the console is served under (empty when it is off)
+	steampipe          *steampipeSetup                // Steampipe plugins among the extensions (nil when none)
+	mu                 sync.Mutex                     // Serializes SQLite access and admin operations (see lockDB)
 }
 
 // ===== Server Initialization =====
 
-func NewServer(dbPath string, pgConnStr string, extensionPath string, apiDescPath string, showResponses bool) (*Server, error) {
+func NewServer(dbPath string, pg PostgresConfig, extensions ExtensionConfig, apiDescPath string, showResponses bool) (*Server, error) {
 	var db *sql.DB
 	var err error
-	var dbType string
+	var dbType, dbTarget string
+
+	// Load the API description if provided; its Steampipe settings apply as extensions load
+	var apiDesc *APIDescription
+	if apiDescPath != "" {
+		if _, err := os.Stat(apiDescPath); os.IsNotExist(err) {
+			log.Printf("API description file not found: %s", apiDescPath)
+		} else {
+			loaded, err := loadAPIDescription(apiDescPath)
+			if err != nil {
+				log.Printf("Warning: Failed to load API description: %v", err)
+			} else {
+				apiDesc = &loaded
+			}
+		}
+	}
+	var steampipe *steampipeSetup
 
 	// Determine which database to use
-	if pgConnStr != "" {
-		// Use PostgreSQL if pgConnStr is provided
-		log.Println("Using PostgreSQL database")
-		db, err = sql.Open("postgres", pgConnStr)
+	if pg.ConnStr != "" {
+		// Use PostgreSQL if a connection string is provided, once it accepts connections
+		log.Printf("Using PostgreSQL database: %s", pg.describe())
+		db, err = openPostgres(pg)
 		if err != nil {
-			return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+			return nil, err
 		}
 		dbType = "postgres"
+		dbTarget = pg.describe()
 	} else {
-		// Default to SQLite
+		// Default to SQLite, loading the extensions on every connection
 		log.Println("Using SQLite database")
-		// Simple connection string with extension loading enabled
-		db, err = sql.Open("sqlite3", dbPath+"?_allow_load_extension=1")
+
+		// Steampipe settings from the API description, overridden by the command line
+		steampipeConfig, configDir := steampipeSettings(apiDesc, apiDescPath, extensions.Steampipe)
+		steampipe, err = newSteampipeSetup(steampipeConfig, extensions.Extensions, configDir)
+		if err != nil {
+			return nil, err
+		}
+		db, err = openSQLite(dbPath+"?_allow_load_extension=1", extensions.Extensions, extensions.Required, steampipe, extensions.Attach)
 		if err != nil {
 			return nil, fmt.Errorf("failed to connect to SQLite: %w", err)
 		}
 		dbType = "sqlite"
+		dbTarget = dbPath
 
 		// SQLite specific configurations
 		db.SetMaxOpenConns(1)
 		db.SetMaxIdleConns(1)
 
-		// Create memory database for extensions
-		if _, err := db.Exec(`ATTACH DATABASE ':memory:' AS extension_mem`); err != nil {
-			log.Printf("Failed to attach memory database: %v", err)
+		// Connect now, so extensions that fail to load are reported at startup
+		if len(extensions.Extensions) > 0 {
+			log.Printf("Loading extensions: %s", joinExtensions(extensions.Extensions))
+			if err := db.Ping(); err != nil {
+				db.Close()
+				return nil, err
+			}
 		}
 
 		// Enable extension loading via PRAGMA
 		if _, err := db.Exec(`PRAGMA load_extension = 1;`); err != nil {
 			log.Printf("Warning: PRAGMA load_extension failed: %v", err)
 		}
-
-		// If extension is provided, try to load it
-		if extensionPath != "" {
-			var mu sync.Mutex
-			mu.Lock()
-			defer mu.Unlock()
-			// Get the absolute path to the extension file
-			absPath, err := filepath.Abs(extensionPath)
-			if err != nil {
-				log.Printf("Warning: failed to get absolute path: %v", err)
-				absPath = "./" + extensionPath
-			}
-
-			// Ensure file has execute permissions (required for Linux)
-			if err := os.Chmod(absPath, 0755); err != nil {
-				log.Printf("Warning: failed to set execute permissions on extension: %v", err)
-			}
-
-			// Log extension loading attempt
-			log.Printf("Trying to load extension: %s", absPath)
-
-			loadQuery := fmt.Sprintf("SELECT load_extension('%s')", strings.ReplaceAll(absPath, "'", "''"))
-			if _, err := db.Exec(loadQuery); err != nil {
-				log.Printf("Extension loading failed with %v", err)
-			} else {
-				log.Println("Extension loaded successfully")
-			}
-		}
 	}
 
 	// Initialize the server
@@ -136,29 +207,28 @@ func NewServer(dbPath string, pgConnStr string, extensionPath string, apiDescPat
 		pathRegexps:   make(map[string]*regexp.Regexp),
 		showResponses: showResponses,
 		dbType:        dbType,
+		dbTarget:      dbTarget,
 		apiDescPath:   apiDescPath,
+		cors:          defaultCORSConfig(),
+		types:         defaultTypeMapping(),
+		steampipe:     steampipe,
 		mu:            sync.Mutex{},
 	}
 
-	// Load the API description if provided
-	if apiDescPath != "" {
-		if _, err := os.Stat(apiDescPath); os.IsNotExist(err) {
-			log.Printf("API description file not found: %s", apiDescPath)
-		} else {
-			apiDesc, err := loadAPIDescription(apiDescPath)
-			if err != nil {
-				log.Printf("Warning: Failed to load API description: %v", err)
-			} else {
-				server.apiDesc = &apiDesc
-				log.Printf("API description loaded successfully: %s (v%s)", apiDesc.Name, apiDesc.APIVersion)
-
-				// Precompile the path regexps for faster matching
-				for _, endpoint := range apiDesc.Endpoints {
-					pathRegexp := pathToRegexp(endpoint.Path)
-					server.pathRegexps[endpoint.Path] = regexp.MustCompile(pathRegexp)
-				}
-			}
+	// Apply the API description
+	if apiDesc != nil {
+		server.apiDesc = apiDesc
+		server.cors = server.cors.Merge(apiDesc.CORS)
+		server.types = server.types.Merge(apiDesc.Types)
+		log.Printf("API description loaded successfully: %s (v%s)", apiDesc.Name, apiDesc.APIVersion)
+
+		// Precompile the path regexps for faster matching
+		for _, endpoint := range apiDesc.Endpoints {
+			pathRegexp := pathToRegexp(endpoint.Path)
+			server.pathRegexps[endpoint.Path] = regexp.MustCompile(pathRegexp)
 		}
+
+		server.validateMethods()
 	}
 
 	return server, nil
@@ -278,6 +348,59 @@ func (s *Server) findMatchingEndpoint(requestPath string) (*EndpointDefinition,
 	return nil, nil
 }
 
+// Get the SQL for a method, reading it from its file if it has one
+func (s *Server) methodSQL(methodDef MethodDefinition) (string, error) {
+	if methodDef.SQLFile == "" {
+		// Use the inline SQL from the API definition
+		return methodDef.SQL, nil
+	}
+
+	// Build the SQL file path relative to the API description file
+	sqlFilePath := filepath.Join(filepath.Dir(s.apiDescPath), methodDef.SQLFile)
+	log.Printf("Loading SQL from file: %s", sqlFilePath)
+
+	sqlBytes, err := os.ReadFile(sqlFilePath)
+	if err != nil {
+		return "", err
+	}
+	return string(sqlBytes), nil
+}
+
+// Report SQL that references parameters its method doesn't declare, and unknown result shapes
+func (s *Server) validateMethods() {
+	for _, endpoint := range s.apiDesc.Endpoints {
+		for method, methodDef := range endpoint.Methods {
+			s.validateMethod(method+" "+endpoint.Path, methodDef)
+		}
+	}
+}
+
+func (s *Server) validateMethod(label string, methodDef MethodDefinition) {
+	sqlQuery, err := s.methodSQL(methodDef)
+	if err != nil {
+		log.Printf("Warning: %s: failed to read SQL file: %v", label, err)
+		return
+	}
+	for _, name := range undeclaredParams(sqlQuery, s.dbType, methodDef.Params) {
+		log.Printf("Warning: %s: SQL references undeclared parameter :%s", label, name)
+	}
+	if methodDef.Result != "" && !containsString(resultShapes, methodDef.Result) {
+		log.Printf("Warning: %s: unknown result shape %q", label, methodDef.Result)
+	}
+	if len(methodDef.Nested) > 0 && (methodDef.Result == shapeScalar || methodDef.Result == shapeColumn) {
+		log.Printf("Warning: %s: nested queries are ignored with result shape %q", label, methodDef.Result)
+	}
+	if methodDef.Format != "" && !containsString(resultFormats, methodDef.Format) {
+		log.Printf("Warning: %s: unknown format %q", label, methodDef.Format)
+	}
+	if methodDef.Format != "" && methodDef.Format != formatObjects && methodDef.Result != "" && methodDef.Result != shapeRows {
+		log.Printf("Warning: %s: result shape %q is ignored with format %q", label, methodDef.Result, methodDef.Format)
+	}
+	for name, child := range methodDef.Nested {
+		s.validateMethod(label+" > "+name, child)
+	}
+}
+
 // ===== Parameter Extraction =====
 
 // Extract query parameters from request URL
@@ -291,26 +414,96 @@ func extractQueryParams(r *http.Request) map[string]string {
 	return queryParams
 }
 
-// Extract JSON body parameters from request
-func extractBodyParams(r *http.Request) (map[string]interface{}, error) {
+// A request body the server can't accept, with the status to answer
+type bodyError struct {
+	status int
+	err    error
+}
+
+func (e *bodyError) Error() string { return e.err.Error() }
+
+// Answer a body error with its status (400 for other errors)
+func sendBodyError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	var be *bodyError
+	if errors.As(err, &be) {
+		status = be.status
+	}
+	sendErrorResponse(w, err.Error(), status)
+}
+
+// The body size limit for a method: its own, else --max-body-bytes
+func (s *Server) bodyLimit(maxBodyBytes int64) int64 {
+	if maxBodyBytes > 0 {
+		return maxBodyBytes
+	}
+	return s.maxBodyBytes
+}
+
+// Extract body parameters from a JSON, form-urlencoded or multipart body of at most maxBytes.
+// An uploaded file is bound as a BLOB under its field name, with <field>_filename,
+// <field>_mimetype and <field>_size alongside it.
+func extractBodyParams(w http.ResponseWriter, r *http.Request, maxBytes int64) (map[string]interface{}, error) {
 	bodyParams := make(map[string]interface{})
 
 	if r.Body == nil {
 		return bodyParams, nil
 	}
+	if maxBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return bodyParams, readBodyError(err, "invalid form body")
+		}
+		for key, values := range r.PostForm {
+			if len(values) > 0 {
+				bodyParams[key] = values[0]
+			}
+		}
+		return bodyParams, nil
+
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(min(maxBytes, 32<<20)); err != nil {
+			return bodyParams, readBodyError(err, "invalid multipart body")
+		}
+		defer r.MultipartForm.RemoveAll()
+		for key, values := range r.MultipartForm.Value {
+			if len(values) > 0 {
+				bodyParams[key] = values[0]
+			}
+		}
+		for key, files := range r.MultipartForm.File {
+			if len(files) == 0 {
+				continue
+			}
+			data, err := readUpload(files[0])
+			if err != nil {
+				return bodyParams, readBodyError(err, "failed to read upload")
+			}
+			bodyParams[key] = data
+			bodyParams[key+"_filename"] = files[0].Filename
+			bodyParams[key+"_mimetype"] = files[0].Header.Get("Content-Type")
+			bodyParams[key+"_size"] = files[0].Size
+		}
+		return bodyParams, nil
+	}
 
 	var bodyBuffer bytes.Buffer
 	bodyReader := io.TeeReader(r.Body, &bodyBuffer)
 
 	bodyBytes, err := io.ReadAll(bodyReader)
 	if err != nil {
-		return bodyParams, err
+		return bodyParams, readBodyError(err, "failed to read body")
 	}
 
-	if len(bodyBytes) > 0 {
+	if len(bytes.TrimSpace(bodyBytes)) > 0 {
 		err = json.Unmarshal(bodyBytes, &bodyParams)
 		if err != nil {
-			return bodyParams, err
+			return bodyParams, &bodyError{http.StatusBadRequest, fmt.Errorf("invalid JSON body: %v", err)}
 		}
 	}
 
@@ -320,26 +513,103 @@ func extractBodyParams(r *http.Request) (map[string]interface{}, error) {
 	return bodyParams, nil
 }
 
+// Turn a body read error into a bodyError: 413 when the body is over the limit
+func readBodyError(err error, message string) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return &bodyError{http.StatusRequestEntityTooLarge, fmt.Errorf("request body too large (limit %d bytes)", tooLarge.Limit)}
+	}
+	return &bodyError{http.StatusBadRequest, fmt.Errorf("%s: %v", message, err)}
+}
+
+// Read an uploaded file into memory
+func readUpload(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
 // ===== SQL Execution =====
 
 // Execute SQL query and return results as maps
-func (s *Server) executeQuery(sqlQuery string, params []interface{}) ([]map[string]interface{}, error) {
+func (s *Server) executeQuery(ctx context.Context, sqlQuery string, params []interface{}) ([]map[string]interface{}, error) {
+	return s.executeQueryWithTypes(ctx, sqlQuery, params, s.types)
+}
+
+// Execute SQL query and return results as maps, encoding values with the given type mapping
+func (s *Server) executeQueryWithTypes(ctx context.Context, sqlQuery string, params []interface{}, types TypeMapping) ([]map[string]interface{}, error) {
+	result, err := s.runQuery(ctx, sqlQuery, params, types, 0)
+	if err != nil {
+		return nil, err
+	}
+	return result.maps(), nil
+}
+
+// Rows of a query result, with the columns in select order
+type queryResult struct {
+	Columns   []string
+	Types     []string        // Database type names of the columns
+	Rows      [][]interface{} // Mapped values, in column order
+	Truncated bool            // More rows were available than the limit allowed
+	Duration  time.Duration   // Time spent running the query and reading its rows
+}
+
+// Convert the rows to one map per row; nil when there are no rows
+func (q *queryResult) maps() []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, row := range q.Rows {
+		entry := make(map[string]interface{})
+		for i, col := range q.Columns {
+			entry[col] = row[i]
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// Serialize access to SQLite's single connection. Postgres statements run concurrently on the pool.
+func (s *Server) lockDB() (unlock func()) {
+	if s.dbType == "postgres" {
+		return func() {}
+	}
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.mu.Unlock
+}
+
+// Execute a SQL query, keeping the column order. With maxRows > 0, reading stops after that many rows.
+func (s *Server) runQuery(ctx context.Context, sqlQuery string, params []interface{}, types TypeMapping, maxRows int) (*queryResult, error) {
+	defer s.lockDB()()
+	start := time.Now()
 
 	// Log the SQL query (just once)
-	log.Printf("SQL: %s", sqlQuery)
+	logger(ctx).Info("SQL", "sql", sqlQuery)
 
 	// Handle PostgreSQL parameter placeholders ($1, $2, etc.) vs SQLite (?, ?, etc.)
-	if s.dbType == "postgres" {
-		// Replace ? with $1, $2, etc. for PostgreSQL
-		for i := 1; i <= len(params); i++ {
-			sqlQuery = strings.Replace(sqlQuery, "?", fmt.Sprintf("$%d", i), 1)
+	boundQuery := bindPositional(sqlQuery, s.dbType)
+
+	// Execute the query, auditing it if it writes
+	var result *queryResult
+	err := s.audited(ctx, sqlQuery, params, func(q sqlQuerier) (int64, error) {
+		var err error
+		result, err = s.readRows(ctx, q, boundQuery, params, types, maxRows)
+		if err != nil {
+			return 0, err
 		}
+		return int64(len(result.Rows)), nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	result.Duration = time.Since(start)
+	return result, nil
+}
 
-	// Execute the query
-	rows, err := s.db.Query(sqlQuery, params...)
+// Run a query and read its rows, mapping values with the given type mapping
+func (s *Server) readRows(ctx context.Context, q sqlQuerier, sqlQuery string, params []interface{}, types TypeMapping, maxRows int) (*queryResult, error) {
+	rows, err := q.QueryContext(ctx, sqlQuery, params...)
 	if err != nil {
 		return nil, err
 	}
@@ -350,10 +620,25 @@ func (s *Server) executeQuery(sqlQuery string, params []interface{}) ([]map[stri
 	if err != nil {
 		return nil, err
 	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	categories := make([]string, len(columnTypes))
+	typeNames := make([]string, len(columnTypes))
+	for i, columnType := range columnTypes {
+		categories[i] = columnCategory(columnType)
+		typeNames[i] = columnType.DatabaseTypeName()
+	}
 
 	// Process result rows
-	var result []map[string]interface{}
+	result := &queryResult{Columns: columns, Types: typeNames}
 	for rows.Next() {
+		if maxRows > 0 && len(result.Rows) == maxRows {
+			result.Truncated = true
+			break
+		}
+
 		// Create values slice with appropriate length
 		values := make([]interface{}, len(columns))
 		valuePtrs := make([]interface{}, len(columns))
@@ -366,37 +651,119 @@ func (s *Server) executeQuery(sqlQuery string, params []interface{}) ([]map[stri
 			return nil, err
 		}
 
-		// Create a map for this row
-		entry := make(map[string]interface{})
-		for i, col := range columns {
-			var v interface{}
-			val := values[i]
-			b, ok := val.([]byte)
-			if ok {
-				v = string(b)
-			} else {
-				v = val
-			}
-			entry[col] = v
+		for i := range values {
+			values[i] = types.mapValue(values[i], categories[i], s.dbType)
 		}
-
-		// Add the row to the result
-		result = append(result, entry)
+		result.Rows = append(result.Rows, values)
 	}
 
 	// Check for errors after iteration
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	return result, nil
+}
 
-	// Log the response if enabled
-	if s.showResponses {
-		// Response logging is done in sendJSONResponse
+// Run a method's bound query and nest the results of its child queries into the rows
+func (s *Server) queryMethod(ctx context.Context, methodDef MethodDefinition, sqlQuery string, sqlParams []interface{}, paramValue func(string) interface{}) (*queryResult, []map[string]interface{}, error) {
+	types := s.types.Merge(methodDef.Types)
+	result, err := s.runQuery(ctx, sqlQuery, sqlParams, types, s.rowLimit(methodDef.MaxRows))
+	if err != nil {
+		return nil, nil, err
 	}
+	rows := result.maps()
+	if err := s.nestResults(ctx, rows, methodDef.Nested, paramValue, types); err != nil {
+		return nil, nil, err
+	}
+	return result, rows, nil
+}
+
+// The row limit for a query: the method's or request's own, else --max-rows
+func (s *Server) rowLimit(maxRows int) int {
+	if maxRows > 0 {
+		return maxRows
+	}
+	return s.maxRows
+}
+
+// Execute a statement that doesn't return rows and report what it did
+func (s *Server) executeStatement(ctx context.Context, sqlQuery string, params []interface{}, idColumn string) (ExecResult, error) {
+	defer s.lockDB()()
 
+	logger(ctx).Info("SQL (exec)", "sql", sqlQuery)
+	boundQuery := bindPositional(sqlQuery, s.dbType)
+
+	var result ExecResult
+	err := s.audited(ctx, sqlQuery, params, func(q sqlQuerier) (int64, error) {
+		var err error
+		result, err = s.execStatement(ctx, q, boundQuery, params, idColumn)
+		return result.RowsAffected, err
+	})
+	return result, err
+}
+
+// Execute a bound statement against a database or transaction
+func (s *Server) execStatement(ctx context.Context, q sqlQuerier, sqlQuery string, params []interface{}, idColumn string) (ExecResult, error) {
+	// lib/pq doesn't support LastInsertId, so ask for the key with RETURNING instead
+	if s.dbType == "postgres" && idColumn != "" {
+		if statementKeyword(sqlQuery, s.dbType) == "INSERT" {
+			sqlQuery = strings.TrimRight(sqlQuery, "; \t\r\n") + " RETURNING " + quoteIdent(idColumn)
+			rows, err := q.QueryContext(ctx, sqlQuery, params...)
+			if err != nil {
+				return ExecResult{}, err
+			}
+			defer rows.Close()
+
+			var result ExecResult
+			for rows.Next() {
+				var id interface{}
+				if err := rows.Scan(&id); err != nil {
+					return ExecResult{}, err
+				}
+				if result.RowsAffected == 0 {
+					result.LastInsertID = s.types.mapValue(id, "", s.dbType)
+				}
+				result.RowsAffected++
+			}
+			return result, rows.Err()
+		}
+	}
+
+	res, err := q.ExecContext(ctx, sqlQuery, params...)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	var result ExecResult
+	if result.RowsAffected, err = res.RowsAffected(); err != nil {
+		logger(ctx).Warn("rows affected not available", "error", err)
+	}
+	// SQLite's last insert rowid outlives the statement, so only report it for inserts that inserted
+	keyword := statementKeyword(sqlQuery, s.dbType)
+	if s.dbType == "sqlite" && (keyword == "INSERT" || keyword == "REPLACE") && result.RowsAffected > 0 {
+		if id, err := res.LastInsertId(); err == nil {
+			result.LastInsertID = id
+		}
+	}
 	return result, nil
 }
 
+// Expand a Location template: {lastInsertId} and {param} are replaced with their values
+func expandLocation(template string, result ExecResult, paramValue func(string) interface{}) string {
+	return regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`).ReplaceAllStringFunc(template, func(m string) string {
+		name := m[1 : len(m)-1]
+		var value interface{}
+		if name == "lastInsertId" {
+			value = result.LastInsertID
+		} else {
+			value = paramValue(name)
+		}
+		if value == nil {
+			return ""
+		}
+		return url.PathEscape(fmt.Sprint(value))
+	})
+}
+
 // ===== HTTP Response Handling =====
 
 // Send JSON response with the given status code
@@ -407,7 +774,7 @@ func (s *Server) sendJSONResponse(w http.ResponseWriter, data interface{}, statu
 	// Generate JSON response
 	responseJSON, err := json.Marshal(data)
 	if err != nil {
-		log.Printf("Error encoding JSON response: %v", err)
+		responseLogger(w).Error("encoding JSON response failed", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -416,21 +783,25 @@ func (s *Server) sendJSONResponse(w http.ResponseWriter, data interface{}, statu
 	if s.showResponses {
 		var prettyJSON bytes.Buffer
 		if err := json.Indent(&prettyJSON, responseJSON, "", "  "); err != nil {
-			log.Printf("Error prettifying JSON for logging: %v", err)
+			responseLogger(w).Error("prettifying JSON for logging failed", "error", err)
 		} else {
-			log.Printf("Response: %s", prettyJSON.String())
+			responseLogger(w).Info("Response", "status", statusCode, "body", prettyJSON.String())
 		}
 	}
 
 	// Send the response
 	if _, err := w.Write(responseJSON); err != nil {
-		log.Printf("Error writing response: %v", err)
+		responseLogger(w).Warn("writing response failed", "error", err)
 	}
 }
 
 // Send error response with the given status code
 func sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
-	log.Printf("Error: %s (Status: %d)", message, statusCode)
+	level := slog.LevelWarn
+	if statusCode >= 500 {
+		level = slog.LevelError
+	}
+	responseLogger(w).Log(context.Background(), level, "Error", "error", message, "status", statusCode)
 	http.Error(w, message, statusCode)
 }
 
@@ -438,7 +809,8 @@ func sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
 
 // Handle API requests based on the API description
 func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
-	log.Printf("API: %s %s", r.Method, r.URL.Path)
+	logger(r.Context()).Debug("API", "method", r.Method, "path", r.URL.Path)
+	start := time.Now()
 
 	if s.apiDesc == nil {
 		sendErrorResponse(w, "API description not loaded", http.StatusInternalServerError)
@@ -448,6 +820,11 @@ func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
 	// Find the matching endpoint
 	endpoint, pathParams := s.findMatchingEndpoint(r.URL.Path)
 	if endpoint == nil {
+		// Fall back to generated CRUD resources
+		if resource, key := s.findCRUDResource(r.URL.EscapedPath()); resource != nil {
+			s.handleCRUD(w, r, resource, key)
+			return
+		}
 		http.NotFound(w, r)
 		return
 	}
@@ -455,83 +832,118 @@ func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
 	// Check if the method is supported
 	methodDef, exists := endpoint.Methods[r.Method]
 	if !exists {
-		log.Printf("Method %s not allowed for endpoint %s", r.Method, endpoint.Path)
+		logger(r.Context()).Debug("method not allowed", "method", r.Method, "endpoint", endpoint.Path)
 		sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	// Apply the endpoint's own limits
+	if limiter := s.endpointRateLimits[endpoint.Path]; limiter != nil && !limiter.check(w, r) {
+		return
+	}
+	if slots := s.endpointSlots[endpoint.Path]; slots != nil {
+		if !slots.acquire(r.Context()) {
+			logger(r.Context()).Warn("concurrency limit reached", "endpoint", endpoint.Path)
+			sendErrorResponse(w, "Server busy", http.StatusServiceUnavailable)
+			return
+		}
+		defer slots.release()
+	}
+
 	// Extract parameters
 	queryParams := extractQueryParams(r)
 
-	bodyParams, err := extractBodyParams(r)
+	bodyParams, err := extractBodyParams(w, r, s.bodyLimit(methodDef.MaxBodyBytes))
 	if err != nil {
-		log.Printf("Warning: Failed to parse request body as JSON: %v", err)
+		sendBodyError(w, err)
+		return
 	}
 
 	// Prepare SQL query
-	sqlQuery := ""
+	sqlQuery, err := s.methodSQL(methodDef)
+	if err != nil {
+		sendErrorResponse(w, fmt.Sprintf("Failed to read SQL file: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Look up a param: path params first, then query params, then body params
+	paramValue := func(paramName string) interface{} {
+		if value, ok := pathParams[paramName]; ok {
+			return value
+		} else if value, ok := queryParams[paramName]; ok {
+			return value
+		} else if value, ok := bodyParams[paramName]; ok {
+			return value
+		}
+		// Parameter not found
+		return nil
+	}
 
-	// Check if SQL should be loaded from a file
-	if methodDef.SQLFile != "" {
-		// Determine the API description file's directory to make relative paths work
-		apiDir := filepath.Dir(s.apiDescPath)
+	// Record the params the method uses in the request log
+	usedParams := make(map[string]interface{}, len(methodDef.Params))
+	for _, name := range methodDef.Params {
+		usedParams[name] = paramValue(name)
+	}
+	requestInfoFrom(r.Context()).note(endpoint.Path, usedParams)
 
-		// Build the SQL file path relative to the API description file
-		sqlFilePath := filepath.Join(apiDir, methodDef.SQLFile)
-		log.Printf("Loading SQL from file: %s", sqlFilePath)
+	// Bind declared params by name
+	sqlQuery, sqlParams := bindNamed(sqlQuery, s.dbType, methodDef.Params, paramValue)
 
-		// Read the SQL file
-		sqlBytes, err := os.ReadFile(sqlFilePath)
+	// Statements that don't return rows report what they changed
+	if methodDef.isExec(sqlQuery, s.dbType) {
+		execResult, err := s.executeStatement(r.Context(), sqlQuery, sqlParams, methodDef.IDColumn)
 		if err != nil {
-			sendErrorResponse(w, fmt.Sprintf("Failed to read SQL file: %v", err), http.StatusInternalServerError)
+			sendErrorResponse(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
 			return
 		}
-
-		// Use the file contents as the SQL query
-		sqlQuery = string(sqlBytes)
-	} else {
-		// Use the inline SQL from the API definition
-		sqlQuery = methodDef.SQL
-	}
-
-	// Replace named parameters with ? placeholders and build params array
-	var sqlParams []interface{}
-
-	// If we have defined params, use them in order
-	if len(methodDef.Params) > 0 {
-		for _, paramName := range methodDef.Params {
-			// Check path params first, then query params, then body params
-			if value, ok := pathParams[paramName]; ok {
-				sqlParams = append(sqlParams, value)
-				sqlQuery = strings.Replace(sqlQuery, ":"+paramName, "?", 1)
-			} else if value, ok := queryParams[paramName]; ok {
-				sqlParams = append(sqlParams, value)
-				sqlQuery = strings.Replace(sqlQuery, ":"+paramName, "?", 1)
-			} else if value, ok := bodyParams[paramName]; ok {
-				sqlParams = append(sqlParams, value)
-				sqlQuery = strings.Replace(sqlQuery, ":"+paramName, "?", 1)
-			} else {
-				// Parameter not found, add nil
-				sqlParams = append(sqlParams, nil)
-				sqlQuery = strings.Replace(sqlQuery, ":"+paramName, "?", 1)
+		requestInfoFrom(r.Context()).noteRows(execResult.RowsAffected)
+		statusCode := http.StatusOK
+		if r.Method == "POST" {
+			statusCode = http.StatusCreated
+			if methodDef.Location != "" {
+				w.Header().Set("Location", expandLocation(methodDef.Location, execResult, paramValue))
 			}
 		}
+		s.sendJSONResponse(w, execResult, statusCode)
+		return
 	}
 
 	// Execute the query
-	result, err := s.executeQuery(sqlQuery, sqlParams)
+	result, rows, err := s.queryMethod(r.Context(), methodDef, sqlQuery, sqlParams, paramValue)
 	if err != nil {
 		sendErrorResponse(w, fmt.Sprintf("Database error: %v", err), http.StatusInternalServerError)
 		return
 	}
+	requestInfoFrom(r.Context()).noteRows(int64(len(result.Rows)))
+
+	// Wrap the rows in an envelope if asked
+	if methodDef.Format != "" && methodDef.Format != formatObjects {
+		s.sendJSONResponse(w, newEnvelope(result, rows, methodDef.Format, start), http.StatusOK)
+		return
+	}
+	if result.Truncated {
+		w.Header().Set("X-Result-Truncated", "true")
+	}
+
+	// Shape the rows as the method asks
+	data, found, err := shapeResult(result, rows, methodDef.Result, methodDef.Column)
+	if err != nil {
+		sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		sendErrorResponse(w, "Not found", http.StatusNotFound)
+		return
+	}
 
 	// Return response
-	s.sendJSONResponse(w, result, http.StatusOK)
+	s.sendJSONResponse(w, data, http.StatusOK)
 }
 
 // Handle direct SQL query requests
 func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Query: %s", r.URL.Path)
+	logger(r.Context()).Debug("Query", "path", r.URL.Path)
+	start := time.Now()
 
 	if r.Method != "POST" {
 		sendErrorResponse(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
@@ -539,13 +951,16 @@ func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Use io.TeeReader to log the body while still allowing it to be read
+	if s.maxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxBodyBytes)
+	}
 	var bodyBuffer bytes.Buffer
 	teeReader := io.TeeReader(r.Body, &bodyBuffer)
 
 	// Read the body into a buffer
 	_, err := io.ReadAll(teeReader)
 	if err != nil {
-		sendErrorResponse(w, "Failed to read request body", http.StatusInternalServerError)
+		sendBodyError(w, readBodyError(err, "failed to read request body"))
 		return
 	}
 
@@ -555,16 +970,53 @@ func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
 		sendErrorResponse(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	requestInfoFrom(r.Context()).note("/query", map[string]interface{}{"sql": req.SQL, "params": req.Params})
+
+	// One statement per request, so that each is classified, run and audited on its own
+	if countStatements(req.SQL, s.dbType) > 1 {
+		sendErrorResponse(w, "Only one SQL statement is allowed per request", http.StatusBadRequest)
+		return
+	}
+	// The audit trail can't be changed by the statements it records
+	if s.audit != nil && modifiesData(req.SQL, s.dbType) && mentionsIdentifier(req.SQL, s.dbType, auditTable) {
+		sendErrorResponse(w, fmt.Sprintf("%s can't be changed through /query", auditTable), http.StatusForbidden)
+		return
+	}
+
+	// Statements that don't return rows report what they changed
+	if isWriteStatement(req.SQL, s.dbType) {
+		execResult, err := s.executeStatement(r.Context(), req.SQL, req.Params, "")
+		if err != nil {
+			sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		requestInfoFrom(r.Context()).noteRows(execResult.RowsAffected)
+		s.sendJSONResponse(w, execResult, http.StatusOK)
+		return
+	}
 
 	// Execute the query
-	result, err := s.executeQuery(req.SQL, req.Params)
+	result, err := s.runQuery(r.Context(), req.SQL, req.Params, s.types.Merge(req.Types), s.rowLimit(req.MaxRows))
 	if err != nil {
 		sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	requestInfoFrom(r.Context()).noteRows(int64(len(result.Rows)))
 
 	// Return response
-	s.sendJSONResponse(w, result, http.StatusOK)
+	rows := result.maps()
+	if req.Format != "" && req.Format != formatObjects {
+		if !containsString(resultFormats, req.Format) {
+			sendErrorResponse(w, fmt.Sprintf("Unknown format %q", req.Format), http.StatusBadRequest)
+			return
+		}
+		s.sendJSONResponse(w, newEnvelope(result, rows, req.Format, start), http.StatusOK)
+		return
+	}
+	if result.Truncated {
+		w.Header().Set("X-Result-Truncated", "true")
+	}
+	s.sendJSONResponse(w, rows, http.StatusOK)
 }
 
 // Handle proxy requests
@@ -605,7 +1057,9 @@ func (s *Server) handleProxy(w http.ResponseWriter, r *http.Request) {
 	// 7. (Optional) Reassign the Host header to match target
 	r.Host = targetURL.Host
 
-	// 8. Finally, run the proxy
+	// 8. Finally, run the proxy, logging failures with the request ID
+	proxy.ErrorLog = errorLog(r.Context())
+	logger(r.Context()).Info("Proxy", "target", r.URL.String())
 	proxy.ServeHTTP(w, r)
 }
 
@@ -633,30 +1087,16 @@ func launchBrowser(url string) {
 
 // ===== Main Application =====
 
-// injectPgPort injects or overrides the port in a Postgres connection string (URL or DSN format)
-func injectPgPort(pgConnStr, pgPort string) string {
-	if pgConnStr == "" || pgPort == "" {
-		return pgConnStr
-	}
-	if strings.HasPrefix(pgConnStr, "postgres://") || strings.HasPrefix(pgConnStr, "postgresql://") {
-		u, err := url.Parse(pgConnStr)
-		if err == nil {
-			if u.Port() == "" || u.Port() != pgPort {
-				u.Host = u.Hostname() + ":" + pgPort
-				return u.String()
-			}
+func main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		log.SetFlags(log.LstdFlags)
+		if err := runMigrateCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
 		}
-		return pgConnStr
-	}
-	// DSN format: add or replace port=...
-	re := regexp.MustCompile(`port=\\d+`)
-	if re.MatchString(pgConnStr) {
-		return re.ReplaceAllString(pgConnStr, "port="+pgPort)
+		return
 	}
-	return pgConnStr + " port=" + pgPort
-}
 
-func main() {
 	// Set custom flag usage to display double dashes for word options
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
@@ -674,12 +1114,53 @@ func main() {
 	var portValue string
 	flag.StringVar(&portValue, "port", "8080", "Port to run the server on")
 	flag.StringVar(&portValue, "p", "8080", "Port to run the server on (shorthand)")
-	extension := flag.String("extension", "", "Path to SQLite extension to load")
+	extension := flag.String("extension", "", "Comma-separated SQLite extensions to load on every connection, each a path optionally followed by :entry_point")
+	requireExtensions := flag.Bool("require-extensions", false, "Exit when an extension fails to load instead of logging a warning")
+	steampipeConfig := flag.String("steampipe-config", "", "Comma-separated plugin=file pairs of Steampipe connection config, e.g. aws=aws.spc")
+	steampipeCache := flag.Bool("steampipe-cache", false, "Turn on Steampipe's query result cache (off by default)")
+	steampipeCacheTTL := flag.Duration("steampipe-cache-ttl", 0, "How long Steampipe caches query results (default: the API description's, else 5m)")
+	steampipeAllowBypass := flag.Bool("steampipe-allow-bypass", false, "Let clients without the admin token send X-Steampipe-Cache: bypass")
 	apiDesc := flag.String("api", "", "Path to API description file")
 	dbPath := flag.String("db", "data.db", "Path to SQLite database file")
 	showResponses := flag.Bool("show-responses", false, "Enable logging of SQL query responses")
 	pgConnStr := flag.String("pg-conn", "", "PostgreSQL connection string (if provided, use PostgreSQL instead of SQLite)")
 	pgPort := flag.String("pg-port", "", "PostgreSQL port (optional, overrides port in --pg-conn if provided)")
+	pgDefaults := defaultPostgresConfig()
+	pgMaxOpen := flag.Int("pg-max-open", pgDefaults.MaxOpenConns, "Maximum open PostgreSQL connections (0 for no limit)")
+	pgMaxIdle := flag.Int("pg-max-idle", pgDefaults.MaxIdleConns, "Maximum idle PostgreSQL connections kept open")
+	pgConnMaxLifetime := flag.Duration("pg-conn-max-lifetime", pgDefaults.ConnMaxLifetime, "How long a PostgreSQL connection is used before it is replaced (0 keeps it)")
+	pgConnMaxIdleTime := flag.Duration("pg-conn-max-idle-time", pgDefaults.ConnMaxIdleTime, "How long an unused PostgreSQL connection stays open (0 keeps it)")
+	pgConnectTimeout := flag.Duration("pg-connect-timeout", pgDefaults.ConnectTimeout, "How long to keep retrying when PostgreSQL isn't reachable at startup")
+	corsOrigins := flag.String("cors-origins", "", "Comma-separated allowed CORS origins; supports patterns like https://*.example.com (default *)")
+	corsCredentials := flag.Bool("cors-credentials", false, "Allow credentialed CORS requests (cookies, auth headers); needs --cors-origins")
+	corsExposedHeaders := flag.String("cors-expose-headers", "", "Comma-separated response headers exposed to CORS clients")
+	corsMaxAge := flag.Int("cors-max-age", -1, "Seconds browsers may cache CORS preflight responses")
+	migrationsDir := flag.String("migrations", "", "Path to a migrations directory to apply at startup")
+	fixturesDir := flag.String("fixtures", "", "Path to a fixtures directory (JSON, CSV or SQL files) to load at startup")
+	adminToken := flag.String("admin-token", "", "Token required by /admin/ endpoints (sent as a bearer token or X-Admin-Token)")
+	snapshotDir := flag.String("snapshot-dir", "snapshots", "Directory for named database snapshots")
+	maxRows := flag.Int("max-rows", 0, "Maximum rows returned by a query (0 for no limit)")
+	maxBodyBytes := flag.Int64("max-body-bytes", 10<<20, "Maximum request body size in bytes (0 for no limit)")
+	rateLimit := flag.Float64("rate-limit", 0, "Requests per second allowed per client on dynamic paths (0 for no limit)")
+	rateBurst := flag.Int("rate-burst", 0, "Requests a client may make at once before --rate-limit applies (default: the rate)")
+	graphqlEnabled := flag.Bool("graphql", false, "Serve /graphql for every table, even without a \"graphql\" block in the API description")
+	rateKey := flag.String("rate-key", "", "What identifies a client for rate limits: ip, apiKey or header:<Name> (default ip)")
+	rateAPIKeys := flag.String("rate-api-keys", "", "Comma-separated X-API-Key values that identify clients when --rate-key is apiKey")
+	staticRoot := flag.String("static-root", ".", "Directory to serve static files from")
+	staticDeny := flag.String("static-deny", "", "Comma-separated glob patterns of additional files never to serve")
+	spaFallback := flag.Bool("spa-fallback", true, "Serve index.html for unknown extensionless paths (history-mode routes)")
+	embeddedSite := flag.Bool("embedded-site", false, "Fall back to the built-in default site for files missing from the static root")
+	logFormat := flag.String("log-format", "text", "Log output format: text or json")
+	logLevel := flag.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	requestLogPath := flag.String("request-log", "", "SQLite file to record every request in, attached as request_log")
+	requestLogRetention := flag.Duration("request-log-retention", 7*24*time.Hour, "How long request log entries are kept (0 keeps them all)")
+	requestLogRedact := flag.String("request-log-redact", "", "Comma-separated param names to redact in the request log and console, besides passwords, tokens, secrets and keys; *name matches names ending in name")
+	devMode := flag.Bool("dev", false, "Reload browsers when static files change, and restart when the API description changes")
+	consoleEnabled := flag.Bool("console", false, "Serve the admin console")
+	consolePath := flag.String("console-path", "/console/", "Path to serve the admin console under")
+	auditEnabled := flag.Bool("audit", false, "Record every data-modifying statement in the audit_log table, even without an \"audit\" block in the API description")
+	auditIdentity := flag.String("audit-identity", "", "Where the audit trail takes identities from: basic, apiKey or header:<Name> (default basic)")
+	trustedProxies := flag.String("trusted-proxies", "127.0.0.1,::1", "Comma-separated addresses or CIDR ranges of proxies whose X-Forwarded-For header is trusted (\"\" for none)")
 
 	// Short-form alias for show-responses
 	var shortShowResponses bool
@@ -689,6 +1170,9 @@ func main() {
 
 	// Set up logging
 	log.SetFlags(log.Lshortfile | log.LstdFlags)
+	if err := setupLogging(*logFormat, *logLevel); err != nil {
+		log.Fatal(err)
+	}
 	log.Println("Server starting...")
 
 	// Print current working directory
@@ -700,28 +1184,142 @@ func main() {
 
 	// Initialize server
 	showResponsesEnabled := *showResponses || shortShowResponses
-	finalPgConnStr := injectPgPort(*pgConnStr, *pgPort)
-	server, err := NewServer(*dbPath, finalPgConnStr, *extension, *apiDesc, showResponsesEnabled)
+	pg := PostgresConfig{
+		ConnStr:         *pgConnStr,
+		Port:            *pgPort,
+		MaxOpenConns:    *pgMaxOpen,
+		MaxIdleConns:    *pgMaxIdle,
+		ConnMaxLifetime: *pgConnMaxLifetime,
+		ConnMaxIdleTime: *pgConnMaxIdleTime,
+		ConnectTimeout:  *pgConnectTimeout,
+	}
+	extensions := ExtensionConfig{Extensions: parseExtensions(*extension), Required: *requireExtensions}
+	if *steampipeConfig != "" || *steampipeCache || *steampipeCacheTTL > 0 || *steampipeAllowBypass {
+		extensions.Steampipe = &SteampipeConfig{}
+		if extensions.Steampipe.Plugins, err = parseSteampipePlugins(*steampipeConfig); err != nil {
+			log.Fatal(err)
+		}
+		if *steampipeCache {
+			extensions.Steampipe.Cache = steampipeCache
+		}
+		if *steampipeAllowBypass {
+			extensions.Steampipe.AllowBypass = steampipeAllowBypass
+		}
+		if *steampipeCacheTTL > 0 {
+			ttl := int(steampipeCacheTTL.Seconds())
+			extensions.Steampipe.CacheTTL = &ttl
+		}
+	}
+	// Record requests in their own database, attached to every SQLite connection so they can be queried
+	var requests *requestLog
+	if *requestLogPath != "" {
+		if requests, err = openRequestLog(*requestLogPath, *requestLogRetention); err != nil {
+			log.Fatalf("Failed to open request log: %v", err)
+		}
+		extensions.Attach = map[string]string{requestLogSchema: *requestLogPath}
+	}
+	server, err := NewServer(*dbPath, pg, extensions, *apiDesc, showResponsesEnabled)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Create router
-	mux := http.NewServeMux()
+	// Apply pending migrations before serving anything
+	if *migrationsDir != "" {
+		count, err := server.migrateUp(*migrationsDir)
+		if err != nil {
+			log.Fatalf("Migrations failed: %v", err)
+		}
+		log.Printf("Applied %d migration(s) from %s", count, *migrationsDir)
+	}
 
-	corsMiddleware := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "*")
+	// Audit writes, from the API description or the command line
+	if server.apiDesc != nil && server.apiDesc.Audit != nil || *auditEnabled || *auditIdentity != "" {
+		config := AuditConfig{}
+		if server.apiDesc != nil && server.apiDesc.Audit != nil {
+			config = *server.apiDesc.Audit
+		}
+		if *auditIdentity != "" {
+			config.Identity = *auditIdentity
+		}
+		if err := server.setupAudit(config); err != nil {
+			log.Fatalf("Invalid audit settings: %v", err)
+		}
+	}
 
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
+	// Load fixtures and remember that state for /admin/reset
+	if *fixturesDir != "" {
+		if err := server.loadFixtures(*fixturesDir); err != nil {
+			log.Fatalf("Fixtures failed: %v", err)
+		}
+		if err := server.capturePristine(); err != nil {
+			log.Fatalf("Failed to capture fixture state: %v", err)
+		}
+		log.Printf("Loaded fixtures from %s", *fixturesDir)
+	}
+	server.adminToken = *adminToken
+	if server.adminToken == "" {
+		log.Printf("Warning: No --admin-token set; admin endpoints only accept requests from this machine")
+	}
 
-			next.ServeHTTP(w, r)
-		})
+	// Generate CRUD resources once the schema is in place
+	if err := server.setupCRUD(); err != nil {
+		log.Printf("Warning: Failed to set up CRUD resources: %v", err)
+	}
+	server.snapshotDir = *snapshotDir
+	if err := server.setupGraphQL(*graphqlEnabled); err != nil {
+		log.Printf("Warning: Failed to set up GraphQL: %v", err)
+	}
+	server.maxRows = *maxRows
+	server.maxBodyBytes = *maxBodyBytes
+
+	// Command line rate limits override the API description
+	globalLimit := RateLimitConfig{}
+	if server.apiDesc != nil && server.apiDesc.RateLimit != nil {
+		globalLimit = *server.apiDesc.RateLimit
+	}
+	if *rateLimit > 0 {
+		globalLimit.Rate = *rateLimit
+	}
+	if *rateBurst > 0 {
+		globalLimit.Burst = *rateBurst
+	}
+	if *rateKey != "" {
+		globalLimit.Key = *rateKey
+	}
+	if keys := splitList(*rateAPIKeys); len(keys) > 0 {
+		globalLimit.APIKeys = keys
+	}
+	if err := server.setupLimits(globalLimit); err != nil {
+		log.Fatalf("Invalid rate limit: %v", err)
+	}
+	if server.trustedProxies, err = parseTrustedProxies(*trustedProxies); err != nil {
+		log.Fatal(err)
+	}
+
+	server.redactParams = append(append([]string{}, defaultRedactedParams...), splitList(*requestLogRedact)...)
+	server.requestLog = requests
+	if requests != nil && server.dbType != "sqlite" {
+		log.Printf("Warning: the request log can only be queried through /query with SQLite")
+	}
+
+	// Create router
+	mux := http.NewServeMux()
+
+	// Command line CORS settings override the API description
+	if origins := splitList(*corsOrigins); len(origins) > 0 {
+		server.cors.AllowedOrigins = origins
+	}
+	if *corsCredentials {
+		server.cors.AllowCredentials = corsCredentials
+	}
+	if headers := splitList(*corsExposedHeaders); len(headers) > 0 {
+		server.cors.ExposedHeaders = headers
+	}
+	if *corsMaxAge >= 0 {
+		server.cors.MaxAge = corsMaxAge
+	}
+	if err := server.validateCORS(); err != nil {
+		log.Fatal(err)
 	}
 
 	// Handle API routes first (to match /api/* before static files)
@@ -739,42 +1337,106 @@ func main() {
 	// Then handle query endpoint
 	mux.HandleFunc("/query", server.handleQuery)
 
-	// Handle root and static files
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Received request for: %s", r.URL.Path)
+	// GraphQL over the generated schema
+	if server.graphql != nil {
+		mux.HandleFunc("/graphql", server.handleGraphQL)
+	}
 
-		if r.URL.Path == "/" {
-			log.Println("Trying to serve index.html")
-			http.ServeFile(w, r, "index.html")
-			return
-		}
+	// Schema introspection
+	mux.HandleFunc("/schema", server.handleSchema)
 
-		filePath := "." + r.URL.Path
-		log.Printf("Trying to serve: %s", filePath)
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			log.Printf("File not found: %s", filePath)
-			http.NotFound(w, r)
-			return
+	// Admin endpoints
+	server.registerAdminRoutes(mux)
+
+	// Admin console, with the recent requests it shows
+	if *consoleEnabled {
+		server.recent = newRecentRequests(recentRequestCount)
+		if err := server.registerConsole(mux, *consolePath); err != nil {
+			log.Fatalf("Failed to set up the console: %v", err)
 		}
-		http.ServeFile(w, r, filePath)
+	}
+
+	// Handle root and static files
+	// Never serve the server's own files and directories, nor the Steampipe configs with their credentials
+	denyFiles := append([]string{*dbPath, *apiDesc, *requestLogPath, *migrationsDir, *fixturesDir}, extensionPaths(extensions.Extensions)...)
+	pluginSettings, pluginConfigDir := steampipeSettings(server.apiDesc, *apiDesc, extensions.Steampipe)
+	denyFiles = append(denyFiles, pluginSettings.configFiles(pluginConfigDir)...)
+	staticFiles, err := newStaticHandler(StaticConfig{
+		Root:         *staticRoot,
+		Deny:         splitList(*staticDeny),
+		DenyFiles:    denyFiles,
+		SPAFallback:  *spaFallback,
+		EmbeddedSite: *embeddedSite,
+		DevReload:    *devMode,
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux.Handle("/", staticFiles)
+
+	// Live reload for development
+	if *devMode {
+		reloader := newDevReloader(staticFiles, *apiDesc, server.apiSQLFiles())
+		mux.HandleFunc(devReloadPath, reloader.handleEvents)
+		mux.HandleFunc(devScriptPath, reloader.handleScript)
+		go reloader.watch()
+	}
 
 	// Log server settings
 	log.Printf("Server configuration:")
 	log.Printf("- Port: %s", portValue)
 	log.Printf("- API Description: %s", *apiDesc)
-	log.Printf("- Extension: %s", *extension)
+	log.Printf("- Extensions: %s (required: %v)", joinExtensions(extensions.Extensions), *requireExtensions)
 	log.Printf("- Show Responses: %v", showResponsesEnabled)
-	if *pgConnStr != "" {
-		log.Printf("- Database: PostgreSQL")
+	log.Printf("- Static Root: %s", staticFiles.root)
+	log.Printf("- CORS Origins: %s (credentials: %v)", strings.Join(server.cors.AllowedOrigins, ", "), server.cors.credentials())
+	if server.rateLimit != nil {
+		log.Printf("- Rate Limit: %g/s per client (burst %g)", server.rateLimit.config.Rate, server.rateLimit.burst)
+	}
+	if *trustedProxies != "" {
+		log.Printf("- Trusted Proxies: %s", *trustedProxies)
+	}
+	if *devMode {
+		log.Printf("- Dev Mode: live reload on")
+	}
+	if server.consolePath != "" {
+		log.Printf("- Console: %s", server.consolePath)
+	}
+	if server.audit != nil {
+		identity := server.audit.Identity
+		if identity == "" {
+			identity = "basic"
+		}
+		log.Printf("- Audit: %s (identity: %s)", auditTable, identity)
+	}
+	if server.requestLog != nil {
+		log.Printf("- Request Log: %s (retention: %s)", *requestLogPath, *requestLogRetention)
+	}
+	if server.dbType == "postgres" {
+		log.Printf("- Database: PostgreSQL (%s, max open: %d, max idle: %d, max lifetime: %s)", server.dbTarget, pg.MaxOpenConns, pg.MaxIdleConns, pg.ConnMaxLifetime)
 	} else {
-		os.Setenv("STEAMPIPE_CACHE", "false")
-		log.Printf("- Database: SQLite (data.db)")
+		log.Printf("- Database: SQLite (%s)", server.dbTarget)
+	}
+	if server.steampipe != nil {
+		for _, plugin := range server.steampipe.plugins {
+			source := plugin.ConfigSource
+			if source == "" {
+				source = "defaults"
+			}
+			log.Printf("- Steampipe Plugin: %s (config: %s)", plugin.Name, source)
+		}
+		cache, ttl := steampipeCacheSettings()
+		log.Printf("- Steampipe Cache: %v (ttl: %ds)", cache, ttl)
+	}
+
+	// Keep an eye on the PostgreSQL connection
+	if server.dbType == "postgres" {
+		go server.watchDatabase()
 	}
 
 	// Start server
 	log.Printf("Server listening on localhost:%s...", portValue)
-	if err := http.ListenAndServe("127.0.0.1:"+portValue, corsMiddleware(mux)); err != nil {
+	if err := http.ListenAndServe("127.0.0.1:"+portValue, server.logMiddleware(server.corsMiddleware(server.rateLimitMiddleware(server.steampipeMiddleware(mux))))); err != nil {
 		log.Fatal(err)
 	}
 }